@@ -0,0 +1,907 @@
+// Package anthropic is a client for the Anthropic Messages API, so that Claude models can be used without an OpenAI
+// compatible endpoint or a model provider tool.
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	humav2 "github.com/danielgtaylor/huma/v2"
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DefaultBaseURL   = "https://api.anthropic.com"
+	APIVersion       = "2023-06-01"
+	DefaultMaxTokens = 8192
+	WaitingMessage   = "Waiting for model response..."
+
+	modelPrefix       = "claude-"
+	minThinkingBudget = 1024
+)
+
+// IsModel returns whether modelName is the name of a Claude model, and not a model of a provider tool.
+func IsModel(modelName string) bool {
+	_, provider := types.SplitToolRef(modelName)
+	return provider == "" && strings.HasPrefix(modelName, modelPrefix)
+}
+
+type Options struct {
+	BaseURL string `usage:"Anthropic base URL" name:"anthropic-base-url" env:"ANTHROPIC_BASE_URL"`
+	APIKey  string `usage:"Anthropic API key, Claude models are called directly when it is set" name:"anthropic-api-key" env:"ANTHROPIC_API_KEY"`
+	Cache   *cache.Client
+}
+
+func Complete(opts ...Options) (result Options) {
+	for _, opt := range opts {
+		result.BaseURL = types.FirstSet(opt.BaseURL, result.BaseURL)
+		result.APIKey = types.FirstSet(opt.APIKey, result.APIKey)
+		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+	}
+	return result
+}
+
+func complete(opts ...Options) (Options, error) {
+	var err error
+	result := Complete(opts...)
+	if result.Cache == nil {
+		result.Cache, err = cache.New(cache.Options{
+			DisableCache: true,
+		})
+	}
+
+	result.BaseURL = types.FirstSet(result.BaseURL, os.Getenv("ANTHROPIC_BASE_URL"), DefaultBaseURL)
+	result.APIKey = types.FirstSet(result.APIKey, os.Getenv("ANTHROPIC_API_KEY"))
+	return result, err
+}
+
+// Configured returns whether an API key is set in the options or the environment.
+func Configured(opts ...Options) bool {
+	return types.FirstSet(Complete(opts...).APIKey, os.Getenv("ANTHROPIC_API_KEY")) != ""
+}
+
+type Client struct {
+	baseURL      string
+	apiKey       string
+	cache        *cache.Client
+	cacheKeyBase string
+	http         *http.Client
+}
+
+func NewClient(opts ...Options) (*Client, error) {
+	opt, err := complete(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(opt.BaseURL, "/"),
+		apiKey:       opt.APIKey,
+		cache:        opt.Cache,
+		cacheKeyBase: hash.ID(opt.APIKey, opt.BaseURL),
+		http:         http.DefaultClient,
+	}, nil
+}
+
+func (c *Client) Supports(_ context.Context, modelName string) (bool, error) {
+	return IsModel(modelName), nil
+}
+
+func (c *Client) ListModels(ctx context.Context, providers ...string) ([]openai.Model, error) {
+	// Only serve if providers is empty or "" is in the list
+	if len(providers) != 0 && !slices.Contains(providers, "") {
+		return nil, nil
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/models?limit=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var list struct {
+		Data []struct {
+			ID        string    `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	models := make([]openai.Model, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, openai.Model{
+			ID:        m.ID,
+			Object:    "model",
+			OwnedBy:   "anthropic",
+			CreatedAt: m.CreatedAt.Unix(),
+		})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, content)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("Anthropic-Version", APIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// APIError is an error response of the Anthropic API.
+type APIError struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("anthropic API error (status %d, %s): %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Retryable returns whether another model might not have the error: a rate limit, an overloaded or failing server, or
+// a prompt that is too long.
+func (e *APIError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= http.StatusInternalServerError:
+		return true
+	case e.Type == "rate_limit_error", e.Type == "overloaded_error", e.Type == "api_error":
+		return true
+	}
+	return e.Type == "invalid_request_error" && strings.Contains(e.Message, "prompt is too long")
+}
+
+func newAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Error.Message == "" {
+		return &APIError{StatusCode: resp.StatusCode, Type: "unknown", Message: strings.TrimSpace(string(data))}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Type: body.Error.Type, Message: body.Error.Message}
+}
+
+type request struct {
+	Model     string `json:"model"`
+	MaxTokens int    `json:"max_tokens"`
+	// System is a string, or a list of text blocks when the system prompt is cached.
+	System      any         `json:"system,omitempty"`
+	Messages    []message   `json:"messages"`
+	Tools       []tool      `json:"tools,omitempty"`
+	ToolChoice  *toolChoice `json:"tool_choice,omitempty"`
+	Temperature *float32    `json:"temperature,omitempty"`
+	Thinking    *thinking   `json:"thinking,omitempty"`
+	Stream      bool        `json:"stream"`
+}
+
+type toolChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+
+	// text
+	Text string `json:"text,omitempty"`
+
+	// image and document
+	Source *mediaSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	// The content of a tool result is either a string or a list of text, image and document blocks.
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   any    `json:"content,omitempty"`
+
+	// thinking and redacted_thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+
+	CacheControl *cacheControl `json:"cache_control,omitempty"`
+}
+
+// cacheControl marks the end of a prefix of the request that Anthropic caches. Everything before it, in the order
+// tools, system and messages, is read from the cache when the next request starts with the same prefix.
+type cacheControl struct {
+	Type string `json:"type"`
+}
+
+// maxCacheBreakpoints is how many cache_control blocks a request can have.
+const maxCacheBreakpoints = 4
+
+type mediaSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+
+	CacheControl *cacheControl `json:"cache_control,omitempty"`
+}
+
+// toRequest translates a completion request to a Messages API request. System messages are joined into the system
+// prompt, and tool results are sent as user messages, merged with the messages around them because the roles of
+// the messages have to alternate.
+func toRequest(messageRequest types.CompletionRequest) request {
+	var (
+		systemPrompts []string
+		cacheSystem   bool
+		messages      []message
+		// The blocks that end a prefix that can be cached.
+		cacheBlocks []blockIndex
+	)
+
+	if messageRequest.InternalSystemPrompt == nil || *messageRequest.InternalSystemPrompt {
+		systemPrompts = append(systemPrompts, system.InternalSystemPrompt)
+	}
+
+	for _, msg := range messageRequest.Messages {
+		var (
+			role   = "user"
+			blocks []contentBlock
+		)
+		switch msg.Role {
+		case types.CompletionMessageRoleTypeSystem:
+			if len(msg.Content) > 0 {
+				systemPrompts = append(systemPrompts, msg.Content[0].Text)
+				cacheSystem = cacheSystem || msg.CacheControl
+			}
+			continue
+		case types.CompletionMessageRoleTypeAssistant:
+			role = "assistant"
+		}
+
+		if msg.Role == types.CompletionMessageRoleTypeTool && msg.ToolCall != nil {
+			blocks = append(blocks, toolResultBlock(msg))
+		} else {
+			for _, content := range msg.Content {
+				if content.Reasoning != nil && messageRequest.ReasoningEffort != "" {
+					// With thinking enabled, the thinking of the last assistant turn has to be sent back unchanged
+					// before its tool calls. Reasoning from other providers can't be verified, so it is left out.
+					if block, ok := thinkingBlock(*content.Reasoning); ok {
+						blocks = append(blocks, block)
+					}
+				}
+				if content.Text != "" {
+					text := content.Text
+					if prompt, ok := system.IsDefaultPrompt(text); ok {
+						text = prompt
+					}
+					blocks = append(blocks, textToBlocks(text)...)
+				}
+				if content.Image != nil || content.File != nil {
+					blocks = append(blocks, mediaBlock(content))
+				}
+				if content.ToolCall != nil {
+					blocks = append(blocks, toolUseBlock(*content.ToolCall))
+				}
+			}
+		}
+
+		if len(blocks) == 0 {
+			continue
+		}
+		if !messageRequest.Chat && len(blocks) == 1 && blocks[0].Type == "text" && strings.TrimSpace(blocks[0].Text) == "{}" {
+			continue
+		}
+
+		if len(messages) > 0 && messages[len(messages)-1].Role == role {
+			messages[len(messages)-1].Content = append(messages[len(messages)-1].Content, blocks...)
+		} else {
+			messages = append(messages, message{Role: role, Content: blocks})
+		}
+		if msg.CacheControl {
+			cacheBlocks = append(cacheBlocks, blockIndex{message: len(messages) - 1, block: len(messages[len(messages)-1].Content) - 1})
+		}
+	}
+
+	if messageRequest.JSONResponse {
+		systemPrompts = append(systemPrompts, "Respond with a single valid JSON object and nothing else.")
+	}
+
+	result := request{
+		Model:       messageRequest.Model,
+		MaxTokens:   messageRequest.MaxTokens,
+		Messages:    messages,
+		Temperature: messageRequest.Temperature,
+		Stream:      true,
+	}
+	if system := strings.Join(systemPrompts, "\n"); system != "" {
+		result.System = system
+	}
+	if result.MaxTokens <= 0 {
+		result.MaxTokens = DefaultMaxTokens
+	}
+	if budget := messageRequest.ReasoningBudget(); budget > 0 {
+		// The budget has to be at least 1024 tokens and less than the maximum tokens, and thinking only works with
+		// the default temperature.
+		budget = max(budget, minThinkingBudget)
+		result.Thinking = &thinking{
+			Type:         "enabled",
+			BudgetTokens: budget,
+		}
+		if result.MaxTokens <= budget {
+			result.MaxTokens = budget + DefaultMaxTokens
+		}
+		result.Temperature = nil
+	} else if result.Temperature == nil {
+		result.Temperature = new(float32)
+	}
+
+	for _, t := range messageRequest.Tools {
+		var params any = t.Function.Parameters
+		if t.Function.Parameters == nil || len(t.Function.Parameters.Properties) == 0 {
+			params = map[string]any{
+				"type":       humav2.TypeObject,
+				"properties": map[string]any{},
+			}
+		}
+		result.Tools = append(result.Tools, tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: params,
+		})
+	}
+
+	if len(result.Tools) > 0 {
+		result.ToolChoice = toToolChoice(messageRequest, result.Thinking != nil)
+	}
+
+	addCacheControl(&result, messageRequest.CacheTools, cacheSystem, cacheBlocks)
+	return result
+}
+
+// toToolChoice returns the tool_choice of the request, or nil for the default of Anthropic.
+func toToolChoice(messageRequest types.CompletionRequest, thinking bool) *toolChoice {
+	result := &toolChoice{
+		Type:                   "auto",
+		DisableParallelToolUse: messageRequest.ParallelToolCalls != nil && !*messageRequest.ParallelToolCalls,
+	}
+	switch {
+	case messageRequest.ToolChoice == types.ToolChoiceNone:
+		result.Type = "none"
+	case thinking && messageRequest.ForcesToolCall():
+		// A tool call can't be forced with thinking enabled, so the model is left to choose.
+	case messageRequest.ToolChoice == types.ToolChoiceRequired:
+		result.Type = "any"
+	case messageRequest.ForcedFunction() != "":
+		result.Type = "tool"
+		result.Name = messageRequest.ForcedFunction()
+	case !result.DisableParallelToolUse:
+		return nil
+	}
+	return result
+}
+
+type blockIndex struct {
+	message, block int
+}
+
+// addCacheControl adds the cache breakpoints to the request: after the tools, after the system prompt and after the
+// messages that end a stable prefix, latest first because they cover the most.
+func addCacheControl(req *request, cacheTools, cacheSystem bool, cacheBlocks []blockIndex) {
+	breakpoints := maxCacheBreakpoints
+	if cacheTools && len(req.Tools) > 0 {
+		req.Tools[len(req.Tools)-1].CacheControl = &cacheControl{Type: "ephemeral"}
+		breakpoints--
+	}
+	if system, ok := req.System.(string); ok && cacheSystem {
+		req.System = []contentBlock{{
+			Type:         "text",
+			Text:         system,
+			CacheControl: &cacheControl{Type: "ephemeral"},
+		}}
+		breakpoints--
+	}
+	for i := len(cacheBlocks) - 1; i >= 0 && breakpoints > 0; i-- {
+		// Thinking blocks can't be marked.
+		block := &req.Messages[cacheBlocks[i].message].Content[cacheBlocks[i].block]
+		if block.Type != "thinking" && block.Type != "redacted_thinking" {
+			block.CacheControl = &cacheControl{Type: "ephemeral"}
+			breakpoints--
+		}
+	}
+}
+
+func thinkingBlock(reasoning types.Reasoning) (contentBlock, bool) {
+	switch {
+	case reasoning.Redacted != "":
+		return contentBlock{
+			Type: "redacted_thinking",
+			Data: reasoning.Redacted,
+		}, true
+	case reasoning.Signature != "":
+		return contentBlock{
+			Type:      "thinking",
+			Thinking:  reasoning.Text,
+			Signature: reasoning.Signature,
+		}, true
+	}
+	return contentBlock{}, false
+}
+
+func toolUseBlock(call types.CompletionToolCall) contentBlock {
+	// The input of a tool call must be a JSON object.
+	input := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		input = json.RawMessage("{}")
+	} else if !json.Valid(input) || !strings.HasPrefix(strings.TrimSpace(call.Function.Arguments), "{") {
+		input, _ = json.Marshal(map[string]string{"input": call.Function.Arguments})
+	}
+	return contentBlock{
+		Type:  "tool_use",
+		ID:    call.ID,
+		Name:  call.Function.Name,
+		Input: input,
+	}
+}
+
+// toolResultBlock returns the tool_result block of a tool message. The content is a plain string, unless the tool
+// returned images or files.
+func toolResultBlock(msg types.CompletionMessage) contentBlock {
+	var (
+		blocks   []contentBlock
+		hasMedia bool
+	)
+	for _, content := range msg.Content {
+		if content.Text != "" {
+			for _, block := range textToBlocks(content.Text) {
+				hasMedia = hasMedia || block.Type != "text"
+				blocks = append(blocks, block)
+			}
+		}
+		if content.Image != nil || content.File != nil {
+			hasMedia = true
+			blocks = append(blocks, mediaBlock(content))
+		}
+	}
+
+	result := contentBlock{
+		Type:      "tool_result",
+		ToolUseID: msg.ToolCall.ID,
+	}
+	if hasMedia {
+		result.Content = blocks
+	} else if text := msg.ChatText(); text != "" {
+		result.Content = text
+	}
+	return result
+}
+
+// textToBlocks turns the images and files that are in a text as data URLs, one per line, into image and document
+// blocks.
+func textToBlocks(text string) []contentBlock {
+	var blocks []contentBlock
+	for _, part := range types.Content(text) {
+		if part.Image != nil || part.File != nil {
+			blocks = append(blocks, mediaBlock(part))
+		} else {
+			blocks = append(blocks, contentBlock{
+				Type: "text",
+				Text: part.Text,
+			})
+		}
+	}
+	return blocks
+}
+
+// mediaBlock returns an image block for images and a document block for PDFs. Claude can't read other files, so it
+// is told about them instead.
+func mediaBlock(part types.ContentPart) contentBlock {
+	blockType, media := "image", part.Image
+	if media == nil {
+		blockType, media = "document", part.File
+		if media.MimeType != "application/pdf" {
+			return contentBlock{
+				Type: "text",
+				Text: fmt.Sprintf("[The file %s (%s) is attached, but this model can't read it]", types.FirstSet(media.Name, "without a name"), media.MimeType),
+			}
+		}
+	}
+
+	if data, ok := media.Base64(); ok {
+		return contentBlock{
+			Type: blockType,
+			Source: &mediaSource{
+				Type:      "base64",
+				MediaType: media.MimeType,
+				Data:      data,
+			},
+		}
+	}
+	return contentBlock{
+		Type: blockType,
+		Source: &mediaSource{
+			Type: "url",
+			URL:  media.URL,
+		},
+	}
+}
+
+func (c *Client) cacheKey(request request) any {
+	return map[string]any{
+		"base":    c.cacheKeyBase,
+		"request": request,
+	}
+}
+
+func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if c.apiKey == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY is not set. Please set the ANTHROPIC_API_KEY environment variable")
+	}
+
+	request := toRequest(messageRequest)
+	if len(request.Messages) == 0 {
+		log.Errorf("invalid request, no messages to send to LLM")
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(""),
+		}, nil
+	}
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request: map[string]any{
+			"messages": request,
+		},
+	}
+
+	var (
+		result types.CompletionMessage
+		cached bool
+		err    error
+	)
+	if messageRequest.GetCache() {
+		cached, err = c.cache.Get(ctx, c.cacheKey(request), &result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cached {
+		result.Usage = types.Usage{}
+	} else {
+		result, err = c.call(ctx, request, id, status)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     result,
+		Usage:        result.Usage,
+		Cached:       cached,
+	}
+
+	return &result, nil
+}
+
+func (c *Client) call(ctx context.Context, request request, transactionID string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+	partial <- types.CompletionStatus{
+		CompletionID: transactionID,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(WaitingMessage),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if engineCtx, ok := engine.FromContext(ctx); ok {
+		engineCtx.OnUserCancel(ctx, cancel)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/v1/messages", request)
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	log.Debugf("calling anthropic with model %s and %d messages", request.Model, len(request.Messages))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		return types.CompletionMessage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.CompletionMessage{}, newAPIError(resp)
+	}
+
+	var (
+		stream = &stream{}
+		start  = time.Now()
+	)
+	err = readEvents(resp.Body, func(event string, data []byte) error {
+		if err := stream.add(event, data); err != nil {
+			return err
+		}
+		if partial != nil && time.Since(start) > 100*time.Millisecond {
+			msg := stream.message()
+			partial <- types.CompletionStatus{
+				CompletionID:    transactionID,
+				PartialResponse: &msg,
+			}
+			start = time.Now()
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		// The cache won't save the response if the context was canceled.
+		return stream.message(), nil
+	} else if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	result := stream.message()
+	return result, c.cache.Store(ctx, c.cacheKey(request), result)
+}
+
+// readEvents reads server-sent events and calls fn with the name and data of each event.
+func readEvents(r io.Reader, fn func(event string, data []byte) error) error {
+	var (
+		scanner = bufio.NewScanner(r)
+		event   string
+		data    []byte
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fn(event, data)
+	}
+	return nil
+}
+
+// stream collects the content blocks and usage of a streamed response.
+type stream struct {
+	blocks []*streamBlock
+	usage  types.Usage
+}
+
+type streamBlock struct {
+	typ       string
+	id        string
+	name      string
+	data      string
+	signature string
+	text      strings.Builder
+	json      strings.Builder
+}
+
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		Usage usage `json:"usage"`
+	} `json:"message"`
+	ContentBlock struct {
+		Type      string `json:"type"`
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Text      string `json:"text"`
+		Thinking  string `json:"thinking"`
+		Signature string `json:"signature"`
+		Data      string `json:"data"`
+	} `json:"content_block"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage usage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// promptTokens returns the usage with all prompt tokens, because the input tokens of Anthropic don't include the
+// tokens that were read from or written to the cache.
+func (u usage) promptTokens() types.Usage {
+	return types.Usage{
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CacheReadTokens:  u.CacheReadInputTokens,
+		CacheWriteTokens: u.CacheCreationInputTokens,
+	}
+}
+
+func (s *stream) add(name string, data []byte) error {
+	var event streamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("invalid %s event from anthropic: %w", name, err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.usage = event.Message.Usage.promptTokens()
+		s.usage.CompletionTokens = event.Message.Usage.OutputTokens
+	case "content_block_start":
+		for len(s.blocks) <= event.Index {
+			s.blocks = append(s.blocks, &streamBlock{})
+		}
+		b := s.blocks[event.Index]
+		b.typ, b.id, b.name = event.ContentBlock.Type, event.ContentBlock.ID, event.ContentBlock.Name
+		b.data, b.signature = event.ContentBlock.Data, event.ContentBlock.Signature
+		b.text.WriteString(event.ContentBlock.Text)
+		b.text.WriteString(event.ContentBlock.Thinking)
+	case "content_block_delta":
+		if event.Index >= len(s.blocks) {
+			return fmt.Errorf("anthropic sent a delta for unknown content block %d", event.Index)
+		}
+		b := s.blocks[event.Index]
+		switch event.Delta.Type {
+		case "text_delta":
+			b.text.WriteString(event.Delta.Text)
+		case "input_json_delta":
+			b.json.WriteString(event.Delta.PartialJSON)
+		case "thinking_delta":
+			b.text.WriteString(event.Delta.Thinking)
+		case "signature_delta":
+			b.signature += event.Delta.Signature
+		}
+	case "message_delta":
+		// The usage of message_delta events is cumulative.
+		if event.Usage.OutputTokens > 0 {
+			s.usage.CompletionTokens = event.Usage.OutputTokens
+		}
+		if prompt := event.Usage.promptTokens(); prompt.PromptTokens > 0 {
+			s.usage.PromptTokens = prompt.PromptTokens
+			s.usage.CacheReadTokens = prompt.CacheReadTokens
+			s.usage.CacheWriteTokens = prompt.CacheWriteTokens
+		}
+	case "error":
+		return &APIError{StatusCode: http.StatusOK, Type: event.Error.Type, Message: event.Error.Message}
+	}
+	return nil
+}
+
+func (s *stream) message() types.CompletionMessage {
+	msg := types.CompletionMessage{
+		Role:  types.CompletionMessageRoleTypeAssistant,
+		Usage: s.usage,
+	}
+	msg.Usage.TotalTokens = msg.Usage.PromptTokens + msg.Usage.CompletionTokens
+
+	for _, b := range s.blocks {
+		switch b.typ {
+		case "text":
+			if b.text.Len() > 0 {
+				msg.Content = append(msg.Content, types.ContentPart{Text: b.text.String()})
+			}
+		case "thinking":
+			msg.Content = append(msg.Content, types.ContentPart{Reasoning: &types.Reasoning{
+				Text:      b.text.String(),
+				Signature: b.signature,
+			}})
+		case "redacted_thinking":
+			msg.Content = append(msg.Content, types.ContentPart{Reasoning: &types.Reasoning{
+				Redacted: b.data,
+			}})
+		case "tool_use":
+			args := b.json.String()
+			if args == "" {
+				args = "{}"
+			}
+			msg.Content = append(msg.Content, types.ContentPart{
+				ToolCall: &types.CompletionToolCall{
+					Index: ptr(len(msg.Content)),
+					ID:    b.id,
+					Function: types.CompletionFunctionCall{
+						Name:      b.name,
+						Arguments: args,
+					},
+				},
+			})
+		}
+	}
+	return msg
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
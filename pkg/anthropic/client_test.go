@@ -0,0 +1,380 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsModel(t *testing.T) {
+	assert.True(t, IsModel("claude-sonnet-4-5"))
+	assert.False(t, IsModel("gpt-4o"))
+	assert.False(t, IsModel("claude-sonnet-4-5 from github.com/example/provider"))
+}
+
+func TestToRequest(t *testing.T) {
+	req := toRequest(types.CompletionRequest{
+		Model:                "claude-sonnet-4-5",
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("Be brief.")},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("What is in this picture?\ndata:image/png;base64,xxxx")},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{Text: "Let me look."},
+				{ToolCall: &types.CompletionToolCall{ID: "toolu_1", Function: types.CompletionFunctionCall{Name: "describe", Arguments: `{"detail":"high"}`}}},
+				{ToolCall: &types.CompletionToolCall{ID: "toolu_2", Function: types.CompletionFunctionCall{Name: "count"}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("A cat"), ToolCall: &types.CompletionToolCall{ID: "toolu_1"}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("1"), ToolCall: &types.CompletionToolCall{ID: "toolu_2"}},
+		},
+		Tools: []types.ChatCompletionTool{
+			{Function: types.CompletionFunctionDefinition{Name: "describe", Description: "Describes the picture"}},
+		},
+	})
+
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"model": "claude-sonnet-4-5",
+		"max_tokens": 8192,
+		"system": "Be brief.",
+		"temperature": 0,
+		"stream": true,
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this picture?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "xxxx"}}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "text", "text": "Let me look."},
+				{"type": "tool_use", "id": "toolu_1", "name": "describe", "input": {"detail": "high"}},
+				{"type": "tool_use", "id": "toolu_2", "name": "count", "input": {}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "A cat"},
+				{"type": "tool_result", "tool_use_id": "toolu_2", "content": "1"}
+			]}
+		],
+		"tools": [
+			{"name": "describe", "description": "Describes the picture", "input_schema": {"type": "object", "properties": {}}}
+		]
+	}`, string(data))
+}
+
+func TestToRequestCache(t *testing.T) {
+	req := toRequest(types.CompletionRequest{
+		Model:                "claude-sonnet-4-5",
+		InternalSystemPrompt: new(bool),
+		CacheTools:           true,
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("Be brief."), CacheControl: true},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Here is the document."), CacheControl: true},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Summarize it.")},
+		},
+		Tools: []types.ChatCompletionTool{
+			{Function: types.CompletionFunctionDefinition{Name: "describe"}},
+			{Function: types.CompletionFunctionDefinition{Name: "count"}},
+		},
+	})
+
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"model": "claude-sonnet-4-5",
+		"max_tokens": 8192,
+		"system": [{"type": "text", "text": "Be brief.", "cache_control": {"type": "ephemeral"}}],
+		"temperature": 0,
+		"stream": true,
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "Here is the document.", "cache_control": {"type": "ephemeral"}},
+				{"type": "text", "text": "Summarize it."}
+			]}
+		],
+		"tools": [
+			{"name": "describe", "input_schema": {"type": "object", "properties": {}}},
+			{"name": "count", "input_schema": {"type": "object", "properties": {}}, "cache_control": {"type": "ephemeral"}}
+		]
+	}`, string(data))
+
+	// Only four breakpoints are allowed, so the latest messages are marked.
+	var messages []types.CompletionMessage
+	for _, text := range []string{"one", "two", "three", "four"} {
+		messages = append(messages,
+			types.CompletionMessage{Role: types.CompletionMessageRoleTypeUser, Content: types.Text(text), CacheControl: true},
+			types.CompletionMessage{Role: types.CompletionMessageRoleTypeAssistant, Content: types.Text("ok")})
+	}
+	req = toRequest(types.CompletionRequest{
+		CacheTools: true,
+		Messages:   messages,
+		Tools:      []types.ChatCompletionTool{{Function: types.CompletionFunctionDefinition{Name: "describe"}}},
+	})
+	assert.NotNil(t, req.Tools[0].CacheControl)
+	assert.IsType(t, "", req.System)
+	var marked []string
+	for _, msg := range req.Messages {
+		if msg.Content[0].CacheControl != nil {
+			marked = append(marked, msg.Content[0].Text)
+		}
+	}
+	assert.Equal(t, []string{"two", "three", "four"}, marked)
+}
+
+func TestToRequestToolChoice(t *testing.T) {
+	tools := []types.ChatCompletionTool{{Function: types.CompletionFunctionDefinition{Name: "weather"}}}
+
+	req := toRequest(types.CompletionRequest{Tools: tools})
+	assert.Nil(t, req.ToolChoice)
+
+	req = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: "weather", ParallelToolCalls: new(bool)})
+	assert.Equal(t, &toolChoice{Type: "tool", Name: "weather", DisableParallelToolUse: true}, req.ToolChoice)
+
+	req = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: types.ToolChoiceRequired})
+	assert.Equal(t, &toolChoice{Type: "any"}, req.ToolChoice)
+
+	req = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: types.ToolChoiceNone})
+	assert.Equal(t, &toolChoice{Type: "none"}, req.ToolChoice)
+
+	// With thinking, a tool call can't be forced.
+	req = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: types.ToolChoiceRequired, ReasoningEffort: types.ReasoningEffortLow})
+	assert.Equal(t, &toolChoice{Type: "auto"}, req.ToolChoice)
+
+	// Without tools, there is nothing to choose.
+	req = toRequest(types.CompletionRequest{ToolChoice: types.ToolChoiceRequired})
+	assert.Nil(t, req.ToolChoice)
+}
+
+func TestToRequestMedia(t *testing.T) {
+	req := toRequest(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeUser, Content: []types.ContentPart{
+				{Text: "Summarize these"},
+				{Image: &types.Media{URL: "https://example.com/chart.jpg", MimeType: "image/jpeg"}},
+				{File: &types.Media{URL: "data:application/pdf;name=report.pdf;base64,yyyy", MimeType: "application/pdf", Name: "report.pdf"}},
+				{File: &types.Media{URL: "data:application/zip;base64,zzzz", MimeType: "application/zip", Name: "data.zip"}},
+			}},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{ToolCall: &types.CompletionToolCall{ID: "toolu_1", Function: types.CompletionFunctionCall{Name: "screenshot"}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Content("Took a screenshot\ndata:image/webp;base64,xxxx"), ToolCall: &types.CompletionToolCall{ID: "toolu_1"}},
+		},
+	})
+
+	require.Len(t, req.Messages, 3)
+	assert.Equal(t, []contentBlock{
+		{Type: "text", Text: "Summarize these"},
+		{Type: "image", Source: &mediaSource{Type: "url", URL: "https://example.com/chart.jpg"}},
+		{Type: "document", Source: &mediaSource{Type: "base64", MediaType: "application/pdf", Data: "yyyy"}},
+		{Type: "text", Text: "[The file data.zip (application/zip) is attached, but this model can't read it]"},
+	}, req.Messages[0].Content)
+	assert.Equal(t, []contentBlock{{
+		Type:      "tool_result",
+		ToolUseID: "toolu_1",
+		Content: []contentBlock{
+			{Type: "text", Text: "Took a screenshot"},
+			{Type: "image", Source: &mediaSource{Type: "base64", MediaType: "image/webp", Data: "xxxx"}},
+		},
+	}}, req.Messages[2].Content)
+}
+
+func TestToRequestThinking(t *testing.T) {
+	messages := []types.CompletionMessage{
+		{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Weather in Paris?")},
+		{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+			{Reasoning: &types.Reasoning{Text: "I should check.", Signature: "sig"}},
+			{Reasoning: &types.Reasoning{Redacted: "secret"}},
+			{Reasoning: &types.Reasoning{Text: "Thought of another model"}},
+			{ToolCall: &types.CompletionToolCall{ID: "toolu_1", Function: types.CompletionFunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}},
+		}},
+		{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("Sunny"), ToolCall: &types.CompletionToolCall{ID: "toolu_1"}},
+	}
+
+	req := toRequest(types.CompletionRequest{
+		Model:                "claude-sonnet-4-5",
+		InternalSystemPrompt: new(bool),
+		ReasoningEffort:      "10000",
+		Messages:             messages,
+	})
+
+	assert.Equal(t, &thinking{Type: "enabled", BudgetTokens: 10000}, req.Thinking)
+	assert.Equal(t, 10000+DefaultMaxTokens, req.MaxTokens)
+	assert.Nil(t, req.Temperature)
+	require.Len(t, req.Messages, 3)
+	assert.Equal(t, []contentBlock{
+		{Type: "thinking", Thinking: "I should check.", Signature: "sig"},
+		{Type: "redacted_thinking", Data: "secret"},
+		{Type: "tool_use", ID: "toolu_1", Name: "weather", Input: json.RawMessage(`{"city":"Paris"}`)},
+	}, req.Messages[1].Content)
+
+	// Without thinking the reasoning isn't sent back.
+	req = toRequest(types.CompletionRequest{
+		Model:    "claude-sonnet-4-5",
+		Messages: messages,
+	})
+	assert.Nil(t, req.Thinking)
+	assert.Equal(t, []contentBlock{
+		{Type: "tool_use", ID: "toolu_1", Name: "weather", Input: json.RawMessage(`{"city":"Paris"}`)},
+	}, req.Messages[1].Content)
+}
+
+func sendEvents(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		var typ struct {
+			Type string `json:"type"`
+		}
+		_ = json.Unmarshal([]byte(event), &typ)
+		_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", typ.Type, event)
+	}
+}
+
+func TestCall(t *testing.T) {
+	var received request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("X-Api-Key"))
+		assert.Equal(t, APIVersion, r.Header.Get("Anthropic-Version"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		sendEvents(w,
+			`{"type":"message_start","message":{"usage":{"input_tokens":20,"cache_read_input_tokens":5,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+			`{"type":"ping"}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Checking "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the weather."}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"weather","input":{}}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+			`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":" \"Paris\"}"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":12}}`,
+			`{"type":"message_stop"}`,
+		)
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	status := make(chan types.CompletionStatus, 100)
+	result, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-sonnet-4-5",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Weather in Paris?")}},
+	}, nil, status)
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-sonnet-4-5", received.Model)
+	assert.True(t, received.Stream)
+	require.Len(t, received.Messages, 1)
+
+	assert.Equal(t, types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+		Content: []types.ContentPart{
+			{Text: "Checking the weather."},
+			{ToolCall: &types.CompletionToolCall{
+				Index: ptr(1),
+				ID:    "toolu_1",
+				Function: types.CompletionFunctionCall{
+					Name:      "weather",
+					Arguments: `{"city": "Paris"}`,
+				},
+			}},
+		},
+		Usage: types.Usage{PromptTokens: 25, CompletionTokens: 12, TotalTokens: 37, CacheReadTokens: 5},
+	}, *result)
+
+	close(status)
+	var last types.CompletionStatus
+	for last = range status {
+	}
+	assert.Equal(t, result.Usage, last.Usage)
+}
+
+func TestCallThinking(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		sendEvents(w,
+			`{"type":"message_start","message":{"usage":{"input_tokens":10,"output_tokens":1}}}`,
+			`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Let me "}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"think."}}`,
+			`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+			`{"type":"content_block_stop","index":0}`,
+			`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"secret"}}`,
+			`{"type":"content_block_stop","index":1}`,
+			`{"type":"content_block_start","index":2,"content_block":{"type":"text","text":"Done."}}`,
+			`{"type":"content_block_stop","index":2}`,
+			`{"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":30}}`,
+			`{"type":"message_stop"}`,
+		)
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	result, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:           "claude-sonnet-4-5",
+		ReasoningEffort: types.ReasoningEffortHigh,
+		Messages:        []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")}},
+	}, nil, make(chan types.CompletionStatus, 100))
+	require.NoError(t, err)
+
+	assert.Equal(t, []types.ContentPart{
+		{Reasoning: &types.Reasoning{Text: "Let me think.", Signature: "sig"}},
+		{Reasoning: &types.Reasoning{Redacted: "secret"}},
+		{Text: "Done."},
+	}, result.Content)
+	assert.Equal(t, "Done.", result.String())
+}
+
+func TestCallError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	_, err = c.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-sonnet-4-5",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")}},
+	}, nil, make(chan types.CompletionStatus, 10))
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "rate_limit_error", apiErr.Type)
+	assert.True(t, strings.Contains(err.Error(), "Slow down"))
+}
+
+func TestListModels(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		_, _ = w.Write([]byte(`{"data":[{"id":"claude-sonnet-4-5","created_at":"2025-09-29T00:00:00Z"},{"id":"claude-haiku-4-5","created_at":"2025-10-01T00:00:00Z"}]}`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	models, err := c.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "claude-haiku-4-5", models[0].ID)
+	assert.Equal(t, "claude-sonnet-4-5", models[1].ID)
+
+	models, err = c.ListModels(context.Background(), "github.com/example/provider")
+	require.NoError(t, err)
+	assert.Empty(t, models)
+}
@@ -0,0 +1,211 @@
+// Package archive extracts and creates zip and tar archives, which can be compressed with gzip or xz.
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mholt/archives"
+)
+
+// Extract extracts the archive read from r into dir. The format of the archive is detected from its name and contents.
+// Entries that would end up outside of dir, through their name or symlinks, are rejected. The names of the extracted
+// entries are returned, with a trailing slash for directories.
+func Extract(ctx context.Context, name string, r io.Reader, dir string) ([]string, error) {
+	format, input, err := archives.Identify(ctx, name, r)
+	if err != nil {
+		return nil, err
+	}
+
+	ex, ok := format.(archives.Extractor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an archive that can be extracted", name)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var extracted []string
+	err = ex.Extract(ctx, input, func(_ context.Context, f archives.FileInfo) error {
+		entry := path.Clean(strings.TrimPrefix(f.NameInArchive, "./"))
+		if entry == "." {
+			return nil
+		}
+		if !filepath.IsLocal(filepath.FromSlash(entry)) {
+			return fmt.Errorf("refusing to extract %s outside of the target directory", f.NameInArchive)
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(entry))
+		if err := checkParent(root, target); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		if f.IsDir() {
+			extracted = append(extracted, entry+"/")
+			return os.MkdirAll(target, f.Mode())
+		}
+
+		// Never write through an existing symlink.
+		if info, err := os.Lstat(target); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		extracted = append(extracted, entry)
+		if f.LinkTarget != "" {
+			if filepath.IsAbs(f.LinkTarget) || !filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(entry)), f.LinkTarget)) {
+				return fmt.Errorf("refusing to extract %s, a link to %s outside of the target directory", f.NameInArchive, f.LinkTarget)
+			}
+			return os.Symlink(f.LinkTarget, target)
+		}
+		return extractFile(f, target)
+	})
+	if err != nil {
+		return extracted, err
+	}
+
+	return extracted, nil
+}
+
+// checkParent makes sure that the part of the parent directory of target that already exists is inside root, after
+// resolving symlinks.
+func checkParent(root, target string) error {
+	for dir := filepath.Dir(target); ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("refusing to extract %s through a symlink outside of the target directory", target)
+		}
+		return nil
+	}
+}
+
+func extractFile(f archives.FileInfo, target string) error {
+	targetFile, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+	defer targetFile.Close()
+
+	arc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer arc.Close()
+
+	if _, err := io.Copy(targetFile, arc); err != nil {
+		return err
+	}
+	if err := targetFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, f.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, time.Time{}, f.ModTime())
+}
+
+// Format returns the format of an archive from its file name: .zip, .tar, .tar.gz, .tgz, .tar.xz or .txz.
+func Format(name string) (archives.Archiver, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return archives.Zip{}, nil
+	case strings.HasSuffix(name, ".tar"):
+		return archives.Tar{}, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archives.CompressedArchive{Archival: archives.Tar{}, Compression: archives.Gz{}}, nil
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return archives.CompressedArchive{Archival: archives.Tar{}, Compression: archives.Xz{}}, nil
+	}
+	return nil, fmt.Errorf("unsupported archive format for %s, the name must end in .zip, .tar, .tar.gz, .tgz, .tar.xz or .txz", name)
+}
+
+// Create writes an archive to file with the given files and directories in dir, or everything in dir if no files are
+// given. Directories are added with all their contents. The names of the entries in the archive are returned, with a
+// trailing slash for directories.
+func Create(ctx context.Context, file, dir string, files []string) ([]string, error) {
+	format, err := Format(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			files = append(files, entry.Name())
+		}
+	}
+
+	names := make(map[string]string, len(files))
+	for _, f := range files {
+		if !filepath.IsLocal(filepath.FromSlash(f)) {
+			return nil, fmt.Errorf("%s is not inside of %s", f, dir)
+		}
+		names[filepath.Join(dir, filepath.FromSlash(f))] = path.Clean(filepath.ToSlash(f))
+	}
+
+	entries, err := archives.FilesFromDisk(ctx, nil, names)
+	if err != nil {
+		return nil, err
+	}
+
+	// The archive itself is skipped if it is written into the directory that is archived.
+	self, _ := filepath.Rel(dir, file)
+	self = filepath.ToSlash(self)
+
+	var (
+		result   []string
+		included = entries[:0]
+	)
+	for _, entry := range entries {
+		if entry.NameInArchive == self {
+			continue
+		}
+		included = append(included, entry)
+		if entry.IsDir() {
+			result = append(result, entry.NameInArchive+"/")
+		} else {
+			result = append(result, entry.NameInArchive)
+		}
+	}
+	sort.Strings(result)
+
+	out, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	if err := format.Archive(ctx, out, included); err != nil {
+		_ = out.Close()
+		_ = os.Remove(file)
+		return nil, err
+	}
+	return result, out.Close()
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndExtract(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0644))
+
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz", "out.tar.xz"} {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), name)
+			entries, err := Create(context.Background(), file, src, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"a.txt", "sub/", "sub/b.txt"}, entries)
+
+			f, err := os.Open(file)
+			require.NoError(t, err)
+			defer f.Close()
+
+			dst := t.TempDir()
+			extracted, err := Extract(context.Background(), name, f, dst)
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"a.txt", "sub/", "sub/b.txt"}, extracted)
+
+			data, err := os.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "b", string(data))
+		})
+	}
+}
+
+func TestCreateSelectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	// The archive is written into the directory it archives, without including itself.
+	entries, err := Create(context.Background(), filepath.Join(dir, "out.tgz"), dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.txt", "b.txt"}, entries)
+
+	entries, err = Create(context.Background(), filepath.Join(dir, "b.zip"), dir, []string{"b.txt"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b.txt"}, entries)
+
+	_, err = Create(context.Background(), filepath.Join(dir, "c.zip"), dir, []string{"../a.txt"})
+	require.Error(t, err)
+
+	_, err = Create(context.Background(), filepath.Join(dir, "c.rar"), dir, nil)
+	require.ErrorContains(t, err, "unsupported archive format")
+}
+
+func tarball(t *testing.T, headers ...*tar.Header) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		require.NoError(t, w.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := w.Write([]byte(h.Name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "dst")
+
+	_, err := Extract(context.Background(), "evil.tar", tarball(t,
+		&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	), dir)
+	require.ErrorContains(t, err, "refusing to extract ../evil.txt outside of the target directory")
+	require.NoFileExists(t, filepath.Join(parent, "evil.txt"))
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	_, err = Extract(context.Background(), "evil.tar", tarball(t,
+		&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "..", Mode: 0777},
+		&tar.Header{Name: "link/evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	), dir)
+	require.ErrorContains(t, err, "refusing to extract link, a link to .. outside of the target directory")
+	require.NoFileExists(t, filepath.Join(parent, "evil.txt"))
+
+	// A symlink inside the directory is fine, but not writing through one that points outside of it.
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, os.Symlink(parent, filepath.Join(dir, "outside")))
+	_, err = Extract(context.Background(), "evil.tar", tarball(t,
+		&tar.Header{Name: "inside", Typeflag: tar.TypeSymlink, Linkname: "sub", Mode: 0777},
+		&tar.Header{Name: "outside/evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+	), dir)
+	require.ErrorContains(t, err, "through a symlink outside of the target directory")
+	require.NoFileExists(t, filepath.Join(parent, "evil.txt"))
+}
@@ -46,22 +46,26 @@ func IsSafe(ctx engine.Context) bool {
 	return ok
 }
 
-func ConfirmMessage(ctx engine.Context, input string) string {
-	var (
-		loc         = ctx.Tool.Source.Location
-		interpreter = strings.Split(ctx.Tool.Instructions, "\n")[0][2:]
-	)
+func toolSource(ctx engine.Context) string {
+	if ctx.Tool.BuiltinFunc != nil {
+		return "Builtin"
+	}
 
 	if ctx.Tool.Source.Repo != nil {
-		loc = ctx.Tool.Source.Repo.Root
+		loc := ctx.Tool.Source.Repo.Root
 		loc = strings.TrimPrefix(loc, "https://")
 		loc = strings.TrimSuffix(loc, ".git")
-		loc = filepath.Join(loc, ctx.Tool.Source.Repo.Path, ctx.Tool.Source.Repo.Name)
+		return filepath.Join(loc, ctx.Tool.Source.Repo.Path, ctx.Tool.Source.Repo.Name)
 	}
 
-	if ctx.Tool.BuiltinFunc != nil {
-		loc = "Builtin"
-	}
+	return ctx.Tool.Source.Location
+}
+
+func ConfirmMessage(ctx engine.Context, input string) string {
+	var (
+		loc         = toolSource(ctx)
+		interpreter = strings.Split(ctx.Tool.Instructions, "\n")[0][2:]
+	)
 
 	return fmt.Sprintf(`Description: %s
   Interpreter: %s
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/builtin"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+type Decision string
+
+const (
+	Allow Decision = "allow"
+	Deny  Decision = "deny"
+	Ask   Decision = "ask"
+)
+
+// Policy decides which tools may run. The rules are checked in order and the first rule that matches a tool call
+// decides it. If no rule matches, Default is used, which is to ask.
+type Policy struct {
+	Default Decision `json:"default,omitempty"`
+	Rules   []Rule   `json:"rules,omitempty"`
+
+	// narrower is a policy that can only make the decisions of this policy stricter.
+	narrower *Policy
+}
+
+// Rule matches a tool call if all the patterns that are set match. Tool, Source, Command and URL are globs in which *
+// matches anything. Path is a glob in which * does not match a path separator and ** does. For a call with more than
+// one path, an allow rule matches if all of them match and a deny or ask rule matches if any of them match.
+type Rule struct {
+	Name     string   `json:"name,omitempty"`
+	Decision Decision `json:"decision"`
+	// Message is returned to the LLM when the call is denied.
+	Message string `json:"message,omitempty"`
+
+	// Tool matches the name of the tool.
+	Tool string `json:"tool,omitempty"`
+	// Source matches the location the tool was loaded from, or "Builtin" for the sys.* tools.
+	Source string `json:"source,omitempty"`
+	// Command matches the command run by sys.exec and sys.exec.start.
+	Command string `json:"command,omitempty"`
+	// Path matches the file or directory used by the file system tools, like sys.read and sys.write.
+	Path string `json:"path,omitempty"`
+	// URL matches the URL used by sys.http.* and sys.download.
+	URL string `json:"url,omitempty"`
+}
+
+// ReadPolicy reads a policy from a YAML or JSON file.
+func ReadPolicy(file string) (*Policy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization policy %s: %w", file, err)
+	}
+	policy, err := ParsePolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization policy %s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// ParsePolicy parses a policy from YAML or JSON.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, err
+	}
+
+	if err := policy.Default.validate(); err != nil {
+		return nil, err
+	}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			// Unnamed rules are logged by their position in the file.
+			rule.Name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.Decision == "" {
+			return nil, fmt.Errorf("rule %s has no decision", rule.Name)
+		}
+		if err := rule.Decision.validate(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return &policy, nil
+}
+
+func (d Decision) validate() error {
+	switch d {
+	case "", Allow, Deny, Ask:
+		return nil
+	default:
+		return fmt.Errorf("invalid decision %q, must be one of allow, deny or ask", d)
+	}
+}
+
+// toolCall is what the rules of a policy are matched against.
+type toolCall struct {
+	tool, source, command, url string
+	paths                      []string
+}
+
+func newToolCall(ctx engine.Context, input string) toolCall {
+	call := toolCall{
+		tool:   ctx.Tool.Name,
+		source: toolSource(ctx),
+	}
+
+	if ctx.Tool.BuiltinFunc == nil {
+		return call
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return call
+	}
+
+	call.command, _ = args["command"].(string)
+	call.url, _ = args["url"].(string)
+	for _, key := range []string{"filename", "filepath", "location", "dir", "directory", "archive", "file", "output_file", "database"} {
+		if p, ok := args[key].(string); ok && p != "" {
+			call.paths = append(call.paths, p)
+		}
+	}
+	if patch, ok := args["patch"].(string); ok && call.tool == "sys.patch" {
+		dir, _ := args["directory"].(string)
+		// A patch that can't be parsed is not applied, so it has no paths to check.
+		paths, _ := builtin.PatchPaths(patch, types.FirstSet(dir, "."))
+		call.paths = append(call.paths, paths...)
+	}
+	if tables, ok := args["tables"].(string); ok && strings.HasPrefix(call.tool, "sys.sql.") {
+		// The tables of sys.sql.* are a JSON object of table names to the files they are loaded from.
+		var files map[string]string
+		_ = json.Unmarshal([]byte(tables), &files)
+		for _, file := range files {
+			call.paths = append(call.paths, file)
+		}
+	}
+
+	return call
+}
+
+func (r Rule) matches(call toolCall) bool {
+	if r.Tool != "" && !globMatch(r.Tool, call.tool, false) {
+		return false
+	}
+	if r.Source != "" && !globMatch(r.Source, call.source, false) {
+		return false
+	}
+	if r.Command != "" && (call.command == "" || !globMatch(r.Command, call.command, false)) {
+		return false
+	}
+	if r.URL != "" && (call.url == "" || !globMatch(r.URL, call.url, false)) {
+		return false
+	}
+	if r.Path != "" && !r.pathsMatch(call.paths) {
+		return false
+	}
+	return true
+}
+
+// pathsMatch matches Path against the paths of a call. An allow rule only matches if every path matches, so that a call
+// can not reach outside of what is allowed with a second path. Deny and ask rules match if any path matches, so that a
+// second path can not get around them.
+func (r Rule) pathsMatch(paths []string) bool {
+	if len(paths) == 0 {
+		return false
+	}
+	if r.Decision == Allow {
+		return !slices.ContainsFunc(paths, func(p string) bool {
+			return !pathMatch(r.Path, p)
+		})
+	}
+	return slices.ContainsFunc(paths, func(p string) bool {
+		return pathMatch(r.Path, p)
+	})
+}
+
+// pathMatch matches relative patterns against the path as it was given, and absolute patterns against the absolute
+// path, so that "../" can not be used to get around a rule.
+func pathMatch(pattern, p string) bool {
+	if filepath.IsAbs(pattern) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return false
+		}
+		p = abs
+	} else {
+		p = filepath.Clean(p)
+	}
+	return globMatch(filepath.Clean(pattern), p, true)
+}
+
+func globMatch(pattern, s string, path bool) bool {
+	var (
+		expr  strings.Builder
+		runes = []rune(pattern)
+	)
+	expr.WriteString("^")
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '*' && i+1 < len(runes) && runes[i+1] == '*':
+			expr.WriteString(".*")
+			i++
+		case c == '*' && path:
+			expr.WriteString("[^/]*")
+		case c == '*':
+			expr.WriteString(".*")
+		case c == '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false
+	}
+	if path {
+		s = filepath.ToSlash(s)
+	}
+	return re.MatchString(s)
+}
+
+// strictness orders the decisions from the most to the least permissive.
+var strictness = map[Decision]int{
+	Allow: 0,
+	Ask:   1,
+	Deny:  2,
+}
+
+// Narrow returns a policy that decides every tool call with both p and narrower, and takes the stricter decision. A
+// deny of either policy denies the call, so narrower can only take away what p allows. Calls that no rule of narrower
+// matches are left to p, unless narrower has a default.
+func (p *Policy) Narrow(narrower *Policy) *Policy {
+	result := *p
+	result.narrower = narrower
+	return &result
+}
+
+// Decide returns the decision for a tool call and the rule that made it, which is nil if no rule matched.
+func (p *Policy) Decide(ctx engine.Context, input string) (Decision, *Rule) {
+	decision, rule := p.decide(newToolCall(ctx, input))
+	if p.narrower == nil {
+		return decision, rule
+	}
+
+	narrowed, narrowedRule := p.narrower.Decide(ctx, input)
+	if narrowedRule == nil && p.narrower.Default == "" {
+		return decision, rule
+	}
+	if strictness[narrowed] > strictness[decision] {
+		return narrowed, narrowedRule
+	}
+	return decision, rule
+}
+
+func (p *Policy) decide(call toolCall) (Decision, *Rule) {
+	for i := range p.Rules {
+		if p.Rules[i].matches(call) {
+			return p.Rules[i].Decision, &p.Rules[i]
+		}
+	}
+	if p.Default == "" {
+		return Ask, nil
+	}
+	return p.Default, nil
+}
+
+// NewPolicyAuthorizer returns a runner.AuthorizerFunc that authorizes tool calls with a policy. Calls the policy
+// decides to ask about are passed to ask, or denied if ask is nil.
+func NewPolicyAuthorizer(policy *Policy, ask runner.AuthorizerFunc) runner.AuthorizerFunc {
+	return func(ctx engine.Context, input string) (runner.AuthorizerResponse, error) {
+		decision, rule := policy.Decide(ctx, input)
+
+		ruleName := "default"
+		if rule != nil {
+			ruleName = rule.Name
+		}
+		log.Infof("authorization policy: %s tool %s (%s) by rule %s", decision, ctx.Tool.Name, toolSource(ctx), ruleName)
+
+		switch decision {
+		case Allow:
+			return runner.AuthorizerResponse{
+				Accept: true,
+			}, nil
+		case Ask:
+			if ask != nil {
+				return ask(ctx, input)
+			}
+		}
+
+		msg := fmt.Sprintf("Tool call request has been denied by the authorization policy (rule %s)", ruleName)
+		if rule != nil && rule.Message != "" {
+			msg = rule.Message
+		}
+		return runner.AuthorizerResponse{
+			Message: msg,
+		}, nil
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testPolicy = `
+default: deny
+rules:
+- name: no-rm
+  decision: deny
+  command: "rm *"
+  message: Deleting files is not allowed
+- decision: allow
+  tool: sys.exec
+- decision: deny
+  path: "/etc/**"
+- decision: allow
+  tool: sys.read
+  path: "docs/**"
+- decision: ask
+  tool: sys.write
+  path: "*.txt"
+- decision: allow
+  url: "https://example.com/*"
+- decision: allow
+  source: github.com/gptscript-ai/*
+`
+
+func toolContext(name, location string, builtin bool) engine.Context {
+	tool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name: name,
+			},
+			Instructions: "#!/bin/sh",
+		},
+		Source: types.ToolSource{
+			Location: location,
+		},
+	}
+	if builtin {
+		tool.Instructions = "#!" + name
+		tool.BuiltinFunc = func(context.Context, []string, string, chan<- string) (string, error) {
+			return "", nil
+		}
+	}
+	ctx := engine.Context{
+		Ctx: context.Background(),
+	}
+	ctx.Tool = tool
+	return ctx
+}
+
+func TestPolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		ctx      engine.Context
+		input    string
+		decision Decision
+		rule     string
+	}{
+		{"command denied", toolContext("sys.exec", "", true), `{"command": "rm -rf /"}`, Deny, "no-rm"},
+		{"command allowed", toolContext("sys.exec", "", true), `{"command": "ls"}`, Allow, "#2"},
+		{"path allowed", toolContext("sys.read", "", true), `{"filename": "docs/a/b.md"}`, Allow, "#4"},
+		{"path outside of glob", toolContext("sys.read", "", true), `{"filename": "docs/../secret"}`, Deny, ""},
+		{"path ask", toolContext("sys.write", "", true), `{"filename": "notes.txt"}`, Ask, "#5"},
+		{"path star does not match separator", toolContext("sys.write", "", true), `{"filename": "a/notes.txt"}`, Deny, ""},
+		{"any path denied", toolContext("sys.archive.create", "", true), `{"archive": "/etc/x.tar", "directory": "/tmp/ok"}`, Deny, "#3"},
+		{"all paths must be allowed", toolContext("sys.read", "", true), `{"filename": "docs/a.md", "file": "secret"}`, Deny, ""},
+		{"patch path denied", toolContext("sys.patch", "", true), `{"patch": "--- /dev/null\n+++ b/etc/passwd\n@@ -0,0 +1 @@\n+x\n", "directory": "/"}`, Deny, "#3"},
+		{"output file denied", toolContext("sys.http.request", "", true), `{"url": "https://example.com/a", "output_file": "/etc/x"}`, Deny, "#3"},
+		{"database denied", toolContext("sys.sql.exec", "", true), `{"database": "/etc/x.db", "query": "select 1"}`, Deny, "#3"},
+		{"table file denied", toolContext("sys.sql.query", "", true), `{"tables": "{\"a\": \"docs/a.csv\", \"b\": \"/etc/b.csv\"}", "query": "select 1"}`, Deny, "#3"},
+		{"url allowed", toolContext("sys.http.get", "", true), `{"url": "https://example.com/a/b"}`, Allow, "#6"},
+		{"url denied", toolContext("sys.http.get", "", true), `{"url": "https://example.org"}`, Deny, ""},
+		{"source allowed", toolContext("tool", "github.com/gptscript-ai/search", false), "", Allow, "#7"},
+		{"source denied", toolContext("tool", "github.com/someone/search", false), "", Deny, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, rule := policy.Decide(test.ctx, test.input)
+			require.Equal(t, test.decision, decision)
+			if test.rule == "" {
+				require.Nil(t, rule)
+			} else {
+				require.Equal(t, test.rule, rule.Name)
+			}
+		})
+	}
+}
+
+func TestPolicyAuthorizer(t *testing.T) {
+	policy, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	var asked bool
+	authorizer := NewPolicyAuthorizer(policy, func(engine.Context, string) (runner.AuthorizerResponse, error) {
+		asked = true
+		return runner.AuthorizerResponse{Accept: true}, nil
+	})
+
+	resp, err := authorizer(toolContext("sys.exec", "", true), `{"command": "rm -rf /"}`)
+	require.NoError(t, err)
+	require.False(t, resp.Accept)
+	require.Equal(t, "Deleting files is not allowed", resp.Message)
+	require.False(t, asked)
+
+	resp, err = authorizer(toolContext("sys.write", "", true), `{"filename": "notes.txt"}`)
+	require.NoError(t, err)
+	require.True(t, resp.Accept)
+	require.True(t, asked)
+
+	// Without a way to ask, calls that would be asked about are denied.
+	resp, err = NewPolicyAuthorizer(policy, nil)(toolContext("sys.write", "", true), `{"filename": "notes.txt"}`)
+	require.NoError(t, err)
+	require.False(t, resp.Accept)
+}
+
+func TestPolicyNarrow(t *testing.T) {
+	server, err := ParsePolicy([]byte(testPolicy))
+	require.NoError(t, err)
+
+	// A policy that tries to allow everything can't allow what the server denies.
+	allowAll, err := ParsePolicy([]byte("default: allow\nrules:\n- decision: allow\n  tool: '*'\n"))
+	require.NoError(t, err)
+	policy := server.Narrow(allowAll)
+
+	decision, rule := policy.Decide(toolContext("sys.exec", "", true), `{"command": "rm -rf /"}`)
+	require.Equal(t, Deny, decision)
+	require.Equal(t, "no-rm", rule.Name)
+	decision, _ = policy.Decide(toolContext("sys.write", "", true), `{"filename": "notes.txt"}`)
+	require.Equal(t, Ask, decision)
+	decision, _ = policy.Decide(toolContext("sys.http.get", "", true), `{"url": "https://example.org"}`)
+	require.Equal(t, Deny, decision)
+
+	// A narrower policy can deny what the server allows, and leaves the calls it has no rule for to the server.
+	denyLs, err := ParsePolicy([]byte("rules:\n- name: no-ls\n  decision: deny\n  command: ls*\n"))
+	require.NoError(t, err)
+	policy = server.Narrow(denyLs)
+
+	decision, rule = policy.Decide(toolContext("sys.exec", "", true), `{"command": "ls"}`)
+	require.Equal(t, Deny, decision)
+	require.Equal(t, "no-ls", rule.Name)
+	decision, _ = policy.Decide(toolContext("sys.read", "", true), `{"filename": "docs/a/b.md"}`)
+	require.Equal(t, Allow, decision)
+
+	// The server policy itself is not changed.
+	decision, _ = server.Decide(toolContext("sys.exec", "", true), `{"command": "ls"}`)
+	require.Equal(t, Allow, decision)
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	_, err := ParsePolicy([]byte("rules:\n- tool: sys.exec\n"))
+	require.ErrorContains(t, err, "rule #1 has no decision")
+
+	_, err = ParsePolicy([]byte("rules:\n- decision: maybe\n"))
+	require.ErrorContains(t, err, `invalid decision "maybe"`)
+
+	_, err = ParsePolicy([]byte("rules:\n- decision: allow\n  tools: sys.exec\n"))
+	require.Error(t, err)
+}
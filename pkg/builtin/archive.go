@@ -0,0 +1,96 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/archive"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// maxListedFiles is how many names of files in an archive are listed in the result of the archive tools.
+const maxListedFiles = 200
+
+func listFiles(files []string) string {
+	var out strings.Builder
+	for i, file := range files {
+		if i == maxListedFiles {
+			out.WriteString(fmt.Sprintf("... and %d more\n", len(files)-maxListedFiles))
+			break
+		}
+		out.WriteString(file + "\n")
+	}
+	return out.String()
+}
+
+func SysArchiveExtract(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Archive   string `json:"archive,omitempty"`
+		Directory string `json:"directory,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	f, err := os.Open(params.Archive)
+	if err != nil {
+		return fmt.Sprintf("Failed to open %s: %v", params.Archive, err), nil
+	}
+	defer f.Close()
+
+	log.Debugf("Extracting %s to %s", params.Archive, params.Directory)
+	files, err := archive.Extract(ctx, filepath.Base(params.Archive), f, params.Directory)
+	if err != nil {
+		if len(files) > 0 {
+			return fmt.Sprintf("Failed to extract %s to %s: %v\nThese files were extracted before the failure:\n%s", params.Archive, params.Directory, err, listFiles(files)), nil
+		}
+		return fmt.Sprintf("Failed to extract %s to %s: %v", params.Archive, params.Directory, err), nil
+	}
+
+	return fmt.Sprintf("Extracted %d files from %s to %s:\n%s", len(files), params.Archive, params.Directory, listFiles(files)), nil
+}
+
+func SysArchiveCreate(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Archive   string `json:"archive,omitempty"`
+		Directory string `json:"directory,omitempty"`
+		Files     string `json:"files,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	// The files can be a JSON list or separated by commas.
+	var files []string
+	if strings.HasPrefix(strings.TrimSpace(params.Files), "[") {
+		if err := json.Unmarshal([]byte(params.Files), &files); err != nil {
+			return types.InvalidArgument(input, fmt.Errorf("files must be a JSON list of strings: %w", err)), nil
+		}
+	} else if params.Files != "" {
+		for _, file := range strings.Split(params.Files, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+	}
+
+	log.Debugf("Creating %s from %s", params.Archive, params.Directory)
+	entries, err := archive.Create(ctx, params.Archive, params.Directory, files)
+	if err != nil {
+		return fmt.Sprintf("Failed to create %s: %v", params.Archive, err), nil
+	}
+
+	return fmt.Sprintf("Created %s with %d files:\n%s", params.Archive, len(entries), listFiles(entries)), nil
+}
@@ -20,11 +20,17 @@ import (
 
 	"github.com/BurntSushi/locker"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/memory"
 	"github.com/gptscript-ai/gptscript/pkg/prompt"
+	"github.com/gptscript-ai/gptscript/pkg/search"
+	"github.com/gptscript-ai/gptscript/pkg/sqlite"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/jaytaylor/html2text"
 )
 
+// maxAttachmentSize is the largest image or PDF that sys.read attaches for the LLM.
+const maxAttachmentSize = 20 << 20
+
 var SafeTools = map[string]struct{}{
 	"sys.abort":                     {},
 	"sys.chat.finish":               {},
@@ -35,6 +41,8 @@ var SafeTools = map[string]struct{}{
 	"sys.time.now":                  {},
 	"sys.context":                   {},
 	"sys.model.provider.credential": {},
+	"sys.memory.get":                {},
+	"sys.memory.search":             {},
 }
 
 var tools = map[string]types.Tool{
@@ -59,7 +67,7 @@ var tools = map[string]types.Tool{
 	"sys.read": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
-				Description: "Reads the contents of a file. Can only read plain text files, not binary files",
+				Description: "Reads the contents of a file. Can read plain text files, images and PDFs, but no other binary files",
 				Arguments: types.ObjectSchema(
 					"filename", "The name of the file to read"),
 			},
@@ -88,6 +96,32 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysAppend,
 		},
 	},
+	"sys.edit": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Edits a file by replacing text in it. The text to replace must match the file exactly, including whitespace, and must be unique in the file unless replace_all is true",
+				Arguments: types.ObjectSchema(
+					"filename", "The name of the file to edit",
+					"old_string", "The text to replace",
+					"new_string", "The text to replace it with",
+					"replace_all", "(optional) (true or false) Whether to replace every occurrence of old_string",
+				),
+			},
+			BuiltinFunc: SysEdit,
+		},
+	},
+	"sys.patch": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Applies a patch in unified diff format to one or more files. Either all the changes are applied, or none of them are",
+				Arguments: types.ObjectSchema(
+					"patch", "The patch to apply, in unified diff format with --- and +++ file headers and @@ hunk headers",
+					"directory", "(optional) The directory the paths in the patch are relative to, the current directory by default",
+				),
+			},
+			BuiltinFunc: SysPatch,
+		},
+	},
 	"sys.http.get": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
@@ -142,6 +176,27 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysHTTPPost,
 		},
 	},
+	"sys.http.request": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Send a http or https request with any method, headers and body, and get the status, headers and body of the response. Credentials for the host are added from the environment",
+				Arguments: types.ObjectSchema(
+					"url", "The URL to send the request to",
+					"method", "(optional) The HTTP method, like GET, POST, PUT, PATCH or DELETE, GET by default",
+					"headers", "(optional) A JSON object of request headers",
+					"query", "(optional) A JSON object of query parameters to add to the URL",
+					"body", "(optional) The request body as text",
+					"json", "(optional) A JSON request body, sent with the application/json content type",
+					"form", "(optional) A JSON object of form fields, sent URL encoded",
+					"timeout", "(optional) The maximum number of seconds to wait for the response, 30 by default",
+					"include_headers", "(optional) Set to true to include the response headers in the result",
+					"max_bytes", "(optional) The maximum number of bytes of the response body to return, 1048576 by default",
+					"output_file", "(optional) A file to save the response body to instead of returning it. Binary responses are always saved to a file",
+				),
+			},
+			BuiltinFunc: SysHTTPRequest,
+		},
+	},
 	"sys.find": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
@@ -154,6 +209,75 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysFind,
 		},
 	},
+	"sys.grep": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Searches the contents of the files in a directory for lines that match a regular expression",
+				Arguments: types.ObjectSchema(
+					"pattern", "The regular expression to search for",
+					"directory", "(optional) The directory to search in, the current directory by default",
+					"include", "(optional) Only search files whose name or path matches this glob, like *.go",
+					"context", "(optional) The number of lines to show before and after each match",
+					"max_results", "(optional) The maximum number of matching lines to return, 100 by default",
+					"ignore_case", "(optional) (true or false) Whether to ignore case when matching",
+				),
+			},
+			BuiltinFunc: search.SysGrep,
+		},
+	},
+	"sys.search": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Finds the files in a directory that are most relevant to a query, ranked by a full-text search",
+				Arguments: types.ObjectSchema(
+					"query", "The words to search for",
+					"directory", "(optional) The directory to search in, the current directory by default",
+					"limit", "(optional) The maximum number of files to return, 10 by default",
+				),
+			},
+			BuiltinFunc: search.SysSearch,
+		},
+	},
+	"sys.json.query": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Select values from a JSON document with a gjson path, like items.#.name for the name of every item. Returns only the selected JSON",
+				Arguments: types.ObjectSchema(
+					"path", "The gjson path of the values to select, like name.first, items.0, items.#.name, items.#(size>10)#.name or {name,size}",
+					"json", "(optional) The JSON document to query",
+					"file", "(optional) A file with the JSON document to query, instead of json"),
+			},
+			BuiltinFunc: SysJSONQuery,
+		},
+	},
+	"sys.sql.query": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Runs a SQL query against a SQLite database, or against CSV, TSV and JSONL files loaded as tables. Nothing can be changed by the query",
+				Arguments: types.ObjectSchema(
+					"query", "The SQLite query to run",
+					"database", "(optional) The SQLite database file to query",
+					"tables", `(optional) A JSON object of table names to CSV, TSV or JSONL files to load as tables, like {"sales": "sales.csv"}`,
+					"format", "(optional) The format of the result, markdown (the default) or json",
+					"limit", "(optional) The maximum number of rows to return, 100 by default",
+				),
+			},
+			BuiltinFunc: sqlite.SysSQLQuery,
+		},
+	},
+	"sys.sql.exec": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Runs SQL statements that change a SQLite database, like CREATE TABLE, INSERT or UPDATE. The database is created if it does not exist",
+				Arguments: types.ObjectSchema(
+					"statements", "The SQLite statements to run",
+					"database", "The SQLite database file to change",
+					"tables", `(optional) A JSON object of table names to CSV, TSV or JSONL files to load as temporary tables, like {"sales": "sales.csv"}`,
+				),
+			},
+			BuiltinFunc: sqlite.SysSQLExec,
+		},
+	},
 	"sys.exec": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
@@ -166,6 +290,60 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysExec,
 		},
 	},
+	"sys.exec.start": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Start a command in the background and return the ID of the process, for commands that keep running like servers. The process is stopped when the run finishes",
+				Arguments: types.ObjectSchema(
+					"command", "The command to run including all applicable arguments",
+					"directory", "The directory to use as the current working directory of the command. The current directory \".\" will be used if no argument is passed",
+				),
+			},
+			BuiltinFunc: SysExecStart,
+		},
+	},
+	"sys.exec.status": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Get whether a process started with sys.exec.start is still running, or its exit code",
+				Arguments: types.ObjectSchema(
+					"id", "(optional) The ID of the process, all processes are listed if not set"),
+			},
+			BuiltinFunc: SysExecStatus,
+		},
+	},
+	"sys.exec.output": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Get the output a process started with sys.exec.start wrote since the last time its output was read",
+				Arguments: types.ObjectSchema(
+					"id", "The ID of the process"),
+			},
+			BuiltinFunc: SysExecOutput,
+		},
+	},
+	"sys.exec.signal": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Send a signal to a process started with sys.exec.start, to stop it",
+				Arguments: types.ObjectSchema(
+					"id", "The ID of the process",
+					"signal", "(optional) One of SIGTERM, SIGINT, SIGKILL, SIGHUP or SIGQUIT, SIGTERM by default"),
+			},
+			BuiltinFunc: SysExecSignal,
+		},
+	},
+	"sys.exec.wait": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Wait for a process started with sys.exec.start to exit, and get its exit code and new output",
+				Arguments: types.ObjectSchema(
+					"id", "The ID of the process",
+					"timeout", "(optional) The maximum number of seconds to wait, 60 by default"),
+			},
+			BuiltinFunc: SysExecWait,
+		},
+	},
 	"sys.getenv": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
@@ -188,6 +366,29 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysDownload,
 		},
 	},
+	"sys.archive.extract": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Extract a zip, tar, tar.gz or tar.xz archive and list the extracted files",
+				Arguments: types.ObjectSchema(
+					"archive", "The archive file to extract",
+					"directory", "(optional) The directory to extract the files to, the current directory by default"),
+			},
+			BuiltinFunc: SysArchiveExtract,
+		},
+	},
+	"sys.archive.create": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Create a zip, tar, tar.gz or tar.xz archive of files in a directory and list the files in it. The format is chosen by the extension of the archive name",
+				Arguments: types.ObjectSchema(
+					"archive", "The archive file to create, ending in .zip, .tar, .tar.gz, .tgz, .tar.xz or .txz",
+					"directory", "(optional) The directory with the files to archive, the current directory by default",
+					"files", "(optional) A JSON list of the files and directories in the directory to archive, everything in the directory by default"),
+			},
+			BuiltinFunc: SysArchiveCreate,
+		},
+	},
 	"sys.remove": {
 		ToolDef: types.ToolDef{
 			Parameters: types.Parameters{
@@ -215,7 +416,7 @@ var tools = map[string]types.Tool{
 				Description: "Prompts the user for input",
 				Arguments: types.ObjectSchema(
 					"message", "The message to display to the user",
-					"fields", "A comma-separated list of fields to prompt for",
+					"fields", "A comma-separated list of fields to prompt for, or a JSON list of field objects with name, description, type (string, multiline, number, boolean, date, file or secret), options, required, pattern, min, max and default",
 					"sensitive", "(true or false) Whether the input should be hidden",
 					"metadata", "(optional) A JSON object of metadata to attach to the prompt",
 				),
@@ -259,6 +460,53 @@ var tools = map[string]types.Tool{
 			BuiltinFunc: SysModelProviderCredential,
 		},
 	},
+	"sys.memory.put": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Saves a memory that can be recalled in later runs, replacing any memory with the same key",
+				Arguments: types.ObjectSchema(
+					"key", "A short unique name for the memory",
+					"value", "The content to remember",
+					"tags", "(optional) A comma-separated list of tags to find the memory by",
+				),
+			},
+			BuiltinFunc: memory.SysMemoryPut,
+		},
+	},
+	"sys.memory.get": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Gets the memory saved with a key",
+				Arguments: types.ObjectSchema(
+					"key", "The key of the memory",
+				),
+			},
+			BuiltinFunc: memory.SysMemoryGet,
+		},
+	},
+	"sys.memory.search": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Searches the saved memories for the ones that best match a query",
+				Arguments: types.ObjectSchema(
+					"query", "The words to search for. If empty, the most recent memories are returned",
+					"limit", "(optional) The maximum number of memories to return, 10 by default",
+				),
+			},
+			BuiltinFunc: memory.SysMemorySearch,
+		},
+	},
+	"sys.memory.delete": {
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: "Deletes the memory saved with a key",
+				Arguments: types.ObjectSchema(
+					"key", "The key of the memory",
+				),
+			},
+			BuiltinFunc: memory.SysMemoryDelete,
+		},
+	},
 }
 
 func ListTools() (result []types.Tool) {
@@ -294,7 +542,7 @@ func SysFind(_ context.Context, _ []string, input string, _ chan<- string) (stri
 		Directory string `json:"directory,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	if params.Directory == "" {
@@ -334,7 +582,7 @@ func SysExec(ctx context.Context, env []string, input string, progress chan<- st
 		Directory string `json:"directory,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	if params.Directory == "" {
@@ -440,7 +688,7 @@ func SysLs(_ context.Context, _ []string, input string, _ chan<- string) (string
 		Dir string `json:"dir,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	dir := params.Dir
@@ -476,7 +724,7 @@ func SysRead(_ context.Context, _ []string, input string, _ chan<- string) (stri
 		Filename string `json:"filename,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	file := params.Filename
@@ -497,6 +745,14 @@ func SysRead(_ context.Context, _ []string, input string, _ chan<- string) (stri
 		return fmt.Sprintf("The file %s has no contents", params.Filename), nil
 	}
 
+	// Images and PDFs are attached for the LLM to look at
+	if mimeType := types.MimeType(file, data); types.IsAttachable(mimeType) {
+		if len(data) > maxAttachmentSize {
+			return fmt.Sprintf("The file %s is too large to read, it is larger than %d MB", params.Filename, maxAttachmentSize>>20), nil
+		}
+		return fmt.Sprintf("The file %s is attached\n%s", params.Filename, types.DataURL(mimeType, filepath.Base(file), data)), nil
+	}
+
 	// Assume the file is not text if it contains a null byte
 	if bytes.IndexByte(data, 0) != -1 {
 		return fmt.Sprintf("The file %s cannot be read because it is not a plaintext file", params.Filename), nil
@@ -511,7 +767,7 @@ func SysWrite(_ context.Context, _ []string, input string, _ chan<- string) (str
 		Content  string `json:"content,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	file := params.Filename
@@ -543,7 +799,7 @@ func SysAppend(_ context.Context, _ []string, input string, _ chan<- string) (st
 		Content  string `json:"content,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	// Lock the file to prevent concurrent writes from other tool calls.
@@ -588,7 +844,7 @@ func SysHTTPGet(_ context.Context, _ []string, input string, _ chan<- string) (_
 		URL string `json:"url,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	params.URL = fixQueries(params.URL)
@@ -634,7 +890,7 @@ func SysHTTPPost(ctx context.Context, _ []string, input string, _ chan<- string)
 		ContentType string `json:"contentType,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	params.URL = fixQueries(params.URL)
@@ -680,7 +936,7 @@ func SysGetenv(_ context.Context, env []string, input string, _ chan<- string) (
 		Name string `json:"name,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	log.Debugf("looking up env var %s", params.Name)
@@ -699,10 +955,6 @@ func SysGetenv(_ context.Context, env []string, input string, _ chan<- string) (
 	return value, nil
 }
 
-func invalidArgument(input string, err error) string {
-	return fmt.Sprintf("Failed to parse arguments %s: %v", input, err)
-}
-
 func SysModelProviderCredential(ctx context.Context, env []string, _ string, _ chan<- string) (string, error) {
 	engineContext, _ := engine.FromContext(ctx)
 	auth, url, err := engineContext.Engine.Model.ProxyInfo(env)
@@ -730,7 +982,7 @@ func SysContext(ctx context.Context, _ []string, _ string, _ chan<- string) (str
 		"call":    callContext,
 	})
 	if err != nil {
-		return invalidArgument("", err), nil
+		return types.InvalidArgument("", err), nil
 	}
 
 	return string(data), nil
@@ -743,7 +995,7 @@ func SysChatHistory(ctx context.Context, _ []string, _ string, _ chan<- string)
 		History: writeHistory(engineContext),
 	})
 	if err != nil {
-		return invalidArgument("", err), nil
+		return types.InvalidArgument("", err), nil
 	}
 
 	return string(data), nil
@@ -782,7 +1034,7 @@ func SysChatCurrent(ctx context.Context, _ []string, _ string, _ chan<- string)
 
 	data, err := json.Marshal(call)
 	if err != nil {
-		return invalidArgument("", err), nil
+		return types.InvalidArgument("", err), nil
 	}
 
 	return string(data), nil
@@ -817,7 +1069,7 @@ func SysRemove(_ context.Context, _ []string, input string, _ chan<- string) (st
 		Location string `json:"location,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	// Lock the file to prevent concurrent writes from other tool calls.
@@ -836,7 +1088,7 @@ func SysStat(_ context.Context, _ []string, input string, _ chan<- string) (stri
 		Filepath string `json:"filepath,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	stat, err := os.Stat(params.Filepath)
@@ -858,7 +1110,7 @@ func SysDownload(_ context.Context, env []string, input string, _ chan<- string)
 		Override string `json:"override,omitempty"`
 	}
 	if err := json.Unmarshal([]byte(input), &params); err != nil {
-		return invalidArgument(input, err), nil
+		return types.InvalidArgument(input, err), nil
 	}
 
 	params.URL = fixQueries(params.URL)
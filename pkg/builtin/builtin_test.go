@@ -2,6 +2,8 @@ package builtin
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -25,6 +27,23 @@ func TestSysGetenv(t *testing.T) {
 	autogold.Expect("MAGIC2 is not set or has no value").Equal(t, v)
 }
 
+func TestSysReadAttachment(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "chart.png")
+	require.NoError(t, os.WriteFile(file, []byte("hi"), 0644))
+
+	v, err := SysRead(context.Background(), nil, `{"filename":"`+file+`"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "The file "+file+" is attached\ndata:image/png;name=chart.png;base64,aGk=", v)
+
+	file = filepath.Join(dir, "data.bin")
+	require.NoError(t, os.WriteFile(file, []byte{1, 0, 2}, 0644))
+
+	v, err = SysRead(context.Background(), nil, `{"filename":"`+file+`"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "The file "+file+" cannot be read because it is not a plaintext file", v)
+}
+
 func TestDisplayCoverage(t *testing.T) {
 	for _, tool := range ListTools() {
 		_, err := types.ToSysDisplayString(tool.ID, nil)
@@ -0,0 +1,634 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/locker"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// maxFuzz is the number of context lines at the start and end of a hunk that may be ignored to apply it, like the
+// default fuzz factor of GNU patch.
+const maxFuzz = 2
+
+func SysEdit(_ context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Filename   string `json:"filename,omitempty"`
+		OldString  string `json:"old_string,omitempty"`
+		NewString  string `json:"new_string,omitempty"`
+		ReplaceAll string `json:"replace_all,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	file := params.Filename
+	if params.OldString == "" {
+		return "old_string must not be empty, use sys.write to create a file", nil
+	}
+	if params.OldString == params.NewString {
+		return "old_string and new_string are the same, nothing to change", nil
+	}
+
+	// Lock the file to prevent concurrent writes from other tool calls.
+	locker.Lock(file)
+	defer locker.Unlock(file)
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("The file %s does not exist", file), nil
+	} else if err != nil {
+		return fmt.Sprintf("Failed to read file %s: %v", file, err), nil
+	}
+
+	content := string(data)
+	count := strings.Count(content, params.OldString)
+	switch {
+	case count == 0:
+		return editNotFound(file, content, params.OldString), nil
+	case count > 1 && params.ReplaceAll != "true":
+		return fmt.Sprintf("old_string was found %d times in %s at lines %s. Include more of the surrounding text to make it unique, or set replace_all to true to replace every occurrence",
+			count, file, joinInts(occurrenceLines(content, params.OldString))), nil
+	}
+
+	content = strings.ReplaceAll(content, params.OldString, params.NewString)
+	if err := os.WriteFile(file, []byte(content), fileMode(file)); err != nil {
+		return fmt.Sprintf("Failed to write file %s: %v", file, err), nil
+	}
+
+	log.Debugf("Replaced %d occurrences in file %s", count, file)
+	if count == 1 {
+		return fmt.Sprintf("Replaced 1 occurrence in %s", file), nil
+	}
+	return fmt.Sprintf("Replaced %d occurrences in %s", count, file), nil
+}
+
+// editNotFound explains why old_string was not found. The most common reason is that the whitespace is different, so
+// the lines that match if whitespace is ignored are pointed out.
+func editNotFound(file, content, oldString string) string {
+	msg := fmt.Sprintf("old_string was not found in %s. It must match the contents of the file exactly, including whitespace and indentation", file)
+
+	oldLines := strings.Split(strings.Trim(oldString, "\n"), "\n")
+	fileLines := strings.Split(content, "\n")
+	for i := range fileLines {
+		if i+len(oldLines) > len(fileLines) {
+			break
+		}
+		if linesEqual(fileLines[i:i+len(oldLines)], oldLines, strings.TrimSpace) {
+			return fmt.Sprintf("%s. Text that only differs in whitespace was found at line %d:\n%s", msg, i+1, strings.Join(fileLines[i:i+len(oldLines)], "\n"))
+		}
+	}
+	return msg
+}
+
+func occurrenceLines(content, s string) (result []int) {
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], s)
+		if i < 0 {
+			return result
+		}
+		result = append(result, strings.Count(content[:offset+i], "\n")+1)
+		offset += i + len(s)
+	}
+}
+
+func joinInts(ints []int) string {
+	s := make([]string, 0, len(ints))
+	for _, i := range ints {
+		s = append(s, strconv.Itoa(i))
+	}
+	return strings.Join(s, ", ")
+}
+
+func fileMode(file string) fs.FileMode {
+	if info, err := os.Stat(file); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+func linesEqual(a, b []string, normalize func(string) string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if normalize(a[i]) != normalize(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+type hunk struct {
+	oldStart int
+	header   string
+	lines    []string
+	// noNewlineOld and noNewlineNew are set if the file does not end with a newline before or after the hunk.
+	noNewlineOld bool
+	noNewlineNew bool
+}
+
+// old and new return the lines of the hunk before and after it is applied.
+func (h hunk) old() (result []string) {
+	for _, line := range h.lines {
+		if line[0] != '+' {
+			result = append(result, line[1:])
+		}
+	}
+	return
+}
+
+func (h hunk) new() (result []string) {
+	for _, line := range h.lines {
+		if line[0] != '-' {
+			result = append(result, line[1:])
+		}
+	}
+	return
+}
+
+// leadingContext and trailingContext return the number of context lines at the start and end of the hunk.
+func (h hunk) leadingContext() (n int) {
+	for _, line := range h.lines {
+		if line[0] != ' ' {
+			break
+		}
+		n++
+	}
+	return
+}
+
+func (h hunk) trailingContext() (n int) {
+	for i := len(h.lines) - 1; i >= 0 && h.lines[i][0] == ' '; i-- {
+		n++
+	}
+	return
+}
+
+type filePatch struct {
+	oldPath, newPath string
+	hunks            []hunk
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+func parsePatch(patch string) ([]filePatch, error) {
+	var (
+		result []filePatch
+		lines  = strings.Split(strings.TrimRight(strings.ReplaceAll(patch, "\r\n", "\n"), "\n"), "\n")
+	)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			result = append(result, filePatch{
+				oldPath: patchPath(line[4:]),
+				newPath: patchPath(lines[i+1][4:]),
+			})
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if len(result) == 0 {
+				return nil, fmt.Errorf("line %d: hunk %q is not preceded by a --- and +++ file header", i+1, line)
+			}
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: invalid hunk header %q, expected something like \"@@ -10,5 +10,6 @@\"", i+1, line)
+			}
+
+			h := hunk{header: m[0]}
+			h.oldStart, _ = strconv.Atoi(m[1])
+			oldCount := 1
+			if m[2] != "" {
+				oldCount, _ = strconv.Atoi(m[2])
+			}
+			for ; i+1 < len(lines); i++ {
+				next := lines[i+1]
+				if strings.HasPrefix(next, "--- ") && i+2 < len(lines) && strings.HasPrefix(lines[i+2], "+++ ") {
+					break
+				}
+				if next == "" {
+					// Some tools drop the space of empty context lines.
+					next = " "
+				}
+				if next[0] == '\\' {
+					// "\ No newline at end of file" applies to the line before it.
+					if len(h.lines) > 0 && h.lines[len(h.lines)-1][0] != '+' {
+						h.noNewlineOld = true
+					}
+					if len(h.lines) > 0 && h.lines[len(h.lines)-1][0] != '-' {
+						h.noNewlineNew = true
+					}
+					continue
+				}
+				if next[0] != ' ' && next[0] != '-' && next[0] != '+' {
+					break
+				}
+				h.lines = append(h.lines, next)
+			}
+			// Blank lines between the files of a patch look like empty context lines, so the ones the header does not
+			// count are dropped.
+			for len(h.lines) > 0 && h.lines[len(h.lines)-1] == " " && len(h.old()) > oldCount {
+				h.lines = h.lines[:len(h.lines)-1]
+			}
+
+			file := &result[len(result)-1]
+			file.hunks = append(file.hunks, h)
+		}
+		// Everything else, like "diff --git" and "index" lines, is ignored.
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("no files found in patch, expected a unified diff with --- and +++ file headers")
+	}
+	for _, file := range result {
+		if len(file.hunks) == 0 && file.oldPath != "" && file.newPath != "" {
+			return nil, fmt.Errorf("no hunks found for %s", file.newPath)
+		}
+	}
+	return result, nil
+}
+
+// patchPath returns the path of a file header, or "" for /dev/null.
+func patchPath(header string) string {
+	p, _, _ := strings.Cut(header, "\t")
+	p = strings.TrimSpace(p)
+	if p == "/dev/null" {
+		return ""
+	}
+	return p
+}
+
+// stripPrefixes removes the a/ and b/ prefixes that git adds to the paths of a diff.
+func stripPrefixes(files []filePatch) {
+	for _, file := range files {
+		if file.oldPath != "" && !strings.HasPrefix(file.oldPath, "a/") || file.newPath != "" && !strings.HasPrefix(file.newPath, "b/") {
+			return
+		}
+	}
+	for i := range files {
+		files[i].oldPath = strings.TrimPrefix(files[i].oldPath, "a/")
+		files[i].newPath = strings.TrimPrefix(files[i].newPath, "b/")
+	}
+}
+
+// applyHunks applies the hunks to the lines of a file. Each hunk is first looked for where its header says it is,
+// then at increasing distances from there, ignoring differences in whitespace and up to maxFuzz context lines if it
+// is still not found. notes describes the hunks that were not applied exactly where their header says.
+func applyHunks(name string, lines []string, hunks []hunk) (_ []string, notes []string, _ error) {
+	// offset is how many lines the previous hunks added or removed, and minStart is where the previous hunk ended.
+	var offset, minStart int
+	for n, h := range hunks {
+		old, replacement := h.old(), h.new()
+
+		expected := h.oldStart - 1 + offset
+		if len(old) == 0 {
+			// A hunk that only adds lines says which line they go after.
+			expected = h.oldStart + offset
+		}
+
+		var (
+			pos  = -1
+			at   int
+			lead int
+			fuzz int
+		)
+	search:
+		for fuzz = 0; fuzz <= maxFuzz; fuzz++ {
+			var trail int
+			lead, trail = min(fuzz, h.leadingContext()), min(fuzz, h.trailingContext())
+			if fuzz > 0 && lead == 0 && trail == 0 || len(old) > 0 && lead+trail >= len(old) {
+				// There is no more context to ignore.
+				break
+			}
+			at = expected + lead
+			for _, normalize := range []func(string) string{identity, strings.TrimSpace} {
+				if pos = findLines(lines, old[lead:len(old)-trail], at, minStart, normalize); pos >= 0 {
+					old, replacement = old[lead:len(old)-trail], replacement[lead:len(replacement)-trail]
+					break search
+				}
+			}
+		}
+		if pos < 0 {
+			return nil, nil, hunkMismatch(name, n, h, lines, expected)
+		}
+
+		if pos != at || fuzz > 0 {
+			note := fmt.Sprintf("hunk #%d of %s applied at line %d", n+1, name, pos-lead+1)
+			if pos != at {
+				note += fmt.Sprintf(" (offset %d lines)", pos-at)
+			}
+			if fuzz > 0 {
+				note += fmt.Sprintf(" (fuzz %d)", fuzz)
+			}
+			notes = append(notes, note)
+		}
+
+		lines = append(lines[:pos:pos], append(replacement, lines[pos+len(old):]...)...)
+		offset += pos - at + len(replacement) - len(old)
+		minStart = pos + len(replacement)
+	}
+	return lines, notes, nil
+}
+
+func identity(s string) string {
+	return s
+}
+
+// findLines returns the position of pattern in lines closest to expected and not before minStart, or -1.
+func findLines(lines, pattern []string, expected, minStart int, normalize func(string) string) int {
+	expected = max(min(expected, len(lines)), minStart)
+	for distance := 0; expected-distance >= minStart || expected+distance <= len(lines); distance++ {
+		for _, pos := range []int{expected - distance, expected + distance} {
+			if pos < minStart || pos+len(pattern) > len(lines) {
+				continue
+			}
+			if linesEqual(lines[pos:pos+len(pattern)], pattern, normalize) {
+				return pos
+			}
+		}
+	}
+	return -1
+}
+
+func hunkMismatch(name string, n int, h hunk, lines []string, expected int) error {
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("hunk #%d (%s) of %s does not match the file. Expected these lines:\n", n+1, h.header, name))
+	for _, line := range h.old() {
+		msg.WriteString("  " + line + "\n")
+	}
+
+	start := max(min(expected, len(lines))-2, 0)
+	end := min(start+len(h.old())+4, len(lines))
+	if start < end {
+		msg.WriteString(fmt.Sprintf("but the file has these lines around line %d:\n", expected+1))
+		for i := start; i < end; i++ {
+			msg.WriteString(fmt.Sprintf("  %d: %s\n", i+1, lines[i]))
+		}
+	}
+	msg.WriteString("Read the file again and make a patch against its current contents")
+	return errors.New(msg.String())
+}
+
+type patchedFile struct {
+	path    string
+	content string
+	remove  bool
+	summary string
+}
+
+func SysPatch(_ context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Patch     string `json:"patch,omitempty"`
+		Directory string `json:"directory,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	files, err := parsePatch(params.Patch)
+	if err != nil {
+		return fmt.Sprintf("Failed to parse patch: %v", err), nil
+	}
+	stripPrefixes(files)
+
+	paths, err := patchPaths(params.Directory, files)
+	if err != nil {
+		return fmt.Sprintf("Failed to apply patch, no files were changed: %v", err), nil
+	}
+	// Lock the files in a fixed order to prevent concurrent writes from other tool calls without deadlocking.
+	for _, p := range paths {
+		locker.Lock(p)
+		defer locker.Unlock(p)
+	}
+
+	// Every file is patched in memory first, so that nothing is written if any hunk fails.
+	var (
+		results []patchedFile
+		notes   []string
+	)
+	for _, file := range files {
+		result, fileNotes, err := patchFile(params.Directory, file)
+		if err != nil {
+			return fmt.Sprintf("Failed to apply patch, no files were changed: %v", err), nil
+		}
+		results = append(results, result...)
+		notes = append(notes, fileNotes...)
+	}
+
+	if err := writePatched(results); err != nil {
+		return fmt.Sprintf("Failed to apply patch: %v", err), nil
+	}
+
+	var summary []string
+	for _, result := range results {
+		if result.summary != "" {
+			summary = append(summary, result.summary)
+		}
+	}
+
+	log.Debugf("Applied patch to %d files", len(results))
+	out := "Applied patch: " + strings.Join(summary, ", ")
+	if len(notes) > 0 {
+		out += "\n" + strings.Join(notes, "\n")
+	}
+	return out, nil
+}
+
+// PatchPaths returns the paths of the files that sys.patch changes with a patch, joined to dir.
+func PatchPaths(patch, dir string) ([]string, error) {
+	files, err := parsePatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	stripPrefixes(files)
+	return patchPaths(dir, files)
+}
+
+// patchPaths returns the sorted paths of the files in a patch, joined to dir. The paths must be inside of dir, and a
+// patch can only change each file once, because every change is made to the file as it is on disk.
+func patchPaths(dir string, files []filePatch) ([]string, error) {
+	var (
+		result []string
+		seen   = map[string]bool{}
+	)
+	for _, file := range files {
+		filePaths := []string{file.oldPath}
+		if file.newPath != file.oldPath {
+			filePaths = append(filePaths, file.newPath)
+		}
+		for _, p := range filePaths {
+			if p == "" {
+				continue
+			}
+			if !filepath.IsLocal(p) {
+				return nil, fmt.Errorf("%s is outside of the directory %s", p, dir)
+			}
+			p = filepath.Join(dir, p)
+			if seen[p] {
+				return nil, fmt.Errorf("the patch changes %s more than once, the changes to a file must be in one section", p)
+			}
+			seen[p] = true
+			result = append(result, p)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// writePatched writes every changed file to a temporary file next to it before renaming them and deleting files, so
+// that no file is changed if any of them can not be written.
+func writePatched(results []patchedFile) error {
+	temps := make([]string, len(results))
+	defer func() {
+		for _, temp := range temps {
+			if temp != "" {
+				_ = os.Remove(temp)
+			}
+		}
+	}()
+
+	for i, result := range results {
+		if result.remove {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(result.path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", result.path, err)
+		}
+		temp, err := os.CreateTemp(filepath.Dir(result.path), "."+filepath.Base(result.path)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("failed to write file %s: %w", result.path, err)
+		}
+		temps[i] = temp.Name()
+		_, err = temp.WriteString(result.content)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(temp.Name(), fileMode(result.path))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write file %s: %w", result.path, err)
+		}
+	}
+
+	for i, result := range results {
+		if result.remove {
+			if err := os.Remove(result.path); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", result.path, err)
+			}
+		} else if err := os.Rename(temps[i], result.path); err != nil {
+			return fmt.Errorf("failed to write file %s: %w", result.path, err)
+		} else {
+			temps[i] = ""
+		}
+	}
+	return nil
+}
+
+func compact(sorted []string) []string {
+	var result []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func patchFile(dir string, file filePatch) ([]patchedFile, []string, error) {
+	switch {
+	case file.oldPath == "":
+		target := filepath.Join(dir, file.newPath)
+		if _, err := os.Stat(target); err == nil {
+			return nil, nil, fmt.Errorf("%s can not be created because it already exists", target)
+		}
+		lines, notes, err := applyHunks(target, nil, file.hunks)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []patchedFile{{
+			path:    target,
+			content: joinLines(lines, true, file.hunks),
+			summary: "created " + target,
+		}}, notes, nil
+	case file.newPath == "":
+		target := filepath.Join(dir, file.oldPath)
+		if _, err := os.Stat(target); err != nil {
+			return nil, nil, fmt.Errorf("%s can not be deleted: %w", target, err)
+		}
+		return []patchedFile{{
+			path:    target,
+			remove:  true,
+			summary: "deleted " + target,
+		}}, nil, nil
+	}
+
+	source := filepath.Join(dir, file.oldPath)
+	data, err := os.ReadFile(source)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("the file %s does not exist", source)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+	lines, notes, err := applyHunks(source, lines, file.hunks)
+	if err != nil {
+		return nil, nil, err
+	}
+	content := joinLines(lines, len(data) == 0 || data[len(data)-1] == '\n', file.hunks)
+
+	target := filepath.Join(dir, file.newPath)
+	if target == source {
+		return []patchedFile{{
+			path:    target,
+			content: content,
+			summary: "modified " + target,
+		}}, notes, nil
+	}
+	return []patchedFile{{
+		path:    target,
+		content: content,
+		summary: fmt.Sprintf("renamed %s to %s", source, target),
+	}, {
+		path:   source,
+		remove: true,
+	}}, notes, nil
+}
+
+// joinLines joins the lines of a file. It ends with a newline if the original file did, unless a hunk changes that.
+func joinLines(lines []string, newline bool, hunks []hunk) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	for _, h := range hunks {
+		if h.noNewlineNew {
+			newline = false
+		} else if h.noNewlineOld {
+			newline = true
+		}
+	}
+	content := strings.Join(lines, "\n")
+	if newline {
+		content += "\n"
+	}
+	return content
+}
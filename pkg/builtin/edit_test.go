@@ -0,0 +1,168 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func args(t *testing.T, kv ...string) string {
+	t.Helper()
+	m := map[string]string{}
+	for i := 0; i < len(kv); i += 2 {
+		m[kv[i]] = kv[i+1]
+	}
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func readFile(t *testing.T, file string) string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSysEdit(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.go")
+	require.NoError(t, os.WriteFile(file, []byte("func main() {\n\tprintln(\"a\")\n\tprintln(\"a\")\n}\n"), 0600))
+
+	out, err := SysEdit(context.Background(), nil, args(t, "filename", file, "old_string", "println(\"a\")", "new_string", "println(\"b\")"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "old_string was found 2 times in "+file+" at lines 2, 3. Include more of the surrounding text to make it unique, or set replace_all to true to replace every occurrence", out)
+
+	out, err = SysEdit(context.Background(), nil, args(t, "filename", file, "old_string", "println(\"a\")\n}", "new_string", "println(\"b\")\n}"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Replaced 1 occurrence in "+file, out)
+	require.Equal(t, "func main() {\n\tprintln(\"a\")\n\tprintln(\"b\")\n}\n", readFile(t, file))
+
+	out, err = SysEdit(context.Background(), nil, args(t, "filename", file, "old_string", "func main() {\n  println(\"a\")", "new_string", "x"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "old_string was not found in "+file+". It must match the contents of the file exactly, including whitespace and indentation. Text that only differs in whitespace was found at line 1:\nfunc main() {\n\tprintln(\"a\")", out)
+
+	out, err = SysEdit(context.Background(), nil, args(t, "filename", file, "old_string", "println", "new_string", "print", "replace_all", "true"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Replaced 2 occurrences in "+file, out)
+	require.Equal(t, "func main() {\n\tprint(\"a\")\n\tprint(\"b\")\n}\n", readFile(t, file))
+}
+
+func TestSysPatch(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.txt"), []byte("delete me\n"), 0600))
+
+	// Both hunks are two lines off from where their headers say, and the context of the second hunk does not match at
+	// its end.
+	patch := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ three
+-four
++FOUR
+ five
+@@ -6,3 +6,4 @@
+ eight
+ nine
++nine and a half
+ TEN
+
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-delete me
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,2 @@
++new
++file
+\ No newline at end of file
+`
+	out, err := SysPatch(context.Background(), nil, args(t, "patch", patch, "directory", dir), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Applied patch: modified "+filepath.Join(dir, "a.txt")+", deleted "+filepath.Join(dir, "old.txt")+", created "+filepath.Join(dir, "new.txt")+
+		"\nhunk #1 of "+filepath.Join(dir, "a.txt")+" applied at line 3 (offset 2 lines)"+
+		"\nhunk #2 of "+filepath.Join(dir, "a.txt")+" applied at line 8 (fuzz 1)", out)
+	require.Equal(t, "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\nnine and a half\nten\n", readFile(t, filepath.Join(dir, "a.txt")))
+	require.Equal(t, "new\nfile", readFile(t, filepath.Join(dir, "new.txt")))
+	require.NoFileExists(t, filepath.Join(dir, "old.txt"))
+
+	// Nothing is changed if any hunk fails.
+	patch = `--- a.txt
++++ a.txt
+@@ -1,2 +1,2 @@
+-one
++ONE
+ two
+--- new.txt
++++ new.txt
+@@ -1,2 +1,2 @@
+-old
+-contents
++other
++contents
+`
+	out, err = SysPatch(context.Background(), nil, args(t, "patch", patch, "directory", dir), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "Failed to apply patch, no files were changed: hunk #1 (@@ -1,2 +1,2 @@) of "+filepath.Join(dir, "new.txt")+" does not match the file. Expected these lines:\n  old\n  contents\n")
+	require.Contains(t, out, "  1: new\n  2: file\n")
+	require.Equal(t, "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\nnine and a half\nten\n", readFile(t, filepath.Join(dir, "a.txt")))
+
+	// Nothing is changed if any file can't be written, here because a.txt is not a directory.
+	patch = `--- a.txt
++++ a.txt
+@@ -1,2 +1,2 @@
+-one
++ONE
+ two
+--- /dev/null
++++ a.txt/b.txt
+@@ -0,0 +1 @@
++b
+`
+	out, err = SysPatch(context.Background(), nil, args(t, "patch", patch, "directory", dir), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "Failed to apply patch: failed to create directory for "+filepath.Join(dir, "a.txt", "b.txt"))
+	require.Equal(t, "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\neight\nnine\nnine and a half\nten\n", readFile(t, filepath.Join(dir, "a.txt")))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "temporary files are removed")
+
+	// A file can only be changed by one section of a patch.
+	patch = `--- a.txt
++++ a.txt
+@@ -1,2 +1,2 @@
+-one
++ONE
+ two
+--- a.txt
++++ a.txt
+@@ -2,2 +2,2 @@
+-two
++TWO
+ three
+`
+	out, err = SysPatch(context.Background(), nil, args(t, "patch", patch, "directory", dir), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Failed to apply patch, no files were changed: the patch changes "+filepath.Join(dir, "a.txt")+" more than once, the changes to a file must be in one section", out)
+
+	// Files outside of the directory can't be patched.
+	patch = `--- /dev/null
++++ ../escaped.txt
+@@ -0,0 +1 @@
++escaped
+`
+	out, err = SysPatch(context.Background(), nil, args(t, "patch", patch, "directory", dir), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Failed to apply patch, no files were changed: ../escaped.txt is outside of the directory "+dir, out)
+	require.NoFileExists(t, filepath.Join(dir, "..", "escaped.txt"))
+
+	out, err = SysPatch(context.Background(), nil, args(t, "patch", "not a patch"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Failed to parse patch: no files found in patch, expected a unified diff with --- and +++ file headers", out)
+}
@@ -0,0 +1,342 @@
+package builtin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	defaultHTTPTimeout = 30 * time.Second
+	defaultMaxBytes    = 1 << 20
+)
+
+func SysHTTPRequest(ctx context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		URL            string `json:"url,omitempty"`
+		Method         string `json:"method,omitempty"`
+		Headers        string `json:"headers,omitempty"`
+		Query          string `json:"query,omitempty"`
+		Body           string `json:"body,omitempty"`
+		JSON           string `json:"json,omitempty"`
+		Form           string `json:"form,omitempty"`
+		Timeout        string `json:"timeout,omitempty"`
+		IncludeHeaders string `json:"include_headers,omitempty"`
+		MaxBytes       string `json:"max_bytes,omitempty"`
+		OutputFile     string `json:"output_file,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	req, err := newHTTPRequest(ctx, params.Method, params.URL, params.Query, params.Body, params.JSON, params.Form)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	headers, err := jsonValues("headers", params.Headers)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+	for k, values := range headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	credentials := addHTTPCredentials(req, envs)
+
+	timeout := defaultHTTPTimeout
+	if params.Timeout != "" {
+		seconds, err := strconv.ParseFloat(params.Timeout, 64)
+		if err != nil {
+			return types.InvalidArgument(input, fmt.Errorf("timeout must be a number of seconds: %w", err)), nil
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	maxBytes := defaultMaxBytes
+	if params.MaxBytes != "" {
+		maxBytes, err = strconv.Atoi(params.MaxBytes)
+		if err != nil {
+			return types.InvalidArgument(input, fmt.Errorf("max_bytes must be a number: %w", err)), nil
+		}
+	}
+
+	c := http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(redirect *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			// Credentials are only for the host they are named after, and never leave over plain HTTP once they were sent
+			// over HTTPS. The client already drops the Authorization header when redirected to another host, but not
+			// custom headers, and not when the scheme changes.
+			downgraded := req.URL.Scheme == "https" && redirect.URL.Scheme != "https"
+			if redirect.URL.Hostname() != req.URL.Hostname() || downgraded {
+				for _, name := range credentials {
+					redirect.Header.Del(name)
+				}
+			}
+			return nil
+		},
+	}
+
+	log.Debugf("http %s %s", req.Method, req.URL)
+	resp, err := c.Do(req)
+	if err != nil {
+		return fmt.Sprintf("Failed to send %s request to %s: %v", req.Method, req.URL, err), nil
+	}
+	defer resp.Body.Close()
+
+	var out strings.Builder
+	out.WriteString(fmt.Sprintf("%s %s\n", resp.Proto, resp.Status))
+	if params.IncludeHeaders == "true" {
+		keys := make([]string, 0, len(resp.Header))
+		for k := range resp.Header {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			for _, v := range resp.Header[k] {
+				out.WriteString(fmt.Sprintf("%s: %s\n", k, v))
+			}
+		}
+	}
+	out.WriteString("\n")
+
+	body := bufio.NewReader(resp.Body)
+	// Peek returns an error if the body is shorter, which is fine, it's only used to guess whether the body is text.
+	start, _ := body.Peek(512)
+
+	if params.OutputFile != "" || !isText(resp.Header.Get("Content-Type"), start) {
+		file, n, err := saveHTTPBody(envs, params.OutputFile, httpExt(req.URL, resp.Header.Get("Content-Type")), body)
+		if err != nil {
+			return fmt.Sprintf("Failed to save the response of %s: %v", req.URL, err), nil
+		}
+		out.WriteString(fmt.Sprintf("Saved the %d byte response body to %s", n, file))
+		return out.String(), nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, int64(maxBytes)+1))
+	if err != nil {
+		return fmt.Sprintf("Failed to read the response of %s: %v", req.URL, err), nil
+	}
+	if len(data) > maxBytes {
+		out.Write(data[:maxBytes])
+		out.WriteString(fmt.Sprintf("\n\n(The response body was truncated to %d bytes)", maxBytes))
+	} else {
+		out.Write(data)
+	}
+	return out.String(), nil
+}
+
+func newHTTPRequest(ctx context.Context, method, rawURL, query, body, jsonBody, form string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("url must be a http or https URL, got %q", rawURL)
+	}
+
+	queryValues, err := jsonValues("query", query)
+	if err != nil {
+		return nil, err
+	}
+	if len(queryValues) > 0 {
+		q := u.Query()
+		for k, values := range queryValues {
+			for _, v := range values {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	var (
+		content     io.Reader
+		contentType string
+		bodies      int
+	)
+	if body != "" {
+		content = strings.NewReader(body)
+		bodies++
+	}
+	if jsonBody != "" {
+		if !json.Valid([]byte(jsonBody)) {
+			return nil, errors.New("json must be valid JSON")
+		}
+		content, contentType = strings.NewReader(jsonBody), "application/json"
+		bodies++
+	}
+	if form != "" {
+		formValues, err := jsonValues("form", form)
+		if err != nil {
+			return nil, err
+		}
+		content, contentType = strings.NewReader(url.Values(formValues).Encode()), "application/x-www-form-urlencoded"
+		bodies++
+	}
+	if bodies > 1 {
+		return nil, errors.New("only one of body, json and form can be set")
+	}
+
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), content)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return req, nil
+}
+
+// jsonValues parses a JSON object of names to values. A value can be a string, number or boolean, or a list of them.
+func jsonValues(name, value string) (map[string][]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(value), &obj); err != nil {
+		return nil, fmt.Errorf("%s must be a JSON object: %w", name, err)
+	}
+
+	result := make(map[string][]string, len(obj))
+	for k, v := range obj {
+		list, ok := v.([]any)
+		if !ok {
+			list = []any{v}
+		}
+		for _, item := range list {
+			switch item.(type) {
+			case string, float64, bool:
+				result[k] = append(result[k], fmt.Sprint(item))
+			default:
+				return nil, fmt.Errorf("the value of %s in %s must be a string, number or boolean", k, name)
+			}
+		}
+	}
+	return result, nil
+}
+
+// addHTTPCredentials adds the credentials for the host of the request from the environment, so that secrets never
+// have to be passed as arguments. The variables are named like the ones of OpenAPI tools, after the host name:
+// GPTSCRIPT_API_EXAMPLE_COM_BEARER_TOKEN for a bearer token, GPTSCRIPT_API_EXAMPLE_COM_USERNAME and
+// GPTSCRIPT_API_EXAMPLE_COM_PASSWORD for basic authentication, and GPTSCRIPT_API_EXAMPLE_COM_HEADER_X_API_KEY for an
+// X-Api-Key header. Headers set in the arguments are not replaced. The names of the headers that were added are
+// returned.
+func addHTTPCredentials(req *http.Request, envs []string) (added []string) {
+	prefix := "GPTSCRIPT_" + env.ToEnvLike(req.URL.Hostname()) + "_"
+
+	if req.Header.Get("Authorization") == "" {
+		if token := env.Getenv(prefix+"BEARER_TOKEN", envs); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+			added = append(added, "Authorization")
+		} else if username := env.Getenv(prefix+"USERNAME", envs); username != "" {
+			req.SetBasicAuth(username, env.Getenv(prefix+"PASSWORD", envs))
+			added = append(added, "Authorization")
+		}
+	}
+
+	for _, e := range envs {
+		k, v, _ := strings.Cut(e, "=")
+		name, ok := strings.CutPrefix(k, prefix+"HEADER_")
+		if !ok || name == "" {
+			continue
+		}
+		name = strings.ReplaceAll(name, "_", "-")
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, v)
+			added = append(added, name)
+		}
+	}
+	return added
+}
+
+// isText guesses whether a response body is text from its content type, or its first bytes if there is none.
+func isText(contentType string, start []byte) bool {
+	if bytes.IndexByte(start, 0) != -1 {
+		return false
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(start)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"),
+		strings.HasSuffix(mediaType, "yaml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded",
+		"application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+// httpExt returns the extension for a file with a response body, from the URL or else the content type.
+func httpExt(u *url.URL, contentType string) string {
+	if ext := filepath.Ext(u.Path); ext != "" {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// saveHTTPBody writes a response body to file, or to a new file with the extension ext in the workspace if file is not
+// set.
+func saveHTTPBody(envs []string, file, ext string, body io.Reader) (string, int64, error) {
+	var (
+		f   *os.File
+		err error
+	)
+	if file == "" {
+		var dir string
+		if dir, err = getWorkspaceDir(envs); err != nil {
+			return "", 0, err
+		}
+		f, err = os.CreateTemp(dir, "gpt-http*"+ext)
+	} else if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+		f, err = os.Create(file)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, body)
+	if err != nil {
+		return "", 0, err
+	}
+	return f.Name(), n, f.Close()
+}
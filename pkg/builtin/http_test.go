@@ -0,0 +1,124 @@
+package builtin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysHTTPRequest(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("X-Test", "yes")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, r.Method+" "+r.URL.RawQuery+"\n"+r.Header.Get("Content-Type")+"\n"+
+				r.Header.Get("Authorization")+"\n"+r.Header.Get("X-Api-Key")+"\n"+string(body))
+		case "/binary":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte{0x89, 'P', 'N', 'G', 0})
+		case "/missing":
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	host := "GPTSCRIPT_" + env.ToEnvLike(strings.Split(strings.TrimPrefix(s.URL, "http://"), ":")[0])
+	envs := []string{
+		host + "_BEARER_TOKEN=secret",
+		host + "_HEADER_X_API_KEY=key",
+		"GPTSCRIPT_WORKSPACE_DIR=" + t.TempDir(),
+	}
+
+	out, err := SysHTTPRequest(context.Background(), envs, args(t,
+		"url", s.URL+"/echo?a=1",
+		"method", "put",
+		"query", `{"b": [2, "3"]}`,
+		"json", `{"hello": "world"}`,
+		"include_headers", "true",
+	), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "HTTP/1.1 201 Created\nContent-Length: ")
+	require.Contains(t, out, "\nX-Test: yes\n\nPUT a=1&b=2&b=3\napplication/json\nBearer secret\nkey\n{\"hello\": \"world\"}")
+
+	out, err = SysHTTPRequest(context.Background(), envs, args(t,
+		"url", s.URL+"/echo",
+		"method", "POST",
+		"headers", `{"Authorization": "Basic other"}`,
+		"form", `{"name": "value"}`,
+		"max_bytes", "20",
+	), nil)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 201 Created\n\nPOST \napplication/x-\n\n(The response body was truncated to 20 bytes)", out)
+
+	out, err = SysHTTPRequest(context.Background(), envs, args(t, "url", s.URL+"/missing"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 404 Not Found\n\n404 page not found\n", out)
+
+	out, err = SysHTTPRequest(context.Background(), envs, args(t, "url", s.URL+"/binary"), nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out, "HTTP/1.1 200 OK\n\nSaved the 5 byte response body to "), out)
+	file := strings.TrimPrefix(out, "HTTP/1.1 200 OK\n\nSaved the 5 byte response body to ")
+	require.Equal(t, ".png", filepath.Ext(file))
+
+	file = filepath.Join(t.TempDir(), "out", "echo.txt")
+	out, err = SysHTTPRequest(context.Background(), nil, args(t, "url", s.URL+"/echo", "body", "text", "output_file", file), nil)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 201 Created\n\nSaved the 12 byte response body to "+file, out)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "GET \n\n\n\ntext", string(data))
+
+	out, err = SysHTTPRequest(context.Background(), nil, args(t, "url", s.URL, "body", "a", "json", "{}"), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "only one of body, json and form can be set")
+}
+
+func TestSysHTTPRequestRedirectDropsCredentials(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "key: "+r.Header.Get("X-Api-Key"))
+	}))
+	defer other.Close()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer s.Close()
+
+	out, err := SysHTTPRequest(context.Background(), []string{"GPTSCRIPT_127_0_0_1_HEADER_X_API_KEY=key"}, args(t, "url", s.URL), nil)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 200 OK\n\nkey: ", out)
+}
+
+func TestSysHTTPRequestDowngradeDropsCredentials(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "key: "+r.Header.Get("X-Api-Key")+", auth: "+r.Header.Get("Authorization"))
+	}))
+	defer plain.Close()
+
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL, http.StatusFound)
+	}))
+	defer s.Close()
+
+	// Trust the certificate of the test server.
+	defer func(transport http.RoundTripper) {
+		http.DefaultTransport = transport
+	}(http.DefaultTransport)
+	http.DefaultTransport = s.Client().Transport
+
+	envs := []string{"GPTSCRIPT_127_0_0_1_HEADER_X_API_KEY=key", "GPTSCRIPT_127_0_0_1_BEARER_TOKEN=token"}
+	out, err := SysHTTPRequest(context.Background(), envs, args(t, "url", s.URL), nil)
+	require.NoError(t, err)
+	require.Equal(t, "HTTP/1.1 200 OK\n\nkey: , auth: ", out)
+}
@@ -0,0 +1,63 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/tidwall/gjson"
+)
+
+func SysJSONQuery(_ context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Path string `json:"path,omitempty"`
+		JSON string `json:"json,omitempty"`
+		File string `json:"file,omitempty"`
+		// Output is set when used as an output filter, see the docs of output filters.
+		Output *string `json:"output,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Path == "" {
+		return types.InvalidArgument(input, fmt.Errorf("path is required")), nil
+	}
+
+	var (
+		doc    = params.JSON
+		source = "json"
+	)
+	switch {
+	case params.JSON != "":
+	case params.File != "":
+		data, err := os.ReadFile(params.File)
+		if err != nil {
+			return fmt.Sprintf("Failed to read %s: %v", params.File, err), nil
+		}
+		doc, source = string(data), params.File
+	case params.Output != nil:
+		// Output that isn't JSON, like an error message, is passed through unchanged.
+		if !gjson.Valid(*params.Output) {
+			return *params.Output, nil
+		}
+		doc = *params.Output
+	default:
+		return types.InvalidArgument(input, fmt.Errorf("one of json or file is required")), nil
+	}
+
+	if !gjson.Valid(doc) {
+		return fmt.Sprintf("The contents of %s are not valid JSON", source), nil
+	}
+
+	result := gjson.Get(doc, params.Path)
+	if !result.Exists() {
+		return fmt.Sprintf("Nothing matches the path %s", params.Path), nil
+	}
+	if result.Type == gjson.String {
+		return result.Str, nil
+	}
+	return result.Raw, nil
+}
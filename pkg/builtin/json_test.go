@@ -0,0 +1,44 @@
+package builtin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysJSONQuery(t *testing.T) {
+	doc := `{"name": {"first": "Ada"}, "items": [{"name": "a", "size": 1}, {"name": "b", "size": 20}]}`
+
+	for _, test := range []struct {
+		path, expected string
+	}{
+		{"name.first", "Ada"},
+		{"items.#.name", `["a","b"]`},
+		{"items.#(size>10)#.name", `["b"]`},
+		{"items.1", `{"name": "b", "size": 20}`},
+		{"{name.first,count:items.#}", `{"first":"Ada","count":2}`},
+		{"missing", "Nothing matches the path missing"},
+	} {
+		out, err := SysJSONQuery(context.Background(), nil, args(t, "path", test.path, "json", doc), nil)
+		require.NoError(t, err)
+		require.Equal(t, test.expected, out, test.path)
+	}
+
+	file := filepath.Join(t.TempDir(), "doc.json")
+	require.NoError(t, os.WriteFile(file, []byte(doc), 0600))
+	out, err := SysJSONQuery(context.Background(), nil, args(t, "path", "items.#", "file", file), nil)
+	require.NoError(t, err)
+	require.Equal(t, "2", out)
+
+	out, err = SysJSONQuery(context.Background(), nil, args(t, "path", "a", "json", "not json"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "The contents of json are not valid JSON", out)
+
+	// As an output filter, output that isn't JSON is passed through.
+	out, err = SysJSONQuery(context.Background(), nil, args(t, "path", "a", "output", "ERROR: failed"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "ERROR: failed", out)
+}
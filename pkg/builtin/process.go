@@ -0,0 +1,220 @@
+package builtin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/process"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const defaultWaitTimeout = time.Minute
+
+var signals = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGKILL": os.Kill,
+	"SIGTERM": syscall.SIGTERM,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGQUIT": syscall.SIGQUIT,
+}
+
+func processManager(ctx context.Context) (*process.Manager, error) {
+	m := process.FromContext(ctx)
+	if m == nil {
+		return nil, fmt.Errorf("background processes can only be used during a run")
+	}
+	return m, nil
+}
+
+func getProcess(ctx context.Context, id string) (*process.Process, error) {
+	m, err := processManager(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		return nil, fmt.Errorf("the ID of a process started with sys.exec.start is required")
+	}
+	return m.Get(id)
+}
+
+func describeProcess(p *process.Process) string {
+	return fmt.Sprintf("Process %s (pid %d, %s) %s", p.ID, p.Pid(), p.Command, p.Status())
+}
+
+// processOutput returns the new output of a process, with stdout and stderr in separate sections.
+func processOutput(p *process.Process) string {
+	stdout, stderr, dropped := p.Output()
+
+	var out strings.Builder
+	if dropped > 0 {
+		out.WriteString(fmt.Sprintf("(%d bytes of output were dropped because they were not read in time)\n", dropped))
+	}
+	if stdout != "" {
+		out.WriteString("STDOUT:\n" + stdout)
+		if !strings.HasSuffix(stdout, "\n") {
+			out.WriteString("\n")
+		}
+	}
+	if stderr != "" {
+		out.WriteString("STDERR:\n" + stderr)
+	}
+	if out.Len() == 0 {
+		return "No new output"
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+func SysExecStart(ctx context.Context, env []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Command   string `json:"command,omitempty"`
+		Directory string `json:"directory,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	m, err := processManager(ctx)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	if envvars, err := getWorkspaceEnvFileContents(env); err == nil {
+		env = append(env, envvars...)
+	}
+
+	log.Debugf("Starting %s in %s", params.Command, params.Directory)
+	p, err := m.Start(params.Command, params.Directory, env)
+	if err != nil {
+		return fmt.Sprintf("Failed to start %s: %v", params.Command, err), nil
+	}
+
+	// The process is stopped when the run finishes, or earlier if the user cancels.
+	if commandCtx, ok := engine.FromContext(ctx); ok {
+		commandCtx.OnUserCancel(p.Context(), p.Stop)
+	}
+
+	return fmt.Sprintf("Started process %s (pid %d). It will be stopped when the run finishes.", p.ID, p.Pid()), nil
+}
+
+func SysExecStatus(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		ID string `json:"id,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.ID == "" {
+		m, err := processManager(ctx)
+		if err != nil {
+			return err.Error(), nil
+		}
+		var lines []string
+		for _, p := range m.List() {
+			lines = append(lines, describeProcess(p))
+		}
+		if len(lines) == 0 {
+			return "No processes were started", nil
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	p, err := getProcess(ctx, params.ID)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return describeProcess(p), nil
+}
+
+func SysExecOutput(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		ID string `json:"id,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	p, err := getProcess(ctx, params.ID)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return processOutput(p), nil
+}
+
+func SysExecSignal(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		ID     string `json:"id,omitempty"`
+		Signal string `json:"signal,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	name := strings.ToUpper(params.Signal)
+	if name == "" {
+		name = "SIGTERM"
+	} else if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Sprintf("Unknown signal %q, must be one of SIGINT, SIGTERM, SIGKILL, SIGHUP or SIGQUIT", params.Signal), nil
+	}
+
+	p, err := getProcess(ctx, params.ID)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	if err := p.Signal(sig); err != nil {
+		return fmt.Sprintf("Failed to send %s to process %s: %v", name, p.ID, err), nil
+	}
+	return fmt.Sprintf("Sent %s to process %s", name, p.ID), nil
+}
+
+func SysExecWait(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		ID      string `json:"id,omitempty"`
+		Timeout string `json:"timeout,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	timeout := defaultWaitTimeout
+	if params.Timeout != "" {
+		seconds, err := strconv.ParseFloat(params.Timeout, 64)
+		if err != nil {
+			return types.InvalidArgument(input, fmt.Errorf("timeout must be a number of seconds: %w", err)), nil
+		}
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	p, err := getProcess(ctx, params.ID)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	commandCtx, _ := engine.FromContext(ctx)
+	waitCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if commandCtx != nil {
+		commandCtx.OnUserCancel(waitCtx, cancel)
+	}
+
+	if !p.Wait(waitCtx, timeout) {
+		return fmt.Sprintf("%s. It did not exit within %s\n%s", describeProcess(p), timeout, processOutput(p)), nil
+	}
+	return describeProcess(p) + "\n" + processOutput(p), nil
+}
@@ -0,0 +1,99 @@
+package builtin
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/process"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSysExecBackground(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	ctx, processes := process.WithManager(context.Background())
+	defer processes.Close()
+
+	out, err := SysExecStart(ctx, nil, args(t, "command", "echo started; sleep 0.1; echo oops >&2; sleep 60"), nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out, "Started process proc-1 (pid "), out)
+
+	// Every read only returns the output since the previous one.
+	var outputs []string
+	require.Eventually(t, func() bool {
+		out, err = SysExecOutput(ctx, nil, args(t, "id", "proc-1"), nil)
+		require.NoError(t, err)
+		if out != "No new output" {
+			outputs = append(outputs, out)
+		}
+		return strings.Contains(out, "STDERR")
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"STDOUT:\nstarted", "STDERR:\noops"}, outputs)
+
+	out, err = SysExecOutput(ctx, nil, args(t, "id", "proc-1"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "No new output", out)
+
+	out, err = SysExecStatus(ctx, nil, args(t, "id", "proc-1"), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "is running for")
+
+	out, err = SysExecWait(ctx, nil, args(t, "id", "proc-1", "timeout", "0.1"), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "It did not exit within 100ms\nNo new output")
+
+	out, err = SysExecSignal(ctx, nil, args(t, "id", "proc-1", "signal", "term"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Sent SIGTERM to process proc-1", out)
+
+	out, err = SysExecWait(ctx, nil, args(t, "id", "proc-1"), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "exited after 0s: signal: terminated\nNo new output")
+
+	out, err = SysExecSignal(ctx, nil, args(t, "id", "proc-1"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Failed to send SIGTERM to process proc-1: the process has already exited", out)
+
+	out, err = SysExecStart(ctx, nil, args(t, "command", "exit 3"), nil)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(out, "Started process proc-2 "), out)
+
+	out, err = SysExecWait(ctx, nil, args(t, "id", "proc-2"), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "exited with code 3 after 0s\nNo new output")
+
+	out, err = SysExecOutput(ctx, nil, args(t, "id", "proc-3"), nil)
+	require.NoError(t, err)
+	require.Equal(t, `there is no process with ID "proc-3"`, out)
+}
+
+func TestSysExecBackgroundStoppedWithRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	ctx, processes := process.WithManager(context.Background())
+
+	_, err := SysExecStart(ctx, nil, args(t, "command", "sleep 60"), nil)
+	require.NoError(t, err)
+
+	p, err := processes.Get("proc-1")
+	require.NoError(t, err)
+	require.False(t, p.Exited())
+
+	processes.Close()
+	require.True(t, p.Exited())
+
+	out, err := SysExecStart(ctx, nil, args(t, "command", "sleep 60"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Failed to start sleep 60: the run has finished", out)
+
+	out, err = SysExecStart(context.Background(), nil, args(t, "command", "sleep 60"), nil)
+	require.NoError(t, err)
+	require.Equal(t, "background processes can only be used during a run", out)
+}
@@ -0,0 +1,89 @@
+// Package cassette records the LLM interactions and tool results of a run to a file, and replays them later without
+// calling an LLM or running the tools again.
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const Version = 1
+
+type Cassette struct {
+	Version      int
+	Interactions []Interaction
+	ToolResults  []ToolResult
+}
+
+type Interaction struct {
+	Key      string                   `json:"key"`
+	Request  types.CompletionRequest  `json:"request"`
+	Response *types.CompletionMessage `json:"response,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+type ToolResult struct {
+	Key      string `json:"key"`
+	ToolName string `json:"toolName,omitempty"`
+	Input    string `json:"input,omitempty"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// entry is a line of a cassette file. The first line only holds the version and every line after it holds one
+// interaction or tool result, so that recording only ever appends to the file.
+type entry struct {
+	Version     int          `json:"version,omitempty"`
+	Interaction *Interaction `json:"interaction,omitempty"`
+	ToolResult  *ToolResult  `json:"toolResult,omitempty"`
+}
+
+func Read(file string) (*Cassette, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", file, err)
+	}
+	defer f.Close()
+
+	var (
+		result Cassette
+		dec    = json.NewDecoder(f)
+	)
+	for dec.More() {
+		var e entry
+		if err := dec.Decode(&e); err != nil {
+			return nil, fmt.Errorf("failed to parse cassette %s: %w", file, err)
+		}
+		switch {
+		case e.Version != 0:
+			result.Version = e.Version
+		case e.Interaction != nil:
+			result.Interactions = append(result.Interactions, *e.Interaction)
+		case e.ToolResult != nil:
+			result.ToolResults = append(result.ToolResults, *e.ToolResult)
+		}
+	}
+	if result.Version != Version {
+		return nil, fmt.Errorf("unsupported cassette version %d in %s", result.Version, file)
+	}
+	return &result, nil
+}
+
+// RequestKey identifies a completion request. Tool IDs contain the location the tools were loaded from, which differs
+// between machines, so they are not part of the key.
+func RequestKey(request types.CompletionRequest) string {
+	request.Tools = append([]types.ChatCompletionTool(nil), request.Tools...)
+	for i := range request.Tools {
+		request.Tools[i].Function.ToolID = ""
+	}
+	return hash.Digest(request)
+}
+
+// ToolKey identifies a call to a tool.
+func ToolKey(toolName, input string) string {
+	return hash.ID(toolName, input)
+}
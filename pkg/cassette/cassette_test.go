@@ -0,0 +1,183 @@
+package cassette
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// toolModel calls the first available tool once, and then echoes the result of the tool call.
+type toolModel struct {
+	calls int
+}
+
+func (m *toolModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	m.calls++
+	last := messageRequest.Messages[len(messageRequest.Messages)-1]
+	if last.Role == types.CompletionMessageRoleTypeTool {
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text("tool said: " + last.ChatText()),
+			Usage:   types.Usage{TotalTokens: 5},
+		}, nil
+	}
+	return &types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+		Content: []types.ContentPart{{
+			ToolCall: &types.CompletionToolCall{
+				Index:    new(int),
+				ID:       "call_1",
+				Function: types.CompletionFunctionCall{Name: messageRequest.Tools[0].Function.Name, Arguments: last.ChatText()},
+			},
+		}},
+	}, nil
+}
+
+func (m *toolModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func cassetteProgram(toolCalls, contextCalls *int) types.Program {
+	return types.Program{
+		EntryToolID: "/home/user/main.gpt:main",
+		ToolSet: types.ToolSet{
+			"/home/user/main.gpt:main": {
+				ID: "/home/user/main.gpt:main",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name:      "main",
+						ModelName: "test-model",
+						Tools:     []string{"count"},
+						Context:   []string{"today"},
+					},
+					Instructions: "call count",
+				},
+				ToolMapping: map[string][]types.ToolReference{
+					"count": {{Reference: "count", ToolID: "/home/user/main.gpt:count"}},
+					"today": {{Reference: "today", ToolID: "/home/user/main.gpt:today"}},
+				},
+			},
+			"/home/user/main.gpt:today": {
+				ID: "/home/user/main.gpt:today",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name: "today",
+					},
+					Instructions: "#!test.today",
+					BuiltinFunc: func(context.Context, []string, string, chan<- string) (string, error) {
+						*contextCalls++
+						return "today is Monday", nil
+					},
+				},
+			},
+			"/home/user/main.gpt:count": {
+				ID: "/home/user/main.gpt:count",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name: "count",
+					},
+					Instructions: "#!test.count",
+					BuiltinFunc: func(_ context.Context, _ []string, input string, _ chan<- string) (string, error) {
+						*toolCalls++
+						return "counted " + input, nil
+					},
+				},
+			},
+		},
+	}
+}
+
+func run(t *testing.T, model engine.Model, hook runner.CallHook, prg types.Program, input string) (string, error) {
+	t.Helper()
+	r, err := runner.New(model, credentials.NoopStore{}, runner.Options{
+		CommandHooks: []runner.CallHook{hook},
+	})
+	require.NoError(t, err)
+	return r.Run(context.Background(), prg, nil, input, runner.RunOptions{})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "cassette.json")
+
+	var toolCalls, contextCalls int
+	model := &toolModel{}
+	recorder, err := NewRecorder(model, file)
+	require.NoError(t, err)
+	out, err := run(t, recorder, recorder, cassetteProgram(&toolCalls, &contextCalls), "one")
+	require.NoError(t, err)
+	require.Equal(t, "tool said: counted one", out)
+	require.Equal(t, 2, model.calls)
+	require.Equal(t, 1, toolCalls)
+	// The context is refreshed after the tool call.
+	require.Equal(t, 2, contextCalls)
+
+	// Every interaction and tool result is appended to the file as its own line after the version.
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, 6, bytes.Count(data, []byte("\n")))
+
+	recorded, err := Read(file)
+	require.NoError(t, err)
+	require.Len(t, recorded.Interactions, 2)
+	require.Equal(t, []ToolResult{{
+		Key:      ToolKey("today", ""),
+		ToolName: "today",
+		Output:   "today is Monday",
+	}, {
+		Key:      ToolKey("count", "one"),
+		ToolName: "count",
+		Input:    "one",
+		Output:   "counted one",
+	}, {
+		Key:      ToolKey("today", ""),
+		ToolName: "today",
+		Output:   "today is Monday",
+	}}, recorded.ToolResults)
+
+	// Replaying does not call the model or the tool, even if the tools were loaded from a different location.
+	player, err := Load(file)
+	require.NoError(t, err)
+	prg := cassetteProgram(&toolCalls, &contextCalls)
+	out, err = run(t, player, player, relocate(prg, "/home/user/main.gpt", "/tmp/main.gpt"), "one")
+	require.NoError(t, err)
+	require.Equal(t, "tool said: counted one", out)
+	require.Equal(t, 2, model.calls)
+	require.Equal(t, 1, toolCalls)
+	require.Equal(t, 2, contextCalls)
+
+	// A request that was not recorded fails.
+	player, err = Load(file)
+	require.NoError(t, err)
+	_, err = run(t, player, player, cassetteProgram(&toolCalls, &contextCalls), "two")
+	unexpected := (*ErrUnexpectedRequest)(nil)
+	require.ErrorAs(t, err, &unexpected)
+	require.Equal(t, "test-model", unexpected.Model)
+}
+
+func relocate(prg types.Program, from, to string) types.Program {
+	result := types.Program{
+		EntryToolID: to + prg.EntryToolID[len(from):],
+		ToolSet:     types.ToolSet{},
+	}
+	for id, tool := range prg.ToolSet {
+		tool.ID = to + id[len(from):]
+		mapping := map[string][]types.ToolReference{}
+		for name, refs := range tool.ToolMapping {
+			for _, ref := range refs {
+				ref.ToolID = to + ref.ToolID[len(from):]
+				mapping[name] = append(mapping[name], ref)
+			}
+		}
+		tool.ToolMapping = mapping
+		result.ToolSet[tool.ID] = tool
+	}
+	return result
+}
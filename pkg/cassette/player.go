@@ -0,0 +1,128 @@
+package cassette
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type ErrUnexpectedRequest struct {
+	Model string
+	Key   string
+}
+
+func (e *ErrUnexpectedRequest) Error() string {
+	return fmt.Sprintf("unexpected request for model %q (key %s) that is not in the cassette", e.Model, e.Key)
+}
+
+type ErrUnexpectedToolCall struct {
+	ToolName string
+	Input    string
+}
+
+func (e *ErrUnexpectedToolCall) Error() string {
+	return fmt.Sprintf("unexpected call to tool %q with input %q that is not in the cassette", e.ToolName, e.Input)
+}
+
+// Player is a model that serves the responses from a cassette without calling an LLM. It is also a runner.CallHook,
+// used as a command hook, that serves the recorded results of commands instead of running them.
+type Player struct {
+	lock         sync.Mutex
+	interactions map[string][]Interaction
+	toolResults  map[string][]ToolResult
+}
+
+func Load(file string) (*Player, error) {
+	c, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewPlayer(c), nil
+}
+
+func NewPlayer(c *Cassette) *Player {
+	p := &Player{
+		interactions: map[string][]Interaction{},
+		toolResults:  map[string][]ToolResult{},
+	}
+	for _, interaction := range c.Interactions {
+		p.interactions[interaction.Key] = append(p.interactions[interaction.Key], interaction)
+	}
+	for _, result := range c.ToolResults {
+		p.toolResults[result.Key] = append(p.toolResults[result.Key], result)
+	}
+	return p
+}
+
+func (p *Player) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	key := RequestKey(messageRequest)
+
+	p.lock.Lock()
+	interactions := p.interactions[key]
+	if len(interactions) == 0 {
+		p.lock.Unlock()
+		return nil, &ErrUnexpectedRequest{
+			Model: messageRequest.Model,
+			Key:   key,
+		}
+	}
+	// Identical requests are served in the order they were recorded.
+	interaction := interactions[0]
+	p.interactions[key] = interactions[1:]
+	p.lock.Unlock()
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request:      messageRequest,
+	}
+
+	if interaction.Error != "" {
+		return nil, errors.New(interaction.Error)
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     interaction.Response,
+		Usage:        interaction.Response.Usage,
+	}
+	return interaction.Response, nil
+}
+
+func (p *Player) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func (p *Player) BeforeCall(ctx engine.Context, input string) (runner.BeforeCallResponse, error) {
+	key := ToolKey(ctx.Tool.Name, input)
+
+	p.lock.Lock()
+	results := p.toolResults[key]
+	if len(results) == 0 {
+		p.lock.Unlock()
+		return runner.BeforeCallResponse{}, &ErrUnexpectedToolCall{
+			ToolName: ctx.Tool.Name,
+			Input:    input,
+		}
+	}
+	result := results[0]
+	p.toolResults[key] = results[1:]
+	p.lock.Unlock()
+
+	if result.Error != "" {
+		return runner.BeforeCallResponse{}, errors.New(result.Error)
+	}
+	return runner.BeforeCallResponse{
+		Result: &result.Output,
+	}, nil
+}
+
+func (p *Player) AfterCall(_ engine.Context, _, output string, err error) (string, error) {
+	return output, err
+}
@@ -0,0 +1,98 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Recorder wraps a model and appends every completion request and response to a cassette. It is also a
+// runner.CallHook, used as a command hook, that records the result of every command.
+type Recorder struct {
+	model engine.Model
+	file  string
+	lock  sync.Mutex
+}
+
+// NewRecorder starts a new cassette in file, replacing any cassette that is already there.
+func NewRecorder(model engine.Model, file string) (*Recorder, error) {
+	r := &Recorder{
+		model: model,
+		file:  file,
+	}
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		return nil, fmt.Errorf("failed to create cassette %s: %w", file, err)
+	}
+	return r, r.append(entry{
+		Version: Version,
+	})
+}
+
+func (r *Recorder) append(e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	f, err := os.OpenFile(r.file, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open cassette %s: %w", r.file, err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write cassette %s: %w", r.file, err)
+	}
+	return f.Close()
+}
+
+func (r *Recorder) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	resp, err := r.model.Call(ctx, messageRequest, env, status)
+
+	interaction := Interaction{
+		Key:      RequestKey(messageRequest),
+		Request:  messageRequest,
+		Response: resp,
+	}
+	if err != nil {
+		interaction.Error = err.Error()
+	}
+
+	if saveErr := r.append(entry{Interaction: &interaction}); saveErr != nil {
+		return nil, saveErr
+	}
+	return resp, err
+}
+
+func (r *Recorder) ProxyInfo(env []string) (string, string, error) {
+	return r.model.ProxyInfo(env)
+}
+
+func (r *Recorder) BeforeCall(engine.Context, string) (runner.BeforeCallResponse, error) {
+	return runner.BeforeCallResponse{}, nil
+}
+
+func (r *Recorder) AfterCall(ctx engine.Context, input, output string, err error) (string, error) {
+	result := ToolResult{
+		Key:      ToolKey(ctx.Tool.Name, input),
+		ToolName: ctx.Tool.Name,
+		Input:    input,
+		Output:   output,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	if saveErr := r.append(entry{ToolResult: &result}); saveErr != nil {
+		return "", saveErr
+	}
+	return output, err
+}
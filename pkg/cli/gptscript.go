@@ -10,19 +10,23 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/gptscript-ai/cmd"
 	gptscript2 "github.com/gptscript-ai/go-gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/chat"
 	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/gemini"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/input"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/loader/github"
+	"github.com/gptscript-ai/gptscript/pkg/memory"
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
@@ -37,18 +41,23 @@ import (
 )
 
 type (
-	DisplayOptions monitor.Options
-	CacheOptions   cache.Options
-	OpenAIOptions  openai.Options
+	DisplayOptions   monitor.Options
+	CacheOptions     cache.Options
+	OpenAIOptions    openai.Options
+	AnthropicOptions anthropic.Options
+	GeminiOptions    gemini.Options
 )
 
 type GPTScript struct {
 	CacheOptions
 	OpenAIOptions
+	AnthropicOptions
+	GeminiOptions
 	DisplayOptions
 	SystemToolsDir string `usage:"Directory that contains system managed tool for which GPTScript will not manage the runtime"`
 	Color          *bool  `usage:"Use color in output (default true)" default:"true"`
 	Confirm        bool   `usage:"Prompt before running potentially dangerous commands"`
+	AuthPolicy     string `usage:"YAML file of rules that allow, deny or ask before running tools"`
 	Debug          bool   `usage:"Enable debug logging"`
 	NoTrunc        bool   `usage:"Do not truncate long log messages"`
 	Quiet          *bool  `usage:"No output logging (set --quiet=false to force on even when there is no TTY)" short:"q"`
@@ -74,6 +83,16 @@ type GPTScript struct {
 	SaveChatStateFile        string   `usage:"A file to save the chat state to so that a conversation can be resumed with --chat-state" local:"true"`
 	DefaultModelProvider     string   `usage:"Default LLM model provider to use, this will override OpenAI settings"`
 	GithubEnterpriseHostname string   `usage:"The host name for a Github Enterprise instance to enable for remote loading" local:"true"`
+	MaxPromptTokens          int      `usage:"Abort the run once this many prompt tokens have been used across all calls"`
+	MaxCompletionTokens      int      `usage:"Abort the run once this many completion tokens have been used across all calls"`
+	MaxTotalTokens           int      `usage:"Abort the run once this many total tokens have been used across all calls"`
+	MaxDuration              string   `usage:"Abort the run once it has been running this long (ex: 10m)"`
+	MaxCost                  float64  `usage:"Abort the run once its estimated cost exceeds this amount (requires --model-prices)"`
+	ModelPrices              string   `usage:"Path to a JSON file mapping model names to prompt and completion prices per million tokens"`
+	Record                   string   `usage:"Record all LLM requests and responses, and tool results, to this cassette file"`
+	Replay                   string   `usage:"Replay LLM responses and tool results from a cassette file written by --record, without calling any LLM"`
+	MemoryNamespace          string   `usage:"Namespace of the memories saved and recalled by the sys.memory tools (default: default)"`
+	CheckpointDir            string   `usage:"Save the state of the run to this directory after every call so that it can be continued with 'gptscript resume'" local:"true"`
 
 	readData []byte
 }
@@ -85,6 +104,9 @@ func New() *cobra.Command {
 		&Eval{gptscript: root},
 		&Credential{root: root},
 		&Parse{gptscript: root},
+		&Resume{gptscript: root},
+		&Memory{root: root},
+		&LLMProxy{root: root},
 		&Fmt{},
 		&Getenv{},
 		&SDKServer{
@@ -132,12 +154,20 @@ func New() *cobra.Command {
 
 func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	opts := gptscript.Options{
-		Cache:   cache.Options(r.CacheOptions),
-		OpenAI:  openai.Options(r.OpenAIOptions),
-		Monitor: monitor.Options(r.DisplayOptions),
+		Cache:     cache.Options(r.CacheOptions),
+		OpenAI:    openai.Options(r.OpenAIOptions),
+		Anthropic: anthropic.Options(r.AnthropicOptions),
+		Gemini:    gemini.Options(r.GeminiOptions),
+		Monitor:   monitor.Options(r.DisplayOptions),
 		Runner: runner.Options{
 			CredentialOverrides: r.CredentialOverride,
 			Sequential:          r.ForceSequential,
+			Budget: runner.Budget{
+				MaxPromptTokens:     r.MaxPromptTokens,
+				MaxCompletionTokens: r.MaxCompletionTokens,
+				MaxTotalTokens:      r.MaxTotalTokens,
+				MaxCost:             r.MaxCost,
+			},
 		},
 		Quiet:                r.Quiet,
 		Env:                  os.Environ(),
@@ -146,9 +176,24 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 		DisablePromptServer:  r.UI,
 		DefaultModelProvider: r.DefaultModelProvider,
 		SystemToolsDir:       r.SystemToolsDir,
+		Record:               r.Record,
+		Replay:               r.Replay,
 	}
 
-	if r.Confirm {
+	if r.MemoryNamespace != "" {
+		if err := memory.ValidateNamespace(r.MemoryNamespace); err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Env = append(opts.Env, memory.NamespaceEnvVar+"="+r.MemoryNamespace)
+	}
+
+	if r.AuthPolicy != "" {
+		policy, err := auth.ReadPolicy(r.AuthPolicy)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Authorizer = auth.NewPolicyAuthorizer(policy, auth.Authorize)
+	} else if r.Confirm {
 		opts.Runner.Authorizer = auth.Authorize
 	}
 
@@ -169,6 +214,22 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 		opts.Runner.EndPort = endNum
 	}
 
+	if r.MaxDuration != "" {
+		d, err := time.ParseDuration(r.MaxDuration)
+		if err != nil {
+			return gptscript.Options{}, fmt.Errorf("invalid max duration: %s", r.MaxDuration)
+		}
+		opts.Runner.Budget.MaxDuration = d
+	}
+
+	if r.ModelPrices != "" {
+		prices, err := runner.ReadModelPrices(r.ModelPrices)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Budget.ModelPrices = prices
+	}
+
 	if r.EventsStreamTo != "" {
 		mf, err := monitor.NewFileFactory(r.EventsStreamTo)
 		if err != nil {
@@ -334,6 +395,11 @@ func (r *GPTScript) PrintOutput(toolInput, toolOutput string) (err error) {
 }
 
 func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
+	if r.CheckpointDir != "" && r.Workspace == "" {
+		// The workspace has to survive the run for it to be resumed.
+		r.Workspace = filepath.Join(r.CheckpointDir, "workspace")
+	}
+
 	gptOpt, err := r.NewGPTScriptOpts()
 	if err != nil {
 		return err
@@ -469,8 +535,8 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 			// Don't use cmd.Context() because then sigint will cancel everything
 			return tui.Run(context.Background(), args[0], tui.RunOptions{
 				ClientOpts: &gptscript2.GlobalOptions{
-					OpenAIAPIKey:         r.APIKey,
-					OpenAIBaseURL:        r.BaseURL,
+					OpenAIAPIKey:         r.OpenAIOptions.APIKey,
+					OpenAIBaseURL:        r.OpenAIOptions.BaseURL,
 					DefaultModel:         r.DefaultModel,
 					DefaultModelProvider: r.DefaultModelProvider,
 				},
@@ -495,7 +561,19 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 		gptScript.ExtraEnv = nil
 	}
 
-	s, err := gptScript.Run(cmd.Context(), prg, gptOpt.Env, toolInput, runner.RunOptions{})
+	var runOpts runner.RunOptions
+	if r.CheckpointDir != "" {
+		run, err := r.checkpointRunFor(args[0])
+		if err != nil {
+			return err
+		}
+		if err := writeCheckpointRun(r.CheckpointDir, run); err != nil {
+			return err
+		}
+		runOpts.CheckpointDir = r.CheckpointDir
+	}
+
+	s, err := gptScript.Run(cmd.Context(), prg, gptOpt.Env, toolInput, runOpts)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"github.com/gptscript-ai/gptscript/pkg/llmproxy"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/spf13/cobra"
+)
+
+type LLMProxy struct {
+	root             *GPTScript
+	Address          string   `usage:"Address to listen on" default:"127.0.0.1:9292" local:"true"`
+	APIKey           string   `usage:"API key that clients send as a bearer token" name:"api-key" local:"true"`
+	KeysFile         string   `usage:"JSON file of named API keys and their daily quotas" local:"true"`
+	LogFile          string   `usage:"Append every request and response to this JSONL file" local:"true"`
+	AllowedProviders []string `usage:"Model providers that clients may use with 'model from provider'" local:"true"`
+}
+
+func (c *LLMProxy) Customize(cmd *cobra.Command) {
+	cmd.Use = "llm-proxy"
+	cmd.Short = "Serve the configured models through an OpenAI compatible API"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *LLMProxy) Run(cmd *cobra.Command, _ []string) error {
+	if c.root.Debug {
+		mvl.SetDebug()
+	}
+
+	opts, err := c.root.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	var keys []llmproxy.Key
+	if c.KeysFile != "" {
+		if keys, err = llmproxy.ReadKeys(c.KeysFile); err != nil {
+			return err
+		}
+	}
+	if c.APIKey != "" {
+		keys = append(keys, llmproxy.Key{
+			Name: "default",
+			Key:  c.APIKey,
+		})
+	}
+
+	return llmproxy.Run(cmd.Context(), llmproxy.Options{
+		Options:          opts,
+		ListenAddress:    c.Address,
+		Keys:             keys,
+		LogFile:          c.LogFile,
+		AllowedProviders: c.AllowedProviders,
+	})
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cmd2 "github.com/gptscript-ai/cmd"
+	"github.com/gptscript-ai/gptscript/pkg/memory"
+	"github.com/spf13/cobra"
+)
+
+type Memory struct {
+	root          *GPTScript
+	AllNamespaces bool `usage:"List memories in all namespaces" local:"true"`
+}
+
+func (c *Memory) Customize(cmd *cobra.Command) {
+	cmd.Use = "memory"
+	cmd.Aliases = []string{"memories"}
+	cmd.Short = "List the memories saved by the sys.memory tools"
+	cmd.Args = cobra.NoArgs
+	cmd.AddCommand(cmd2.Command(&MemoryExport{root: c.root}))
+	cmd.AddCommand(cmd2.Command(&MemoryClear{root: c.root}))
+}
+
+// memoryNamespaces returns the namespaces a memory command works on.
+func memoryNamespaces(store *memory.Store, namespace string, all bool) ([]string, error) {
+	if all {
+		return store.Namespaces()
+	}
+	if namespace == "" {
+		namespace = memory.DefaultNamespace
+	}
+	return []string{namespace}, memory.ValidateNamespace(namespace)
+}
+
+func (c *Memory) Run(_ *cobra.Command, _ []string) error {
+	store := memory.New("")
+	namespaces, err := memoryNamespaces(store, c.root.MemoryNamespace, c.AllNamespaces)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 10, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	if c.AllNamespaces {
+		_, _ = w.Write([]byte("NAMESPACE\tKEY\tVALUE\tUPDATED\n"))
+	} else {
+		_, _ = w.Write([]byte("KEY\tVALUE\tUPDATED\n"))
+	}
+
+	for _, namespace := range namespaces {
+		entries, err := store.List(namespace)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			value := strings.ReplaceAll(entry.Value, "\n", " ")
+			if len(value) > 60 {
+				value = value[:57] + "..."
+			}
+
+			fields := []any{entry.Key, value, entry.UpdatedAt.Local().Format(time.DateTime)}
+			if c.AllNamespaces {
+				fields = append([]any{namespace}, fields...)
+			}
+			printFields(w, fields)
+		}
+	}
+
+	return nil
+}
+
+type MemoryExport struct {
+	root          *GPTScript
+	AllNamespaces bool `usage:"Export memories in all namespaces" local:"true"`
+}
+
+func (c *MemoryExport) Customize(cmd *cobra.Command) {
+	cmd.Use = "export"
+	cmd.Short = "Print the saved memories as JSON"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *MemoryExport) Run(_ *cobra.Command, _ []string) error {
+	store := memory.New("")
+	namespaces, err := memoryNamespaces(store, c.root.MemoryNamespace, c.AllNamespaces)
+	if err != nil {
+		return err
+	}
+
+	result := map[string][]memory.Entry{}
+	for _, namespace := range namespaces {
+		entries, err := store.List(namespace)
+		if err != nil {
+			return err
+		}
+		result[namespace] = entries
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+type MemoryClear struct {
+	root          *GPTScript
+	AllNamespaces bool `usage:"Clear memories in all namespaces" local:"true"`
+}
+
+func (c *MemoryClear) Customize(cmd *cobra.Command) {
+	cmd.Use = "clear"
+	cmd.SilenceUsage = true
+	cmd.Short = "Delete the saved memories"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *MemoryClear) Run(_ *cobra.Command, _ []string) error {
+	store := memory.New("")
+	namespaces, err := memoryNamespaces(store, c.root.MemoryNamespace, c.AllNamespaces)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		if err := store.Clear(namespace); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared memory namespace %s\n", namespace)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+const checkpointRunFile = "run.json"
+
+// checkpointRun is what is needed to load the program of a checkpointed run again.
+type checkpointRun struct {
+	Program   string `json:"program,omitempty"`
+	Source    string `json:"source,omitempty"`
+	SubTool   string `json:"subTool,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+}
+
+func writeCheckpointRun(dir string, run checkpointRun) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, checkpointRunFile), data, 0600)
+}
+
+func readCheckpointRun(dir string) (run checkpointRun, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointRunFile))
+	if err != nil {
+		return run, fmt.Errorf("failed to read checkpoint %s: %w", dir, err)
+	}
+	return run, json.Unmarshal(data, &run)
+}
+
+// checkpointRunFor records the program of a run. Local files are saved by absolute path so that the run can be resumed
+// from any directory, everything else is loaded again from the same location.
+func (r *GPTScript) checkpointRunFor(location string) (checkpointRun, error) {
+	run := checkpointRun{
+		SubTool:   r.SubTool,
+		Workspace: r.Workspace,
+	}
+	if !strings.Contains(run.Workspace, "://") && !strings.HasPrefix(run.Workspace, "~") {
+		abs, err := filepath.Abs(run.Workspace)
+		if err != nil {
+			return run, err
+		}
+		run.Workspace = abs
+	}
+
+	if location == "-" {
+		run.Source = string(r.readData)
+		return run, nil
+	}
+
+	run.Program = location
+	if _, err := os.Stat(location); err == nil {
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return run, err
+		}
+		run.Program = abs
+	}
+	return run, nil
+}
+
+type Resume struct {
+	gptscript *GPTScript
+}
+
+func (e *Resume) Customize(cmd *cobra.Command) {
+	cmd.Use = "resume CHECKPOINT_DIR"
+	cmd.Short = "Resume a run from the checkpoint written by --checkpoint-dir"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (e *Resume) Run(cmd *cobra.Command, args []string) error {
+	dir := args[0]
+	run, err := readCheckpointRun(dir)
+	if err != nil {
+		return err
+	}
+
+	e.gptscript.Workspace = run.Workspace
+	opts, err := e.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	g, err := gptscript.New(cmd.Context(), opts)
+	if err != nil {
+		return err
+	}
+	defer g.Close(true)
+
+	var prg types.Program
+	if run.Program == "" {
+		prg, err = loader.ProgramFromSource(cmd.Context(), run.Source, run.SubTool, loader.Options{
+			Cache: g.Cache,
+		})
+	} else {
+		prg, err = loader.Program(cmd.Context(), run.Program, run.SubTool, loader.Options{
+			Cache: g.Cache,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := runner.ReadCheckpoint(dir)
+	if err != nil {
+		return err
+	}
+
+	s, err := g.Run(cmd.Context(), prg, opts.Env, checkpoint.Input, runner.RunOptions{
+		CheckpointDir: dir,
+		Resume:        true,
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.gptscript.PrintOutput(checkpoint.Input, s)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/sdkserver"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
@@ -35,8 +36,17 @@ func (c *SDKServer) Run(cmd *cobra.Command, _ []string) error {
 		ctx = cmd.Context()
 	}
 
+	var policy *auth.Policy
+	if c.AuthPolicy != "" {
+		policy, err = auth.ReadPolicy(c.AuthPolicy)
+		if err != nil {
+			return err
+		}
+	}
+
 	return sdkserver.Run(ctx, sdkserver.Options{
 		Options:       opts,
+		AuthPolicy:    policy,
 		ListenAddress: c.ListenAddress,
 		Debug:         c.Debug,
 		DatasetTool:   c.DatasetTool,
@@ -56,9 +56,35 @@ func (a *AuthConfig) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// ModelAlias is a model, and optionally the provider of the model, that tools can use by the name of the alias. The
+// temperature and max tokens are used when the tool doesn't set them.
+type ModelAlias struct {
+	Model       string   `json:"model"`
+	Provider    string   `json:"provider,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+}
+
+// ModelAliases maps alias names, like "fast" or "smart", to models.
+type ModelAliases map[string]ModelAlias
+
+// Resolve returns the model name that name is an alias for, in the "model from provider" form if the alias has a
+// provider, and the alias. Names that aren't aliases are returned unchanged.
+func (m ModelAliases) Resolve(name string) (string, ModelAlias, bool) {
+	alias, ok := m[strings.TrimSpace(name)]
+	if !ok || alias.Model == "" {
+		return name, ModelAlias{}, false
+	}
+	if alias.Provider != "" {
+		return alias.Model + " from " + alias.Provider, alias, true
+	}
+	return alias.Model, alias, true
+}
+
 type CLIConfig struct {
 	Auths            map[string]AuthConfig `json:"auths,omitempty"`
 	CredentialsStore string                `json:"credsStore,omitempty"`
+	Models           ModelAliases          `json:"models,omitempty"`
 
 	raw       []byte
 	auths     map[string]types.AuthConfig
@@ -62,9 +62,11 @@ type Return struct {
 }
 
 type Call struct {
-	Missing bool   `json:"missing,omitempty"`
-	ToolID  string `json:"toolID,omitempty"`
-	Input   string `json:"input,omitempty"`
+	Missing bool `json:"missing,omitempty"`
+	// NotForced is set when the tool choice forced the model to call another tool.
+	NotForced bool   `json:"notForced,omitempty"`
+	ToolID    string `json:"toolID,omitempty"`
+	Input     string `json:"input,omitempty"`
 }
 
 type CallResult struct {
@@ -121,6 +123,7 @@ const (
 	ContextToolCategory    ToolCategory = "context"
 	InputToolCategory      ToolCategory = "input"
 	OutputToolCategory     ToolCategory = "output"
+	HookToolCategory       ToolCategory = "hook"
 	NoCategory             ToolCategory = ""
 )
 
@@ -296,6 +299,10 @@ func populateMessageParams(ctx Context, completion *types.CompletionRequest, too
 	completion.Cache = tool.Cache
 	completion.Chat = tool.Chat
 	completion.Temperature = tool.Temperature
+	completion.Compaction = tool.Compaction
+	completion.CompactionModel = tool.CompactionModel
+	completion.ReasoningEffort = tool.ReasoningEffort
+	completion.ParallelToolCalls = tool.ParallelToolCalls
 	completion.InternalSystemPrompt = tool.InternalPrompt
 
 	if tool.Chat && completion.InternalSystemPrompt == nil {
@@ -308,10 +315,40 @@ func populateMessageParams(ctx Context, completion *types.CompletionRequest, too
 		return err
 	}
 
+	completion.ToolChoice, err = toolChoice(*ctx.Program, tool, completion.Tools)
+	if err != nil {
+		return err
+	}
+
+	// The tool definitions and the system message stay the same for the whole conversation, so providers can cache them.
+	completion.CacheTools = len(completion.Tools) > 0
 	completion.Messages = addUpdateSystem(ctx, tool, completion.Messages)
 	return nil
 }
 
+// toolChoice returns the tool choice of the tool, with the name of a tool turned into the name of its function.
+func toolChoice(prg types.Program, tool types.Tool, tools []types.ChatCompletionTool) (string, error) {
+	choice := tool.ToolChoice
+	switch choice {
+	case "", types.ToolChoiceAuto, types.ToolChoiceNone, types.ToolChoiceRequired:
+		return choice, nil
+	}
+
+	if refs, err := tool.GetToolRefsFromNames([]string{choice}); err == nil && len(refs) == 1 {
+		for _, t := range tools {
+			if t.Function.ToolID == refs[0].ToolID {
+				return t.Function.Name, nil
+			}
+		}
+	}
+	for _, t := range tools {
+		if strings.EqualFold(t.Function.Name, choice) || t.Function.Name == types.ToolNormalizer(choice) {
+			return t.Function.Name, nil
+		}
+	}
+	return "", fmt.Errorf("tool choice %s is not one of the tools of %s", choice, types.FirstSet(tool.Name, prg.Name))
+}
+
 func (e *Engine) runMCPInvoke(ctx Context, tool types.Tool, input string) (*Return, error) {
 	output, err := e.MCPRunner.Run(ctx, e.Progress, tool, input)
 	if err != nil {
@@ -383,9 +420,13 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, err error) {
 	}
 
 	if input != "" {
+		content, err := userContent(input)
+		if err != nil {
+			return nil, err
+		}
 		completion.Messages = append(completion.Messages, types.CompletionMessage{
 			Role:    types.CompletionMessageRoleTypeUser,
-			Content: types.Text(input),
+			Content: content,
 		})
 	}
 
@@ -411,8 +452,9 @@ func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessag
 	}
 
 	msg := types.CompletionMessage{
-		Role:    types.CompletionMessageRoleTypeSystem,
-		Content: types.Text(strings.Join(instructions, "\n")),
+		Role:         types.CompletionMessageRoleTypeSystem,
+		Content:      types.Text(strings.Join(instructions, "\n")),
+		CacheControl: true,
 	}
 
 	if len(msgs) > 0 && msgs[0].Role == types.CompletionMessageRoleTypeSystem {
@@ -475,7 +517,14 @@ func (e *Engine) complete(ctx Context, state *State) (*Return, error) {
 		return &ret, nil
 	}
 
-	resp, err := e.Model.Call(ctx.WrappedContext(e), state.Completion, e.Env, progress)
+	completion := state.Completion
+	if messagesSinceLastUserMessage > 0 && completion.ForcesToolCall() {
+		// The tool choice only forces the first tool call after the user message, otherwise the model could never
+		// answer.
+		completion.ToolChoice = types.ToolChoiceAuto
+	}
+
+	resp, err := e.Model.Call(ctx.WrappedContext(e), completion, e.Env, progress)
 	if err != nil {
 		return nil, fmt.Errorf("failed calling model for completion: %w", err)
 	}
@@ -500,19 +549,22 @@ func (e *Engine) complete(ctx Context, state *State) (*Return, error) {
 				missing = true
 			}
 			state.Pending[content.ToolCall.ID] = *content.ToolCall
+			forced := completion.ForcedFunction()
 			ret.Calls[content.ToolCall.ID] = Call{
-				ToolID:  toolID,
-				Missing: missing,
-				Input:   content.ToolCall.Function.Arguments,
+				ToolID:    toolID,
+				Missing:   missing,
+				NotForced: forced != "" && !strings.EqualFold(forced, content.ToolCall.Function.Name),
+				Input:     content.ToolCall.Function.Arguments,
 			}
-		} else {
+		} else if content.Reasoning == nil {
 			cp := content.Text
 			ret.Result = &cp
 		}
 	}
 
-	if len(resp.Content) == 0 {
-		// This can happen if the LLM return no content at all. You can reproduce by just saying, "return an empty response"
+	if ret.Result == nil && len(ret.Calls) == 0 {
+		// This can happen if the LLM return no content at all, or only reasoning. You can reproduce by just saying,
+		// "return an empty response"
 		empty := ""
 		ret.Result = &empty
 	}
@@ -554,10 +606,14 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (ret
 
 	for _, result := range results {
 		if result.CallID == "" {
+			content, err := userContent(result.User)
+			if err != nil {
+				return nil, err
+			}
 			added = true
 			state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
 				Role:    types.CompletionMessageRoleTypeUser,
-				Content: types.Text(result.User),
+				Content: content,
 			})
 		} else {
 			state.Results[result.CallID] = result
@@ -602,7 +658,7 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (ret
 		added = true
 		state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
 			Role:     types.CompletionMessageRoleTypeTool,
-			Content:  types.Text(result.Result),
+			Content:  types.Content(result.Result),
 			ToolCall: &pending,
 		})
 	}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// attachmentRegex matches a line with only a markdown image of an "attach:" target, like "![chart](attach:./chart.png)",
+// which attaches the image or file at the local path or URL to the message. Other markdown images are left as text.
+var attachmentRegex = regexp.MustCompile(`^!\[([^]]*)]\(attach:([^)\s]+)\)$`)
+
+// userContent returns the content of a user message. Markdown images of "attach:" targets on their own line are
+// attached, as well as base64 data URLs. A line that attaches a local file that does not exist is kept as text.
+func userContent(text string) ([]types.ContentPart, error) {
+	var (
+		result []types.ContentPart
+		lines  []string
+	)
+	flush := func() {
+		if len(lines) > 0 {
+			for _, part := range types.Content(strings.Join(lines, "\n")) {
+				if part.Image != nil || part.File != nil || strings.TrimSpace(part.Text) != "" {
+					result = append(result, part)
+				}
+			}
+			lines = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		match := attachmentRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		media, err := attachment(match[1], match[2])
+		if errors.Is(err, fs.ErrNotExist) {
+			lines = append(lines, line)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		flush()
+		result = append(result, types.MediaPart(media))
+	}
+
+	if len(result) == 0 {
+		return types.Content(text), nil
+	}
+	flush()
+	return result, nil
+}
+
+func attachment(name, target string) (types.Media, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(strings.SplitN(target, "?", 2)[0])))
+		return types.Media{
+			URL:      target,
+			MimeType: types.FirstSet(mimeType, "image/png"),
+			Name:     name,
+		}, nil
+	}
+
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return types.Media{}, fmt.Errorf("failed to attach %s: %w", target, err)
+	}
+	name = types.FirstSet(name, filepath.Base(target))
+	mimeType := types.MimeType(target, data)
+	return types.Media{
+		URL:      types.DataURL(mimeType, name, data),
+		MimeType: mimeType,
+		Name:     name,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserContent(t *testing.T) {
+	content, err := userContent("Just text\n![not an attachment](attach:x.png) in a line\n![not attached](x.png)")
+	require.NoError(t, err)
+	assert.Equal(t, types.Text("Just text\n![not an attachment](attach:x.png) in a line\n![not attached](x.png)"), content)
+
+	file := filepath.Join(t.TempDir(), "chart.png")
+	require.NoError(t, os.WriteFile(file, []byte("hi"), 0644))
+
+	content, err = userContent("Compare these\n![](attach:" + file + ")\n![logo](attach:https://example.com/logo.jpg?size=2)\n")
+	require.NoError(t, err)
+	assert.Equal(t, []types.ContentPart{
+		{Text: "Compare these"},
+		{Image: &types.Media{URL: "data:image/png;name=chart.png;base64,aGk=", MimeType: "image/png", Name: "chart.png"}},
+		{Image: &types.Media{URL: "https://example.com/logo.jpg?size=2", MimeType: "image/jpeg", Name: "logo"}},
+	}, content)
+
+	// A missing file is not attached, and the line is kept as text.
+	missing := "Look at this\n![](attach:" + filepath.Join(t.TempDir(), "missing.png") + ")"
+	content, err = userContent(missing)
+	require.NoError(t, err)
+	assert.Equal(t, types.Text(missing), content)
+}
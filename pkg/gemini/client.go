@@ -0,0 +1,843 @@
+// Package gemini is a client for the generateContent API of Google Gemini, so that Gemini models can be used without
+// an OpenAI compatible endpoint or a model provider tool.
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	WaitingMessage = "Waiting for model response..."
+
+	modelPrefix = "gemini-"
+)
+
+// IsModel returns whether modelName is the name of a Gemini model, and not a model of a provider tool.
+func IsModel(modelName string) bool {
+	_, provider := types.SplitToolRef(modelName)
+	return provider == "" && strings.HasPrefix(modelName, modelPrefix)
+}
+
+type Options struct {
+	BaseURL string `usage:"Gemini API base URL" name:"gemini-base-url" env:"GEMINI_BASE_URL"`
+	APIKey  string `usage:"Gemini API key, Gemini models are called directly when it is set" name:"gemini-api-key" env:"GEMINI_API_KEY"`
+	Cache   *cache.Client
+}
+
+func Complete(opts ...Options) (result Options) {
+	for _, opt := range opts {
+		result.BaseURL = types.FirstSet(opt.BaseURL, result.BaseURL)
+		result.APIKey = types.FirstSet(opt.APIKey, result.APIKey)
+		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+	}
+	return result
+}
+
+func envAPIKey() string {
+	return types.FirstSet(os.Getenv("GEMINI_API_KEY"), os.Getenv("GOOGLE_API_KEY"))
+}
+
+func complete(opts ...Options) (Options, error) {
+	var err error
+	result := Complete(opts...)
+	if result.Cache == nil {
+		result.Cache, err = cache.New(cache.Options{
+			DisableCache: true,
+		})
+	}
+
+	result.BaseURL = types.FirstSet(result.BaseURL, os.Getenv("GEMINI_BASE_URL"), DefaultBaseURL)
+	result.APIKey = types.FirstSet(result.APIKey, envAPIKey())
+	return result, err
+}
+
+// Configured returns whether an API key is set in the options, or in GEMINI_API_KEY or GOOGLE_API_KEY.
+func Configured(opts ...Options) bool {
+	return types.FirstSet(Complete(opts...).APIKey, envAPIKey()) != ""
+}
+
+type Client struct {
+	baseURL      string
+	apiKey       string
+	cache        *cache.Client
+	cacheKeyBase string
+	http         *http.Client
+}
+
+func NewClient(opts ...Options) (*Client, error) {
+	opt, err := complete(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL:      strings.TrimSuffix(opt.BaseURL, "/"),
+		apiKey:       opt.APIKey,
+		cache:        opt.Cache,
+		cacheKeyBase: hash.ID(opt.APIKey, opt.BaseURL),
+		http:         http.DefaultClient,
+	}, nil
+}
+
+func (c *Client) Supports(_ context.Context, modelName string) (bool, error) {
+	return IsModel(modelName), nil
+}
+
+func (c *Client) ListModels(ctx context.Context, providers ...string) ([]openai.Model, error) {
+	// Only serve if providers is empty or "" is in the list
+	if len(providers) != 0 && !slices.Contains(providers, "") {
+		return nil, nil
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/models?pageSize=1000", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
+	}
+
+	var list struct {
+		Models []struct {
+			Name                       string   `json:"name"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	models := make([]openai.Model, 0, len(list.Models))
+	for _, m := range list.Models {
+		if !slices.Contains(m.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		models = append(models, openai.Model{
+			ID:      strings.TrimPrefix(m.Name, "models/"),
+			Object:  "model",
+			OwnedBy: "google",
+		})
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+	return models, nil
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var content io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, content)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Goog-Api-Key", c.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// APIError is an error response of the Gemini API.
+type APIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("gemini API error (status %d, %s): %s", e.StatusCode, e.Status, e.Message)
+}
+
+// Retryable returns whether another model might not have the error: a rate limit, an unavailable or failing server,
+// or a prompt with too many tokens.
+func (e *APIError) Retryable() bool {
+	switch {
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= http.StatusInternalServerError:
+		return true
+	case e.Status == "RESOURCE_EXHAUSTED", e.Status == "UNAVAILABLE", e.Status == "INTERNAL":
+		return true
+	}
+	return e.Status == "INVALID_ARGUMENT" && strings.Contains(e.Message, "exceeds the maximum number of tokens")
+}
+
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func newAPIError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	// Errors are sometimes sent as a list with one error.
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err == nil && len(list) > 0 {
+			data = list[0]
+		}
+	}
+
+	var body struct {
+		Error errorBody `json:"error"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil || body.Error.Message == "" {
+		return &APIError{StatusCode: resp.StatusCode, Status: "UNKNOWN", Message: string(data)}
+	}
+	return &APIError{StatusCode: resp.StatusCode, Status: body.Error.Status, Message: body.Error.Message}
+}
+
+type request struct {
+	Contents          []content         `json:"contents"`
+	SystemInstruction *content          `json:"systemInstruction,omitempty"`
+	Tools             []tool            `json:"tools,omitempty"`
+	ToolConfig        *toolConfig       `json:"toolConfig,omitempty"`
+	GenerationConfig  *generationConfig `json:"generationConfig,omitempty"`
+}
+
+type content struct {
+	Role  string `json:"role,omitempty"`
+	Parts []part `json:"parts"`
+}
+
+type part struct {
+	Text             string            `json:"text,omitempty"`
+	InlineData       *inlineData       `json:"inlineData,omitempty"`
+	FileData         *fileData         `json:"fileData,omitempty"`
+	FunctionCall     *functionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *functionResponse `json:"functionResponse,omitempty"`
+	// Thought is set on parts with the reasoning of thinking models, which are not part of the answer.
+	Thought bool `json:"thought,omitempty"`
+}
+
+type inlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type fileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type functionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type functionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type tool struct {
+	FunctionDeclarations []functionDeclaration `json:"functionDeclarations"`
+}
+
+type functionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type generationConfig struct {
+	Temperature      *float32        `json:"temperature,omitempty"`
+	MaxOutputTokens  int             `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ThinkingConfig   *thinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type toolConfig struct {
+	FunctionCallingConfig functionCallingConfig `json:"functionCallingConfig"`
+}
+
+type functionCallingConfig struct {
+	Mode                 string   `json:"mode"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+}
+
+type thinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts"`
+}
+
+// toRequest translates a completion request to a generateContent request. System messages are joined into the
+// system instruction, and tool results are sent as function responses of the user, merged with the messages around
+// them because the roles of the messages have to alternate.
+func toRequest(messageRequest types.CompletionRequest) (request, error) {
+	var (
+		systemPrompts []string
+		contents      []content
+	)
+
+	if messageRequest.InternalSystemPrompt == nil || *messageRequest.InternalSystemPrompt {
+		systemPrompts = append(systemPrompts, system.InternalSystemPrompt)
+	}
+
+	for _, msg := range messageRequest.Messages {
+		var (
+			role  = "user"
+			parts []part
+		)
+		switch msg.Role {
+		case types.CompletionMessageRoleTypeSystem:
+			if len(msg.Content) > 0 {
+				systemPrompts = append(systemPrompts, msg.Content[0].Text)
+			}
+			continue
+		case types.CompletionMessageRoleTypeAssistant:
+			role = "model"
+		}
+
+		if msg.Role == types.CompletionMessageRoleTypeTool && msg.ToolCall != nil {
+			parts = append(parts, functionResponseParts(msg)...)
+		} else {
+			for _, c := range msg.Content {
+				if c.Text != "" {
+					text := c.Text
+					if prompt, ok := system.IsDefaultPrompt(text); ok {
+						text = prompt
+					}
+					parts = append(parts, textToParts(text)...)
+				}
+				if c.Image != nil || c.File != nil {
+					parts = append(parts, mediaPart(c))
+				}
+				if c.ToolCall != nil {
+					parts = append(parts, functionCallPart(*c.ToolCall))
+				}
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+		if !messageRequest.Chat && len(parts) == 1 && parts[0].FunctionResponse == nil && parts[0].InlineData == nil &&
+			parts[0].FileData == nil && parts[0].FunctionCall == nil && strings.TrimSpace(parts[0].Text) == "{}" {
+			continue
+		}
+
+		if len(contents) > 0 && contents[len(contents)-1].Role == role {
+			contents[len(contents)-1].Parts = append(contents[len(contents)-1].Parts, parts...)
+		} else {
+			contents = append(contents, content{Role: role, Parts: parts})
+		}
+	}
+
+	result := request{
+		Contents: contents,
+		GenerationConfig: &generationConfig{
+			Temperature:     messageRequest.Temperature,
+			MaxOutputTokens: messageRequest.MaxTokens,
+		},
+	}
+	if len(systemPrompts) > 0 {
+		result.SystemInstruction = &content{
+			Parts: []part{{Text: strings.Join(systemPrompts, "\n")}},
+		}
+	}
+	if result.GenerationConfig.Temperature == nil {
+		result.GenerationConfig.Temperature = new(float32)
+	}
+	if messageRequest.JSONResponse {
+		result.GenerationConfig.ResponseMimeType = "application/json"
+	}
+	if budget := messageRequest.ReasoningBudget(); budget > 0 {
+		result.GenerationConfig.ThinkingConfig = &thinkingConfig{
+			ThinkingBudget:  budget,
+			IncludeThoughts: true,
+		}
+	}
+
+	if len(messageRequest.Tools) > 0 {
+		var declarations []functionDeclaration
+		for _, t := range messageRequest.Tools {
+			declaration := functionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+			}
+			// Functions without parameters must not declare an empty object.
+			if t.Function.Parameters != nil && len(t.Function.Parameters.Properties) > 0 {
+				params, err := toSchema(t.Function.Parameters)
+				if err != nil {
+					return request{}, fmt.Errorf("invalid parameters for tool %s: %w", t.Function.Name, err)
+				}
+				declaration.Parameters = params
+			}
+			declarations = append(declarations, declaration)
+		}
+		result.Tools = []tool{{FunctionDeclarations: declarations}}
+		result.ToolConfig = toToolConfig(messageRequest)
+	}
+
+	return result, nil
+}
+
+// toToolConfig returns the function calling mode of the tool choice. Gemini can't turn off parallel function calls.
+func toToolConfig(messageRequest types.CompletionRequest) *toolConfig {
+	var config functionCallingConfig
+	switch {
+	case messageRequest.ToolChoice == types.ToolChoiceNone:
+		config.Mode = "NONE"
+	case messageRequest.ToolChoice == types.ToolChoiceRequired:
+		config.Mode = "ANY"
+	case messageRequest.ForcedFunction() != "":
+		config.Mode = "ANY"
+		config.AllowedFunctionNames = []string{messageRequest.ForcedFunction()}
+	default:
+		return nil
+	}
+	return &toolConfig{FunctionCallingConfig: config}
+}
+
+// schemaKeys are the keys of a JSON schema that the Gemini API understands. It rejects schemas with other keys.
+var schemaKeys = []string{"type", "format", "description", "nullable", "enum", "properties", "required", "items",
+	"minItems", "maxItems", "minimum", "maximum", "anyOf", "propertyOrdering"}
+
+// toSchema converts a JSON schema to the subset of the OpenAPI schema that the Gemini API supports.
+func toSchema(schema any) (map[string]any, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return cleanSchema(obj), nil
+}
+
+func cleanSchema(schema map[string]any) map[string]any {
+	result := make(map[string]any, len(schema))
+	for k, v := range schema {
+		if !slices.Contains(schemaKeys, k) {
+			continue
+		}
+		switch k {
+		case "properties":
+			props, _ := v.(map[string]any)
+			cleaned := make(map[string]any, len(props))
+			for name, prop := range props {
+				if propSchema, ok := prop.(map[string]any); ok {
+					cleaned[name] = cleanSchema(propSchema)
+				}
+			}
+			v = cleaned
+		case "items":
+			if items, ok := v.(map[string]any); ok {
+				v = cleanSchema(items)
+			}
+		case "anyOf":
+			list, _ := v.([]any)
+			var cleaned []any
+			for _, item := range list {
+				if itemSchema, ok := item.(map[string]any); ok {
+					cleaned = append(cleaned, cleanSchema(itemSchema))
+				}
+			}
+			v = cleaned
+		case "type":
+			// A list of types, like ["string", "null"], is a nullable type.
+			if list, ok := v.([]any); ok {
+				for _, t := range list {
+					if t == "null" {
+						result["nullable"] = true
+					} else {
+						v = t
+					}
+				}
+			}
+		}
+		result[k] = v
+	}
+	return result
+}
+
+func functionCallPart(call types.CompletionToolCall) part {
+	// The arguments of a function call must be a JSON object.
+	args := json.RawMessage(call.Function.Arguments)
+	if strings.TrimSpace(call.Function.Arguments) == "" {
+		args = json.RawMessage("{}")
+	} else if !json.Valid(args) || !strings.HasPrefix(strings.TrimSpace(call.Function.Arguments), "{") {
+		args, _ = json.Marshal(map[string]string{"input": call.Function.Arguments})
+	}
+	return part{
+		FunctionCall: &functionCall{
+			Name: call.Function.Name,
+			Args: args,
+		},
+	}
+}
+
+// functionResponseParts returns the function response of a tool message. A function response only holds text, so
+// the images and files that the tool returned follow it as parts of their own.
+func functionResponseParts(msg types.CompletionMessage) []part {
+	var (
+		text  []string
+		media []part
+	)
+	for _, c := range msg.Content {
+		for _, p := range textToParts(c.Text) {
+			if p.Text != "" {
+				text = append(text, p.Text)
+			} else {
+				media = append(media, p)
+			}
+		}
+		if c.Image != nil || c.File != nil {
+			media = append(media, mediaPart(c))
+		}
+	}
+
+	return append([]part{{
+		FunctionResponse: &functionResponse{
+			Name: msg.ToolCall.Function.Name,
+			Response: map[string]any{
+				"output": strings.Join(text, " "),
+			},
+		},
+	}}, media...)
+}
+
+// textToParts turns the images and files that are in a text as data URLs, one per line, into inline data parts.
+func textToParts(text string) []part {
+	if text == "" {
+		return nil
+	}
+
+	var parts []part
+	for _, c := range types.Content(text) {
+		if c.Image != nil || c.File != nil {
+			parts = append(parts, mediaPart(c))
+		} else {
+			parts = append(parts, part{Text: c.Text})
+		}
+	}
+	return parts
+}
+
+// mediaPart returns an inline data part for images and PDFs, or a file data part for URLs. Gemini can't read other
+// files, so it is told about them instead.
+func mediaPart(c types.ContentPart) part {
+	media := c.Image
+	if media == nil {
+		media = c.File
+		if media.MimeType != "application/pdf" {
+			return part{
+				Text: fmt.Sprintf("[The file %s (%s) is attached, but this model can't read it]", types.FirstSet(media.Name, "without a name"), media.MimeType),
+			}
+		}
+	}
+
+	if data, ok := media.Base64(); ok {
+		return part{
+			InlineData: &inlineData{
+				MimeType: media.MimeType,
+				Data:     data,
+			},
+		}
+	}
+	return part{
+		FileData: &fileData{
+			MimeType: media.MimeType,
+			FileURI:  media.URL,
+		},
+	}
+}
+
+func (c *Client) cacheKey(model string, request request) any {
+	return map[string]any{
+		"base":    c.cacheKeyBase,
+		"model":   model,
+		"request": request,
+	}
+}
+
+func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if c.apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY is not set. Please set the GEMINI_API_KEY environment variable")
+	}
+
+	request, err := toRequest(messageRequest)
+	if err != nil {
+		return nil, err
+	}
+	if len(request.Contents) == 0 {
+		log.Errorf("invalid request, no messages to send to LLM")
+		return &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(""),
+		}, nil
+	}
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request: map[string]any{
+			"model":           messageRequest.Model,
+			"generateContent": request,
+		},
+	}
+
+	var (
+		result types.CompletionMessage
+		cached bool
+	)
+	if messageRequest.GetCache() {
+		cached, err = c.cache.Get(ctx, c.cacheKey(messageRequest.Model, request), &result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cached {
+		result.Usage = types.Usage{}
+	} else {
+		result, err = c.call(ctx, messageRequest.Model, request, id, status)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     result,
+		Usage:        result.Usage,
+		Cached:       cached,
+	}
+
+	return &result, nil
+}
+
+func (c *Client) call(ctx context.Context, model string, request request, transactionID string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+	partial <- types.CompletionStatus{
+		CompletionID: transactionID,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(WaitingMessage),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if engineCtx, ok := engine.FromContext(ctx); ok {
+		engineCtx.OnUserCancel(ctx, cancel)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/models/"+url.PathEscape(model)+":streamGenerateContent?alt=sse", request)
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	log.Debugf("calling gemini with model %s and %d messages", model, len(request.Contents))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		return types.CompletionMessage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return types.CompletionMessage{}, newAPIError(resp)
+	}
+
+	var (
+		stream stream
+		start  = time.Now()
+	)
+	err = readEvents(resp.Body, func(data []byte) error {
+		if err := stream.add(data); err != nil {
+			return err
+		}
+		if partial != nil && time.Since(start) > 100*time.Millisecond {
+			msg := stream.message()
+			partial <- types.CompletionStatus{
+				CompletionID:    transactionID,
+				PartialResponse: &msg,
+			}
+			start = time.Now()
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		// The cache won't save the response if the context was canceled.
+		return stream.message(), nil
+	} else if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	result := stream.message()
+	return result, c.cache.Store(ctx, c.cacheKey(model, request), result)
+}
+
+// readEvents reads server-sent events and calls fn with the data of each event.
+func readEvents(r io.Reader, fn func(data []byte) error) error {
+	var (
+		scanner = bufio.NewScanner(r)
+		data    []byte
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := fn(data); err != nil {
+					return err
+				}
+			}
+			data = nil
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return fn(data)
+	}
+	return nil
+}
+
+// stream collects the thoughts, text, function calls and usage of a streamed response.
+type stream struct {
+	thoughts strings.Builder
+	text     strings.Builder
+	calls    []functionCall
+	usage    types.Usage
+}
+
+type response struct {
+	Candidates []struct {
+		Content      content `json:"content"`
+		FinishReason string  `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		// CachedContentTokenCount is the part of the prompt that was read from the cache, which Gemini does
+		// implicitly for repeated prefixes.
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+		TotalTokenCount         int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *errorBody `json:"error"`
+}
+
+func (s *stream) add(data []byte) error {
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid response from gemini: %w", err)
+	}
+	if resp.Error != nil {
+		return &APIError{StatusCode: resp.Error.Code, Status: resp.Error.Status, Message: resp.Error.Message}
+	}
+
+	// The usage is cumulative, so the last one wins.
+	if u := resp.UsageMetadata; u.TotalTokenCount > 0 {
+		s.usage = types.Usage{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+			ReasoningTokens:  u.ThoughtsTokenCount,
+			CacheReadTokens:  u.CachedContentTokenCount,
+		}
+	}
+
+	if len(resp.Candidates) == 0 {
+		return nil
+	}
+	for _, p := range resp.Candidates[0].Content.Parts {
+		switch {
+		case p.Thought:
+			s.thoughts.WriteString(p.Text)
+		case p.FunctionCall != nil:
+			s.calls = append(s.calls, *p.FunctionCall)
+		case p.Text != "":
+			s.text.WriteString(p.Text)
+		}
+	}
+	return nil
+}
+
+func (s *stream) message() types.CompletionMessage {
+	msg := types.CompletionMessage{
+		Role:  types.CompletionMessageRoleTypeAssistant,
+		Usage: s.usage,
+	}
+	if s.thoughts.Len() > 0 {
+		msg.Content = append(msg.Content, types.ContentPart{Reasoning: &types.Reasoning{Text: s.thoughts.String()}})
+	}
+	if s.text.Len() > 0 {
+		msg.Content = append(msg.Content, types.ContentPart{Text: s.text.String()})
+	}
+	for _, call := range s.calls {
+		args := string(call.Args)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		// Gemini doesn't always give function calls an ID, but the tool results have to be matched to them.
+		id := call.ID
+		if id == "" {
+			id = "call_" + hash.ID(call.Name, args, strconv.Itoa(len(msg.Content)))[:8]
+		}
+		msg.Content = append(msg.Content, types.ContentPart{
+			ToolCall: &types.CompletionToolCall{
+				Index: ptr(len(msg.Content)),
+				ID:    id,
+				Function: types.CompletionFunctionCall{
+					Name:      call.Name,
+					Arguments: args,
+				},
+			},
+		})
+	}
+	return msg
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,245 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	humav2 "github.com/danielgtaylor/huma/v2"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsModel(t *testing.T) {
+	assert.True(t, IsModel("gemini-2.5-pro"))
+	assert.False(t, IsModel("gpt-4o"))
+	assert.False(t, IsModel("gemini-2.5-pro from github.com/gptscript-ai/gemini-aistudio-provider"))
+}
+
+func TestToRequest(t *testing.T) {
+	req, err := toRequest(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		JSONResponse:         true,
+		MaxTokens:            1000,
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("Be brief.")},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("What is in this picture?\ndata:image/png;base64,xxxx")},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{ToolCall: &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "describe", Arguments: `{"detail":"high"}`}}},
+				{ToolCall: &types.CompletionToolCall{ID: "call_2", Function: types.CompletionFunctionCall{Name: "count"}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("A cat"), ToolCall: &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "describe"}}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("1"), ToolCall: &types.CompletionToolCall{ID: "call_2", Function: types.CompletionFunctionCall{Name: "count"}}},
+		},
+		Tools: []types.ChatCompletionTool{
+			{Function: types.CompletionFunctionDefinition{
+				Name:        "describe",
+				Description: "Describes the picture",
+				Parameters: &humav2.Schema{
+					Type: humav2.TypeObject,
+					Properties: map[string]*humav2.Schema{
+						"detail": {Type: humav2.TypeString, Description: "How detailed", Enum: []any{"low", "high"}},
+					},
+					AdditionalProperties: false,
+				},
+			}},
+			{Function: types.CompletionFunctionDefinition{Name: "count"}},
+		},
+	})
+	require.NoError(t, err)
+
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"systemInstruction": {"parts": [{"text": "Be brief."}]},
+		"generationConfig": {"temperature": 0, "maxOutputTokens": 1000, "responseMimeType": "application/json"},
+		"contents": [
+			{"role": "user", "parts": [
+				{"text": "What is in this picture?"},
+				{"inlineData": {"mimeType": "image/png", "data": "xxxx"}}
+			]},
+			{"role": "model", "parts": [
+				{"functionCall": {"name": "describe", "args": {"detail": "high"}}},
+				{"functionCall": {"name": "count", "args": {}}}
+			]},
+			{"role": "user", "parts": [
+				{"functionResponse": {"name": "describe", "response": {"output": "A cat"}}},
+				{"functionResponse": {"name": "count", "response": {"output": "1"}}}
+			]}
+		],
+		"tools": [{"functionDeclarations": [
+			{"name": "describe", "description": "Describes the picture", "parameters": {
+				"type": "object",
+				"properties": {"detail": {"type": "string", "description": "How detailed", "enum": ["low", "high"]}}
+			}},
+			{"name": "count"}
+		]}]
+	}`, string(data))
+}
+
+func TestToRequestThinking(t *testing.T) {
+	req, err := toRequest(types.CompletionRequest{
+		ReasoningEffort: types.ReasoningEffortLow,
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{Reasoning: &types.Reasoning{Text: "The user greets me."}},
+				{Text: "Hello!"},
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &thinkingConfig{ThinkingBudget: 4096, IncludeThoughts: true}, req.GenerationConfig.ThinkingConfig)
+	require.Len(t, req.Contents, 2)
+	assert.Equal(t, []part{{Text: "Hello!"}}, req.Contents[1].Parts)
+}
+
+func TestToRequestToolChoice(t *testing.T) {
+	tools := []types.ChatCompletionTool{{Function: types.CompletionFunctionDefinition{Name: "weather"}}}
+
+	req, err := toRequest(types.CompletionRequest{Tools: tools})
+	require.NoError(t, err)
+	assert.Nil(t, req.ToolConfig)
+
+	req, err = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: "weather"})
+	require.NoError(t, err)
+	assert.Equal(t, &toolConfig{FunctionCallingConfig: functionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"weather"}}}, req.ToolConfig)
+
+	req, err = toRequest(types.CompletionRequest{Tools: tools, ToolChoice: types.ToolChoiceNone})
+	require.NoError(t, err)
+	assert.Equal(t, &toolConfig{FunctionCallingConfig: functionCallingConfig{Mode: "NONE"}}, req.ToolConfig)
+}
+
+func TestToRequestMedia(t *testing.T) {
+	req, err := toRequest(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeUser, Content: []types.ContentPart{
+				{Text: "Summarize these"},
+				{Image: &types.Media{URL: "https://example.com/chart.jpg", MimeType: "image/jpeg"}},
+				{File: &types.Media{URL: "data:application/pdf;name=report.pdf;base64,yyyy", MimeType: "application/pdf", Name: "report.pdf"}},
+			}},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{ToolCall: &types.CompletionToolCall{ID: "1", Function: types.CompletionFunctionCall{Name: "screenshot"}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Content("Took a screenshot\ndata:image/webp;base64,xxxx"), ToolCall: &types.CompletionToolCall{ID: "1", Function: types.CompletionFunctionCall{Name: "screenshot"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, req.Contents, 3)
+	assert.Equal(t, []part{
+		{Text: "Summarize these"},
+		{FileData: &fileData{MimeType: "image/jpeg", FileURI: "https://example.com/chart.jpg"}},
+		{InlineData: &inlineData{MimeType: "application/pdf", Data: "yyyy"}},
+	}, req.Contents[0].Parts)
+	assert.Equal(t, []part{
+		{FunctionResponse: &functionResponse{Name: "screenshot", Response: map[string]any{"output": "Took a screenshot"}}},
+		{InlineData: &inlineData{MimeType: "image/webp", Data: "xxxx"}},
+	}, req.Contents[2].Parts)
+}
+
+func TestCleanSchema(t *testing.T) {
+	assert.Equal(t, map[string]any{
+		"type":     "string",
+		"nullable": true,
+	}, cleanSchema(map[string]any{
+		"type":    []any{"string", "null"},
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+	}))
+}
+
+func TestCall(t *testing.T) {
+	var received request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models/gemini-2.5-flash:streamGenerateContent", r.URL.Path)
+		assert.Equal(t, "sse", r.URL.Query().Get("alt"))
+		assert.Equal(t, "test-key", r.Header.Get("X-Goog-Api-Key"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Thinking about it","thought":true}]}}]}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"Checking "}]}}],"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":2,"totalTokenCount":22}}`,
+			`{"candidates":[{"content":{"role":"model","parts":[{"text":"the weather."},{"functionCall":{"name":"weather","args":{"city":"Paris"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":10,"thoughtsTokenCount":5,"cachedContentTokenCount":12,"totalTokenCount":35}}`,
+		} {
+			_, _ = fmt.Fprintf(w, "data: %s\r\n\r\n", chunk)
+		}
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	status := make(chan types.CompletionStatus, 100)
+	result, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:    "gemini-2.5-flash",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Weather in Paris?")}},
+	}, nil, status)
+	require.NoError(t, err)
+
+	require.Len(t, received.Contents, 1)
+
+	require.Len(t, result.Content, 3)
+	assert.Equal(t, &types.Reasoning{Text: "Thinking about it"}, result.Content[0].Reasoning)
+	assert.Equal(t, "Checking the weather.", result.Content[1].Text)
+	require.NotNil(t, result.Content[2].ToolCall)
+	assert.Equal(t, "weather", result.Content[2].ToolCall.Function.Name)
+	assert.Equal(t, `{"city":"Paris"}`, result.Content[2].ToolCall.Function.Arguments)
+	assert.NotEmpty(t, result.Content[2].ToolCall.ID)
+	assert.Equal(t, types.Usage{PromptTokens: 20, CompletionTokens: 15, TotalTokens: 35, ReasoningTokens: 5, CacheReadTokens: 12}, result.Usage)
+
+	close(status)
+	var last types.CompletionStatus
+	for last = range status {
+	}
+	assert.Equal(t, result.Usage, last.Usage)
+}
+
+func TestCallError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`[{"error":{"code":400,"message":"API key not valid","status":"INVALID_ARGUMENT"}}]`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	_, err = c.Call(context.Background(), types.CompletionRequest{
+		Model:    "gemini-2.5-flash",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")}},
+	}, nil, make(chan types.CompletionStatus, 10))
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "INVALID_ARGUMENT", apiErr.Status)
+	assert.Equal(t, "API key not valid", apiErr.Message)
+}
+
+func TestListModels(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/models", r.URL.Path)
+		_, _ = w.Write([]byte(`{"models":[
+			{"name":"models/gemini-2.5-pro","supportedGenerationMethods":["generateContent","countTokens"]},
+			{"name":"models/text-embedding-004","supportedGenerationMethods":["embedContent"]},
+			{"name":"models/gemini-2.5-flash","supportedGenerationMethods":["generateContent"]}
+		]}`))
+	}))
+	defer s.Close()
+
+	c, err := NewClient(Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	models, err := c.ListModels(context.Background())
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+	assert.Equal(t, "gemini-2.5-flash", models[0].ID)
+	assert.Equal(t, "gemini-2.5-pro", models[1].ID)
+}
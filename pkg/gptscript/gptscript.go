@@ -11,12 +11,15 @@ import (
 	"strings"
 
 	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/cassette"
 	"github.com/gptscript-ai/gptscript/pkg/config"
 	context2 "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/gemini"
 	"github.com/gptscript-ai/gptscript/pkg/llm"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/mcp"
@@ -50,6 +53,8 @@ type GPTScript struct {
 type Options struct {
 	Cache                cache.Options
 	OpenAI               openai.Options
+	Anthropic            anthropic.Options
+	Gemini               gemini.Options
 	Monitor              monitor.Options
 	Runner               runner.Options
 	DefaultModelProvider string
@@ -61,6 +66,8 @@ type Options struct {
 	Env                  []string
 	CredentialStore      string
 	CredentialToolsEnv   []string
+	Record               string
+	Replay               string
 }
 
 func Complete(opts ...Options) Options {
@@ -70,6 +77,8 @@ func Complete(opts ...Options) Options {
 		result.Monitor = monitor.Complete(result.Monitor, opt.Monitor)
 		result.Runner = runner.Complete(result.Runner, opt.Runner)
 		result.OpenAI = openai.Complete(result.OpenAI, opt.OpenAI)
+		result.Anthropic = anthropic.Complete(result.Anthropic, opt.Anthropic)
+		result.Gemini = gemini.Complete(result.Gemini, opt.Gemini)
 
 		result.SystemToolsDir = types.FirstSet(opt.SystemToolsDir, result.SystemToolsDir)
 		result.CredentialContexts = opt.CredentialContexts
@@ -80,6 +89,8 @@ func Complete(opts ...Options) Options {
 		result.DisablePromptServer = types.FirstSet(opt.DisablePromptServer, result.DisablePromptServer)
 		result.DefaultModelProvider = types.FirstSet(opt.DefaultModelProvider, result.DefaultModelProvider)
 		result.CredentialStore = types.FirstSet(opt.CredentialStore, result.CredentialStore)
+		result.Record = types.FirstSet(opt.Record, result.Record)
+		result.Replay = types.FirstSet(opt.Replay, result.Replay)
 	}
 
 	if result.Quiet == nil {
@@ -100,7 +111,6 @@ func Complete(opts ...Options) Options {
 
 func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 	opts := Complete(o...)
-	registry := llm.NewRegistry()
 
 	cacheClient, err := cache.New(opts.Cache)
 	if err != nil {
@@ -116,6 +126,8 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		cliCfg.CredentialsStore = opts.CredentialStore
 	}
 
+	registry := llm.NewRegistry(cliCfg.Models)
+
 	if opts.Runner.RuntimeManager == nil {
 		opts.Runner.RuntimeManager = runtimes.Default(cacheClient.CacheDir(), opts.SystemToolsDir)
 	}
@@ -135,6 +147,34 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		return nil, err
 	}
 
+	// Claude and Gemini models are called directly when an Anthropic or Gemini API key is configured. These clients go
+	// first so that the OpenAI models don't have to be listed to find out that they have them.
+	if opts.DefaultModelProvider == "" && anthropic.Configured(opts.Anthropic) {
+		anthropicClient, err := anthropic.NewClient(opts.Anthropic, anthropic.Options{
+			Cache: cacheClient,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := registry.AddClient(anthropicClient); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.DefaultModelProvider == "" && gemini.Configured(opts.Gemini) {
+		geminiClient, err := gemini.NewClient(opts.Gemini, gemini.Options{
+			Cache: cacheClient,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err := registry.AddClient(geminiClient); err != nil {
+			return nil, err
+		}
+	}
+
 	if opts.DefaultModelProvider == "" {
 		oaiClient, err := openai.NewClient(ctx, credStore, opts.OpenAI, openai.Options{
 			Cache:   cacheClient,
@@ -153,7 +193,27 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 		opts.Runner.MonitorFactory = monitor.NewConsole(opts.Monitor, monitor.Options{DebugMessages: *opts.Quiet})
 	}
 
-	runner, err := runner.New(registry, credStore, opts.Runner)
+	var model engine.Model = registry
+	switch {
+	case opts.Record != "" && opts.Replay != "":
+		return nil, fmt.Errorf("record and replay can not be used together")
+	case opts.Record != "":
+		recorder, err := cassette.NewRecorder(registry, opts.Record)
+		if err != nil {
+			return nil, err
+		}
+		model = recorder
+		opts.Runner.CommandHooks = append(opts.Runner.CommandHooks, recorder)
+	case opts.Replay != "":
+		player, err := cassette.Load(opts.Replay)
+		if err != nil {
+			return nil, err
+		}
+		model = player
+		opts.Runner.CommandHooks = append(opts.Runner.CommandHooks, player)
+	}
+
+	runner, err := runner.New(model, credStore, opts.Runner)
 	if err != nil {
 		return nil, err
 	}
@@ -174,7 +234,7 @@ func New(ctx context.Context, o ...Options) (*GPTScript, error) {
 
 	fullEnv := append(opts.Env, extraEnv...)
 
-	remoteClient := remote.New(runner, fullEnv, cacheClient, credStore, opts.DefaultModelProvider)
+	remoteClient := remote.New(runner, fullEnv, cacheClient, credStore, opts.DefaultModelProvider, cliCfg.Models)
 	if err := registry.AddClient(remoteClient); err != nil {
 		closeServer()
 		return nil, err
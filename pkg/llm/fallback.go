@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"errors"
+	"net/http"
+
+	openai2 "github.com/gptscript-ai/chat-completion-client"
+)
+
+// IsRetryable returns whether err is an error of a model that another model might not have: a rate limit, an error of
+// the server or a context that is too long for the model. Errors that are caused by the request itself, like invalid
+// credentials, are not.
+func IsRetryable(err error) bool {
+	var retryable interface {
+		Retryable() bool
+	}
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+
+	var apiErr *openai2.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.HTTPStatusCode) || apiErr.Code == "context_length_exceeded"
+	}
+
+	var reqErr *openai2.RequestError
+	if errors.As(err, &reqErr) {
+		return retryableStatus(reqErr.HTTPStatusCode)
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
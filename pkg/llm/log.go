@@ -0,0 +1,5 @@
+package llm
+
+import "github.com/gptscript-ai/gptscript/pkg/mvl"
+
+var log = mvl.Package()
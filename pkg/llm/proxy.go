@@ -78,6 +78,15 @@ func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		model = builtin.GetDefaultModel()
 	}
 
+	if _, alias, ok := r.aliases.Resolve(model); ok && data != nil {
+		// The provider only knows the model, not the alias.
+		data["model"] = alias.Model
+		if inBytes, err = json.Marshal(data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	c, err := r.getClient(req.Context(), model, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -9,7 +9,10 @@ import (
 
 	"github.com/google/uuid"
 	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
+	"github.com/gptscript-ai/gptscript/pkg/config"
 	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/gemini"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
 	"github.com/gptscript-ai/gptscript/pkg/remote"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -26,11 +29,13 @@ type Registry struct {
 	proxyURL   string
 	proxyLock  sync.Mutex
 	clients    []Client
+	aliases    config.ModelAliases
 }
 
-func NewRegistry() *Registry {
+func NewRegistry(aliases config.ModelAliases) *Registry {
 	return &Registry{
 		proxyToken: env.VarOrDefault("GPTSCRIPT_INTERNAL_PROXY_TOKEN", uuid.New().String()),
+		aliases:    aliases,
 	}
 }
 
@@ -54,12 +59,26 @@ func (r *Registry) ListModels(ctx context.Context, providers ...string) (result
 }
 
 func (r *Registry) fastPath(modelName string) Client {
+	clients := r.clients
+
+	// The clients for one family of models are added first if they are configured, and know their models by name.
+	for len(clients) > 0 {
+		family, ok := modelFamily(clients[0], modelName)
+		if !family {
+			break
+		}
+		if ok {
+			return clients[0]
+		}
+		clients = clients[1:]
+	}
+
 	// This is optimization hack to avoid doing List Models
-	if len(r.clients) == 1 {
-		return r.clients[0]
+	if len(clients) == 1 {
+		return clients[0]
 	}
 
-	if len(r.clients) != 2 {
+	if len(clients) != 2 {
 		return nil
 	}
 
@@ -68,20 +87,52 @@ func (r *Registry) fastPath(modelName string) Client {
 		return nil
 	}
 
-	_, ok := r.clients[0].(*openai.Client)
+	_, ok := clients[0].(*openai.Client)
 	if !ok {
 		return nil
 	}
 
-	_, ok = r.clients[1].(*remote.Client)
+	_, ok = clients[1].(*remote.Client)
 	if !ok {
 		return nil
 	}
 
-	return r.clients[0]
+	return clients[0]
+}
+
+// modelFamily returns whether client only serves one family of models, which it recognizes by name, and whether
+// modelName is one of them.
+func modelFamily(client Client, modelName string) (family, ok bool) {
+	switch client.(type) {
+	case *anthropic.Client:
+		return true, anthropic.IsModel(modelName)
+	case *gemini.Client:
+		return true, gemini.IsModel(modelName)
+	}
+	return false, false
+}
+
+// resolveAlias replaces a model alias of the request with its model, and fills in the temperature and max tokens of
+// the alias that the request doesn't set.
+func (r *Registry) resolveAlias(messageRequest types.CompletionRequest) types.CompletionRequest {
+	model, alias, ok := r.aliases.Resolve(messageRequest.Model)
+	if !ok {
+		return messageRequest
+	}
+
+	log.Debugf("Model alias %s resolves to %s", messageRequest.Model, model)
+	messageRequest.Model = model
+	if messageRequest.Temperature == nil {
+		messageRequest.Temperature = alias.Temperature
+	}
+	if messageRequest.MaxTokens == 0 {
+		messageRequest.MaxTokens = alias.MaxTokens
+	}
+	return messageRequest
 }
 
 func (r *Registry) getClient(ctx context.Context, modelName string, env []string) (Client, error) {
+	modelName, _, _ = r.aliases.Resolve(modelName)
 	if c := r.fastPath(modelName); c != nil {
 		return c, nil
 	}
@@ -122,11 +173,40 @@ func (r *Registry) getClient(ctx context.Context, modelName string, env []string
 	return nil, errors.Join(errs...)
 }
 
+// Call calls the model of the request. If the model is a comma-separated list of fallbacks, the next one is called
+// when a model fails with an error that another model might not have, like a rate limit, a server error or a too long
+// context. The model that was called is set in the Model of the statuses.
 func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
-	if messageRequest.Model == "" {
+	models := types.SplitModels(messageRequest.Model)
+	if len(models) == 0 {
 		return nil, fmt.Errorf("model is required")
 	}
 
+	var errs []error
+	for i, model := range models {
+		messageRequest.Model = model
+		resp, err := r.callModel(ctx, messageRequest, env, status)
+		if err == nil {
+			return resp, nil
+		}
+		if len(models) == 1 {
+			return nil, err
+		}
+
+		errs = append(errs, fmt.Errorf("model %s: %w", model, err))
+		if i == len(models)-1 || !IsRetryable(err) || ctx.Err() != nil {
+			break
+		}
+		log.Infof("Model %s failed, falling back to %s: %v", model, models[i+1], err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (r *Registry) callModel(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	messageRequest = r.resolveAlias(messageRequest)
+	status, done := withModel(messageRequest.Model, status)
+	defer done()
+
 	if c := r.fastPath(messageRequest.Model); c != nil {
 		return c.Call(ctx, messageRequest, env, status)
 	}
@@ -165,3 +245,27 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 	}
 	return nil, errors.Join(errs...)
 }
+
+// withModel returns a channel that sets the model of the statuses sent to it, and forwards them to status. The
+// returned function must be called when no more statuses are sent.
+func withModel(model string, status chan<- types.CompletionStatus) (chan<- types.CompletionStatus, func()) {
+	if status == nil {
+		return nil, func() {}
+	}
+
+	var (
+		withModel = make(chan types.CompletionStatus)
+		done      = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		for s := range withModel {
+			s.Model = model
+			status <- s
+		}
+	}()
+	return withModel, func() {
+		close(withModel)
+		<-done
+	}
+}
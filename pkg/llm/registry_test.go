@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	openai2 "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
+	"github.com/gptscript-ai/gptscript/pkg/config"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	model   string
+	err     error
+	calls   int
+	request types.CompletionRequest
+}
+
+func (f *fakeClient) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	f.calls++
+	f.request = messageRequest
+	if f.err != nil {
+		return nil, f.err
+	}
+	status <- types.CompletionStatus{
+		CompletionID: "1",
+		Response:     messageRequest.Model,
+	}
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text("answer from " + messageRequest.Model),
+	}, nil
+}
+
+func (f *fakeClient) ListModels(context.Context, ...string) ([]openai2.Model, error) {
+	return []openai2.Model{{ID: f.model}}, nil
+}
+
+func (f *fakeClient) Supports(_ context.Context, modelName string) (bool, error) {
+	return modelName == f.model, nil
+}
+
+func newTestRegistry(clients ...Client) *Registry {
+	r := NewRegistry(nil)
+	for _, c := range clients {
+		_ = r.AddClient(c)
+	}
+	return r
+}
+
+func collect(status chan types.CompletionStatus) []types.CompletionStatus {
+	close(status)
+	var result []types.CompletionStatus
+	for s := range status {
+		result = append(result, s)
+	}
+	return result
+}
+
+func TestCallFallback(t *testing.T) {
+	primary := &fakeClient{model: "primary", err: &anthropic.APIError{StatusCode: http.StatusServiceUnavailable, Type: "overloaded_error"}}
+	secondary := &fakeClient{model: "secondary"}
+	r := newTestRegistry(primary, secondary)
+
+	status := make(chan types.CompletionStatus, 10)
+	resp, err := r.Call(context.Background(), types.CompletionRequest{Model: "primary, secondary"}, nil, status)
+	require.NoError(t, err)
+	assert.Equal(t, "answer from secondary", resp.ChatText())
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 1, secondary.calls)
+
+	statuses := collect(status)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "secondary", statuses[0].Model)
+}
+
+func TestCallNoFallbackOnOtherErrors(t *testing.T) {
+	primary := &fakeClient{model: "primary", err: errors.New("invalid API key")}
+	secondary := &fakeClient{model: "secondary"}
+	r := newTestRegistry(primary, secondary)
+
+	_, err := r.Call(context.Background(), types.CompletionRequest{Model: "primary,secondary"}, nil, make(chan types.CompletionStatus, 10))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "model primary: invalid API key")
+	assert.Equal(t, 0, secondary.calls)
+}
+
+func TestCallAllFallbacksFail(t *testing.T) {
+	primary := &fakeClient{model: "primary", err: &openai2.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}}
+	secondary := &fakeClient{model: "secondary", err: &openai2.APIError{HTTPStatusCode: http.StatusBadRequest, Code: "context_length_exceeded", Message: "too long"}}
+	r := newTestRegistry(primary, secondary)
+
+	_, err := r.Call(context.Background(), types.CompletionRequest{Model: "primary, secondary"}, nil, make(chan types.CompletionStatus, 10))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "model primary:")
+	assert.Contains(t, err.Error(), "model secondary:")
+	assert.Equal(t, 1, secondary.calls)
+}
+
+func TestCallSingleModel(t *testing.T) {
+	r := newTestRegistry(&fakeClient{model: "primary"})
+
+	status := make(chan types.CompletionStatus, 10)
+	resp, err := r.Call(context.Background(), types.CompletionRequest{Model: "primary"}, nil, status)
+	require.NoError(t, err)
+	assert.Equal(t, "answer from primary", resp.ChatText())
+	assert.Equal(t, "primary", collect(status)[0].Model)
+
+	_, err = r.Call(context.Background(), types.CompletionRequest{Model: " , "}, nil, status)
+	assert.EqualError(t, err, "model is required")
+}
+
+func TestCallModelAlias(t *testing.T) {
+	temperature := float32(0.2)
+	primary := &fakeClient{model: "primary", err: &openai2.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}}
+	secondary := &fakeClient{model: "secondary"}
+	r := NewRegistry(config.ModelAliases{
+		"smart": {Model: "primary"},
+		"fast":  {Model: "secondary", Temperature: &temperature, MaxTokens: 100},
+	})
+	_ = r.AddClient(primary)
+	_ = r.AddClient(secondary)
+
+	status := make(chan types.CompletionStatus, 10)
+	resp, err := r.Call(context.Background(), types.CompletionRequest{Model: "smart, fast", MaxTokens: 50}, nil, status)
+	require.NoError(t, err)
+	assert.Equal(t, "answer from secondary", resp.ChatText())
+	assert.Equal(t, "primary", primary.request.Model)
+	assert.Equal(t, types.CompletionRequest{Model: "secondary", Temperature: &temperature, MaxTokens: 50}, secondary.request)
+	assert.Equal(t, "secondary", collect(status)[0].Model)
+}
+
+func TestResolveModelAlias(t *testing.T) {
+	aliases := config.ModelAliases{
+		"cheap": {Model: "llama3", Provider: "github.com/gptscript-ai/ollama-provider"},
+		"empty": {},
+	}
+
+	model, _, ok := aliases.Resolve("cheap")
+	assert.True(t, ok)
+	assert.Equal(t, "llama3 from github.com/gptscript-ai/ollama-provider", model)
+
+	for _, name := range []string{"empty", "gpt-4o"} {
+		model, _, ok = aliases.Resolve(name)
+		assert.False(t, ok)
+		assert.Equal(t, name, model)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&openai2.APIError{HTTPStatusCode: http.StatusInternalServerError}))
+	assert.True(t, IsRetryable(&openai2.RequestError{HTTPStatusCode: http.StatusBadGateway}))
+	assert.False(t, IsRetryable(&openai2.APIError{HTTPStatusCode: http.StatusUnauthorized}))
+	assert.True(t, IsRetryable(&anthropic.APIError{StatusCode: http.StatusBadRequest, Type: "invalid_request_error", Message: "prompt is too long: 210000 tokens > 200000 maximum"}))
+	assert.False(t, IsRetryable(&anthropic.APIError{StatusCode: http.StatusBadRequest, Type: "invalid_request_error", Message: "messages: field required"}))
+	assert.False(t, IsRetryable(context.Canceled))
+}
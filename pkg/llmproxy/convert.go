@@ -0,0 +1,223 @@
+package llmproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// chatCompletionRequest is an OpenAI chat completion request with the fields that the chat completion client
+// doesn't have.
+type chatCompletionRequest struct {
+	openai.ChatCompletionRequest
+	MaxCompletionTokens int    `json:"max_completion_tokens,omitempty"`
+	ReasoningEffort     string `json:"reasoning_effort,omitempty"`
+	ParallelToolCalls   *bool  `json:"parallel_tool_calls,omitempty"`
+}
+
+// toCompletionRequest translates an OpenAI chat completion request to a completion request of the registry. The
+// messages are passed on as they are, without the internal system prompt of GPTScript.
+func toCompletionRequest(req chatCompletionRequest) (types.CompletionRequest, error) {
+	if req.Model == "" {
+		return types.CompletionRequest{}, fmt.Errorf("model is required")
+	}
+	if len(req.Messages) == 0 {
+		return types.CompletionRequest{}, fmt.Errorf("messages are required")
+	}
+
+	result := types.CompletionRequest{
+		Model:                req.Model,
+		InternalSystemPrompt: new(bool),
+		MaxTokens:            types.FirstSet(req.MaxCompletionTokens, req.MaxTokens),
+		Temperature:          req.Temperature,
+		ToolChoice:           toToolChoice(req.ToolChoice),
+		ParallelToolCalls:    req.ParallelToolCalls,
+		Chat:                 true,
+	}
+	if req.ResponseFormat != nil {
+		result.JSONResponse = req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject ||
+			req.ResponseFormat.Type == "json_schema"
+	}
+	if req.ReasoningEffort != "" {
+		effort, err := types.ParseReasoningEffort(req.ReasoningEffort)
+		if err != nil {
+			return types.CompletionRequest{}, err
+		}
+		result.ReasoningEffort = effort
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		def := types.CompletionFunctionDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+		}
+		if tool.Function.Parameters != nil {
+			data, err := json.Marshal(tool.Function.Parameters)
+			if err != nil {
+				return types.CompletionRequest{}, err
+			}
+			if err := json.Unmarshal(data, &def.Parameters); err != nil {
+				return types.CompletionRequest{}, fmt.Errorf("invalid parameters of tool %s: %w", tool.Function.Name, err)
+			}
+		}
+		result.Tools = append(result.Tools, types.ChatCompletionTool{Function: def})
+	}
+
+	// The names of the tool calls, which some providers need along with the results.
+	toolNames := map[string]string{}
+	for _, msg := range req.Messages {
+		message, err := toCompletionMessage(msg, toolNames)
+		if err != nil {
+			return types.CompletionRequest{}, err
+		}
+		result.Messages = append(result.Messages, message)
+	}
+
+	return result, nil
+}
+
+// toToolChoice translates a tool_choice, which is either a string or an object with the name of a function.
+func toToolChoice(choice any) string {
+	switch choice := choice.(type) {
+	case string:
+		return types.ParseToolChoice(choice)
+	case map[string]any:
+		function, _ := choice["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		return name
+	}
+	return ""
+}
+
+func toCompletionMessage(msg openai.ChatCompletionMessage, toolNames map[string]string) (types.CompletionMessage, error) {
+	var result types.CompletionMessage
+	switch msg.Role {
+	case openai.ChatMessageRoleSystem, "developer":
+		result.Role = types.CompletionMessageRoleTypeSystem
+	case openai.ChatMessageRoleUser:
+		result.Role = types.CompletionMessageRoleTypeUser
+	case openai.ChatMessageRoleAssistant:
+		result.Role = types.CompletionMessageRoleTypeAssistant
+	case openai.ChatMessageRoleTool:
+		result.Role = types.CompletionMessageRoleTypeTool
+		result.ToolCall = &types.CompletionToolCall{
+			ID: msg.ToolCallID,
+			Function: types.CompletionFunctionCall{
+				Name: types.FirstSet(msg.Name, toolNames[msg.ToolCallID]),
+			},
+		}
+	default:
+		return result, fmt.Errorf("unsupported message role %q", msg.Role)
+	}
+
+	if msg.Content != "" {
+		result.Content = append(result.Content, types.ContentPart{Text: msg.Content})
+	}
+	for _, part := range msg.MultiContent {
+		switch {
+		case part.Type == openai.ChatMessagePartTypeText:
+			result.Content = append(result.Content, types.ContentPart{Text: part.Text})
+		case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+			result.Content = append(result.Content, imagePart(part.ImageURL.URL))
+		default:
+			return result, fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		toolNames[call.ID] = call.Function.Name
+		result.Content = append(result.Content, types.ContentPart{
+			ToolCall: &types.CompletionToolCall{
+				ID: call.ID,
+				Function: types.CompletionFunctionCall{
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				},
+			},
+		})
+	}
+
+	return result, nil
+}
+
+func imagePart(url string) types.ContentPart {
+	if media, ok := types.ParseDataURL(url); ok {
+		return types.MediaPart(media)
+	}
+	mimeType, _, _ := mime.ParseMediaType(mime.TypeByExtension(path.Ext(strings.SplitN(url, "?", 2)[0])))
+	return types.ContentPart{
+		Image: &types.Media{
+			URL:      url,
+			MimeType: types.FirstSet(mimeType, "image/png"),
+		},
+	}
+}
+
+// messageText returns the text of a completion message, without its reasoning and tool calls.
+func messageText(msg *types.CompletionMessage) string {
+	var buf strings.Builder
+	for _, part := range msg.Content {
+		if part.Reasoning == nil && part.ToolCall == nil {
+			buf.WriteString(part.Text)
+		}
+	}
+	return buf.String()
+}
+
+func toToolCalls(msg *types.CompletionMessage) (result []openai.ToolCall) {
+	for _, part := range msg.Content {
+		if part.ToolCall == nil {
+			continue
+		}
+		result = append(result, openai.ToolCall{
+			ID:   part.ToolCall.ID,
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      part.ToolCall.Function.Name,
+				Arguments: part.ToolCall.Function.Arguments,
+			},
+		})
+	}
+	return result
+}
+
+func finishReason(msg *types.CompletionMessage) openai.FinishReason {
+	if msg.IsToolCall() {
+		return openai.FinishReasonToolCalls
+	}
+	return openai.FinishReasonStop
+}
+
+func toUsage(usage types.Usage) openai.Usage {
+	return openai.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+}
+
+// toResponse translates a completion message to an OpenAI chat completion response.
+func toResponse(id, model string, created int64, msg *types.CompletionMessage) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message: openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   messageText(msg),
+				ToolCalls: toToolCalls(msg),
+			},
+			FinishReason: finishReason(msg),
+		}},
+		Usage: toUsage(msg.Usage),
+	}
+}
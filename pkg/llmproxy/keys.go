@@ -0,0 +1,187 @@
+package llmproxy
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Key is an API key of the proxy. The quotas are per UTC day, and 0 means unlimited.
+type Key struct {
+	Name           string `json:"name"`
+	Key            string `json:"key"`
+	TokensPerDay   int    `json:"tokensPerDay,omitempty"`
+	RequestsPerDay int    `json:"requestsPerDay,omitempty"`
+}
+
+// ReadKeys reads the API keys from a JSON file like {"keys": [{"name": "team-a", "key": "...", "tokensPerDay": 1000000}]}.
+func ReadKeys(file string) ([]Key, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+
+	var keys struct {
+		Keys []Key `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys %s: %w", file, err)
+	}
+	for i, key := range keys.Keys {
+		if key.Key == "" {
+			return nil, fmt.Errorf("API key %d in %s has no key", i+1, file)
+		}
+		if key.Name == "" {
+			return nil, fmt.Errorf("API key %d in %s has no name", i+1, file)
+		}
+	}
+	return keys.Keys, nil
+}
+
+// Usage is what a key used on a day.
+type Usage struct {
+	Name             string    `json:"name"`
+	Day              string    `json:"day"`
+	Requests         int       `json:"requests"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	TotalTokens      int       `json:"totalTokens"`
+	TokensPerDay     int       `json:"tokensPerDay,omitempty"`
+	RequestsPerDay   int       `json:"requestsPerDay,omitempty"`
+	ResetsAt         time.Time `json:"resetsAt"`
+}
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// meter counts the usage of the keys, and enforces their quotas. The tokens of the requests that are still running
+// are reserved, so that concurrent requests can't all pass the check before any of them is counted.
+type meter struct {
+	lock     sync.Mutex
+	keys     []Key
+	usage    map[string]*Usage
+	reserved map[string]int
+	now      func() time.Time
+}
+
+func newMeter(keys []Key) *meter {
+	return &meter{
+		keys:     keys,
+		usage:    map[string]*Usage{},
+		reserved: map[string]int{},
+		now:      time.Now,
+	}
+}
+
+// authenticate returns the key with the value, comparing in constant time so that keys can't be guessed by timing.
+func (m *meter) authenticate(value string) (Key, bool) {
+	hash := sha256.Sum256([]byte(value))
+	for _, key := range m.keys {
+		keyHash := sha256.Sum256([]byte(key.Key))
+		if subtle.ConstantTimeCompare(hash[:], keyHash[:]) == 1 {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// today returns the usage of the key today, starting a new day if needed. The lock must be held.
+func (m *meter) today(key Key) *Usage {
+	day := m.now().UTC().Format(time.DateOnly)
+	usage := m.usage[key.Name]
+	if usage == nil || usage.Day != day {
+		start, _ := time.Parse(time.DateOnly, day)
+		usage = &Usage{
+			Name:     key.Name,
+			Day:      day,
+			ResetsAt: start.AddDate(0, 0, 1),
+		}
+		m.usage[key.Name] = usage
+	}
+	usage.TokensPerDay = key.TokensPerDay
+	usage.RequestsPerDay = key.RequestsPerDay
+	return usage
+}
+
+// start counts a request of the key and reserves the tokens it is estimated to use, or returns errQuotaExceeded if
+// they don't fit in what is left of the quota of the key. The reservation is released by finish.
+func (m *meter) start(key Key, tokens int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	usage := m.today(key)
+	if key.RequestsPerDay > 0 && usage.Requests >= key.RequestsPerDay {
+		return fmt.Errorf("%w: %d of %d requests used today", errQuotaExceeded, usage.Requests, key.RequestsPerDay)
+	}
+	if key.TokensPerDay > 0 && usage.TotalTokens+m.reserved[key.Name]+tokens > key.TokensPerDay {
+		return fmt.Errorf("%w: %d of %d tokens used today, %d more are reserved by running requests and this request needs about %d",
+			errQuotaExceeded, usage.TotalTokens, key.TokensPerDay, m.reserved[key.Name], tokens)
+	}
+	usage.Requests++
+	m.reserved[key.Name] += tokens
+	return nil
+}
+
+// finish releases the tokens reserved by start and counts the tokens the request actually used.
+func (m *meter) finish(key Key, reserved int, tokens types.Usage) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.reserved[key.Name] -= reserved
+	usage := m.today(key)
+	usage.PromptTokens += tokens.PromptTokens
+	usage.CompletionTokens += tokens.CompletionTokens
+	usage.TotalTokens += tokens.TotalTokens
+}
+
+func (m *meter) get(key Key) Usage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return *m.today(key)
+}
+
+// restore counts the requests of today in the log, so that the quotas hold across restarts.
+func (m *meter) restore(logFile string) error {
+	f, err := os.Open(logFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keys := map[string]Key{}
+	for _, key := range m.keys {
+		keys[key.Name] = key
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	day := m.now().UTC().Format(time.DateOnly)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var entry logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		key, ok := keys[entry.Key]
+		if !ok || entry.Time.UTC().Format(time.DateOnly) != day {
+			continue
+		}
+		usage := m.today(key)
+		usage.Requests++
+		usage.PromptTokens += entry.Usage.PromptTokens
+		usage.CompletionTokens += entry.Usage.CompletionTokens
+		usage.TotalTokens += entry.Usage.TotalTokens
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,429 @@
+package llmproxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
+	"github.com/gptscript-ai/gptscript/pkg/gemini"
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+var log = mvl.Package()
+
+// Model is what the proxy calls, which is the LLM registry with all the configured providers.
+type Model interface {
+	Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error)
+	ListModels(ctx context.Context, providers ...string) (result []openai.Model, _ error)
+}
+
+type Options struct {
+	gptscript.Options
+
+	ListenAddress string
+	// Keys are the API keys that clients send as bearer tokens. At least one key is required.
+	Keys []Key
+	// LogFile is a JSONL file that every request and response is appended to.
+	LogFile string
+	// AllowedProviders are the model providers that clients may ask for with "model from provider". Model providers
+	// are tools that are downloaded and run on the proxy host, so clients can't pick any provider.
+	AllowedProviders []string
+}
+
+// Server serves an OpenAI compatible API for the models of a registry.
+type Server struct {
+	model            Model
+	env              []string
+	meter            *meter
+	allowedProviders map[string]struct{}
+
+	logLock sync.Mutex
+	log     *os.File
+}
+
+// New returns a proxy for the model. The log file is opened for appending, and the usage of today is counted from it.
+func New(model Model, env []string, keys []Key, allowedProviders []string, logFile string) (*Server, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one API key is required")
+	}
+
+	s := &Server{
+		model:            model,
+		env:              env,
+		meter:            newMeter(keys),
+		allowedProviders: map[string]struct{}{},
+	}
+	for _, provider := range allowedProviders {
+		s.allowedProviders[strings.TrimSpace(provider)] = struct{}{}
+	}
+
+	if logFile != "" {
+		if err := s.meter.restore(logFile); err != nil {
+			return nil, fmt.Errorf("failed to read usage from %s: %w", logFile, err)
+		}
+		f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		s.log = f
+	}
+
+	return s, nil
+}
+
+func (s *Server) Close() error {
+	if s.log != nil {
+		return s.log.Close()
+	}
+	return nil
+}
+
+// Run starts the proxy with all configured providers and blocks until ctx is done.
+func Run(ctx context.Context, opts Options) error {
+	g, err := gptscript.New(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer g.Close(true)
+
+	s, err := New(g.Registry, opts.Env, opts.Keys, opts.AllowedProviders, opts.LogFile)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	listener, err := net.Listen("tcp", opts.ListenAddress)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Handler: s,
+	}
+	context.AfterFunc(ctx, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		_ = httpServer.Shutdown(ctx)
+	})
+
+	log.Infof("LLM proxy listening on http://%s/v1", listener.Addr())
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server error: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	key, ok := s.meter.authenticate(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
+		return
+	}
+
+	switch {
+	case req.Method == http.MethodPost && req.URL.Path == "/v1/chat/completions":
+		s.chatCompletions(w, req, key)
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/models":
+		s.listModels(w, req)
+	case req.Method == http.MethodGet && req.URL.Path == "/v1/usage":
+		writeJSON(w, http.StatusOK, s.meter.get(key))
+	default:
+		writeError(w, http.StatusNotFound, "not_found", fmt.Sprintf("%s %s is not supported", req.Method, req.URL.Path))
+	}
+}
+
+func (s *Server) listModels(w http.ResponseWriter, req *http.Request) {
+	models, err := s.model.ListModels(req.Context())
+	if err != nil {
+		writeError(w, statusCode(err), "upstream_error", err.Error())
+		return
+	}
+	for i := range models {
+		models[i].Object = "model"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   models,
+	})
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, req *http.Request, key Key) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	var chatRequest chatCompletionRequest
+	if err := json.Unmarshal(body, &chatRequest); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	completionRequest, err := toCompletionRequest(chatRequest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	if err := s.checkProviders(completionRequest.Model); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	reserved := estimateTokens(body, completionRequest)
+	if err := s.meter.start(key, reserved); err != nil {
+		writeError(w, http.StatusTooManyRequests, "quota_exceeded", err.Error())
+		return
+	}
+
+	var (
+		start = time.Now()
+		call  = &chatCall{
+			id:           "chatcmpl-" + uuid.NewString(),
+			model:        chatRequest.Model,
+			created:      start.Unix(),
+			stream:       chatRequest.Stream,
+			includeUsage: chatRequest.StreamOptions != nil && chatRequest.StreamOptions.IncludeUsage,
+			w:            w,
+			controller:   http.NewResponseController(w),
+		}
+		status = make(chan types.CompletionStatus)
+		done   = make(chan struct{})
+		resp   *types.CompletionMessage
+	)
+
+	go func() {
+		defer close(done)
+		resp, err = s.model.Call(req.Context(), completionRequest, s.env, status)
+	}()
+
+	for running := true; running; {
+		select {
+		case st := <-status:
+			call.update(st)
+		case <-done:
+			running = false
+		}
+	}
+
+	entry := logEntry{
+		Time:       start,
+		Key:        key.Name,
+		Model:      call.model,
+		Request:    body,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		call.fail(err)
+	} else {
+		entry.Usage = resp.Usage
+		entry.Response = call.finish(resp)
+	}
+	s.meter.finish(key, reserved, entry.Usage)
+	s.writeLog(entry)
+}
+
+// estimateTokens guesses the tokens a request will use from the size of its body, at about four bytes per token, and
+// the completion tokens it allows.
+func estimateTokens(body []byte, req types.CompletionRequest) int {
+	return len(body)/4 + req.MaxTokens
+}
+
+// checkProviders returns an error if a model, or one of its fallbacks, asks for a provider that is not allowed.
+// Aliases are configured by the operator, so the providers they resolve to are not checked.
+func (s *Server) checkProviders(model string) error {
+	for _, m := range types.SplitModels(model) {
+		provider, modelName := types.SplitToolRef(m)
+		if modelName == "" {
+			continue
+		}
+		if _, ok := s.allowedProviders[provider]; !ok {
+			return fmt.Errorf("model provider %s is not allowed", provider)
+		}
+	}
+	return nil
+}
+
+// chatCall writes the response of one chat completion, as a single JSON object or as a stream of chunks.
+type chatCall struct {
+	id, model    string
+	created      int64
+	stream       bool
+	includeUsage bool
+	w            http.ResponseWriter
+	controller   *http.ResponseController
+
+	started bool
+	sent    string
+}
+
+func (c *chatCall) update(status types.CompletionStatus) {
+	if status.Model != "" {
+		c.model = status.Model
+	}
+	if !c.stream || status.PartialResponse == nil {
+		return
+	}
+
+	// The partial responses hold everything that was received so far, so only the new text is sent.
+	text := messageText(status.PartialResponse)
+	if len(text) <= len(c.sent) || !strings.HasPrefix(text, c.sent) {
+		return
+	}
+	c.writeChunk(openai.ChatCompletionStreamChoiceDelta{Content: text[len(c.sent):]}, "", nil)
+	c.sent = text
+}
+
+func (c *chatCall) writeChunk(delta openai.ChatCompletionStreamChoiceDelta, reason openai.FinishReason, usage *openai.Usage) {
+	if !c.started {
+		c.w.Header().Set("Content-Type", "text/event-stream")
+		c.w.Header().Set("Cache-Control", "no-cache")
+		c.w.WriteHeader(http.StatusOK)
+		c.started = true
+		delta.Role = openai.ChatMessageRoleAssistant
+	}
+
+	chunk := openai.ChatCompletionStreamResponse{
+		ID:      c.id,
+		Object:  "chat.completion.chunk",
+		Created: c.created,
+		Model:   c.model,
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        delta,
+			FinishReason: reason,
+		}},
+	}
+	if usage != nil {
+		chunk.Choices = []openai.ChatCompletionStreamChoice{}
+		chunk.Usage = *usage
+	}
+
+	data, _ := json.Marshal(chunk)
+	_, _ = fmt.Fprintf(c.w, "data: %s\n\n", data)
+	_ = c.controller.Flush()
+}
+
+// finish writes the rest of the response, and returns what is logged of it.
+func (c *chatCall) finish(msg *types.CompletionMessage) any {
+	response := toResponse(c.id, c.model, c.created, msg)
+	if !c.stream {
+		writeJSON(c.w, http.StatusOK, response)
+		return response
+	}
+
+	delta := openai.ChatCompletionStreamChoiceDelta{
+		ToolCalls: toToolCalls(msg),
+	}
+	for i := range delta.ToolCalls {
+		delta.ToolCalls[i].Index = &i
+	}
+	if text := messageText(msg); strings.HasPrefix(text, c.sent) {
+		delta.Content = text[len(c.sent):]
+	}
+	c.writeChunk(delta, finishReason(msg), nil)
+	if c.includeUsage {
+		usage := toUsage(msg.Usage)
+		c.writeChunk(openai.ChatCompletionStreamChoiceDelta{}, "", &usage)
+	}
+	_, _ = fmt.Fprint(c.w, "data: [DONE]\n\n")
+	_ = c.controller.Flush()
+	return response
+}
+
+func (c *chatCall) fail(err error) {
+	if !c.started {
+		writeError(c.w, statusCode(err), "upstream_error", err.Error())
+		return
+	}
+	data, _ := json.Marshal(errorResponse(statusCode(err), "upstream_error", err.Error()))
+	_, _ = fmt.Fprintf(c.w, "data: %s\n\n", data)
+	_ = c.controller.Flush()
+}
+
+// statusCode returns the status code of an error of a provider, so that clients can tell rate limits and bad
+// requests from other errors.
+func statusCode(err error) int {
+	var (
+		openaiErr    *openai.APIError
+		requestErr   *openai.RequestError
+		anthropicErr *anthropic.APIError
+		geminiErr    *gemini.APIError
+	)
+	switch {
+	case errors.As(err, &openaiErr) && openaiErr.HTTPStatusCode > 0:
+		return openaiErr.HTTPStatusCode
+	case errors.As(err, &requestErr) && requestErr.HTTPStatusCode > 0:
+		return requestErr.HTTPStatusCode
+	case errors.As(err, &anthropicErr) && anthropicErr.StatusCode > 0:
+		return anthropicErr.StatusCode
+	case errors.As(err, &geminiErr) && geminiErr.StatusCode > 0:
+		return geminiErr.StatusCode
+	case errors.Is(err, context.Canceled):
+		return 499
+	}
+	return http.StatusBadGateway
+}
+
+func errorResponse(code int, errorType, message string) map[string]any {
+	return map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    errorType,
+			"code":    code,
+		},
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, errorType, message string) {
+	writeJSON(w, code, errorResponse(code, errorType, message))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// logEntry is a line of the log file.
+type logEntry struct {
+	Time       time.Time       `json:"time"`
+	Key        string          `json:"key"`
+	Model      string          `json:"model"`
+	DurationMS int64           `json:"durationMs"`
+	Usage      types.Usage     `json:"usage"`
+	Request    json.RawMessage `json:"request,omitempty"`
+	Response   any             `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+func (s *Server) writeLog(entry logEntry) {
+	log.Infof("%s called %s in %dms, %d tokens", entry.Key, entry.Model, entry.DurationMS, entry.Usage.TotalTokens)
+	if s.log == nil {
+		return
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("failed to log request: %v", err)
+		return
+	}
+
+	s.logLock.Lock()
+	defer s.logLock.Unlock()
+	if _, err := s.log.Write(append(data, '\n')); err != nil {
+		log.Errorf("failed to log request: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package llmproxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeModel struct {
+	request types.CompletionRequest
+	err     error
+}
+
+func (f *fakeModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	f.request = messageRequest
+	if f.err != nil {
+		return nil, f.err
+	}
+	for _, text := range []string{"Hel", "Hello"} {
+		status <- types.CompletionStatus{
+			Model: "gpt-4o-mini",
+			PartialResponse: &types.CompletionMessage{
+				Role:    types.CompletionMessageRoleTypeAssistant,
+				Content: types.Text(text),
+			},
+		}
+	}
+	return &types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+		Content: []types.ContentPart{
+			{Text: "Hello"},
+			{ToolCall: &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "weather", Arguments: `{"city":"Paris"}`}}},
+		},
+		Usage: types.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func (f *fakeModel) ListModels(context.Context, ...string) ([]openai.Model, error) {
+	return []openai.Model{{ID: "gpt-4o-mini"}}, nil
+}
+
+func newTestServer(t *testing.T, model Model, logFile string, keys ...Key) *httptest.Server {
+	t.Helper()
+	s, err := New(model, nil, keys, []string{"github.com/example/provider"}, logFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func post(t *testing.T, url, key, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/v1/chat/completions", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+const chatBody = `{"model":"fast","messages":[
+	{"role":"system","content":"Be brief."},
+	{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,aGk="}}]},
+	{"role":"assistant","tool_calls":[{"id":"call_0","type":"function","function":{"name":"describe","arguments":"{}"}}]},
+	{"role":"tool","tool_call_id":"call_0","content":"A cat"}
+],"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}}],
+"tool_choice":{"type":"function","function":{"name":"weather"}},"parallel_tool_calls":false,
+"max_completion_tokens":100,"reasoning_effort":"low"}`
+
+func TestChatCompletions(t *testing.T) {
+	model := &fakeModel{}
+	server := newTestServer(t, model, "", Key{Name: "team-a", Key: "secret"})
+
+	resp := post(t, server.URL, "wrong", chatBody)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = post(t, server.URL, "secret", chatBody)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result openai.ChatCompletionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "gpt-4o-mini", result.Model)
+	assert.Equal(t, openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, result.Usage)
+	require.Len(t, result.Choices, 1)
+	assert.Equal(t, "Hello", result.Choices[0].Message.Content)
+	assert.Equal(t, openai.FinishReasonToolCalls, result.Choices[0].FinishReason)
+	assert.Equal(t, "weather", result.Choices[0].Message.ToolCalls[0].Function.Name)
+
+	assert.Equal(t, "fast", model.request.Model)
+	assert.Equal(t, 100, model.request.MaxTokens)
+	assert.Equal(t, "low", model.request.ReasoningEffort)
+	assert.Equal(t, "weather", model.request.ToolChoice)
+	assert.False(t, *model.request.ParallelToolCalls)
+	assert.False(t, *model.request.InternalSystemPrompt)
+	require.Len(t, model.request.Tools, 1)
+	assert.Equal(t, "object", model.request.Tools[0].Function.Parameters.Type)
+	require.Len(t, model.request.Messages, 4)
+	assert.Equal(t, []types.ContentPart{
+		{Text: "What is this?"},
+		{Image: &types.Media{URL: "data:image/png;base64,aGk=", MimeType: "image/png"}},
+	}, model.request.Messages[1].Content)
+	assert.Equal(t, &types.CompletionToolCall{ID: "call_0", Function: types.CompletionFunctionCall{Name: "describe"}}, model.request.Messages[3].ToolCall)
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	server := newTestServer(t, &fakeModel{}, "", Key{Name: "team-a", Key: "secret"})
+
+	resp := post(t, server.URL, "secret", `{"model":"fast","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"Hi"}]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var (
+		chunks []openai.ChatCompletionStreamResponse
+		done   bool
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+		var chunk openai.ChatCompletionStreamResponse
+		require.NoError(t, json.Unmarshal([]byte(data), &chunk))
+		chunks = append(chunks, chunk)
+	}
+	require.True(t, done)
+
+	require.Len(t, chunks, 4)
+	assert.Equal(t, openai.ChatCompletionStreamChoiceDelta{Role: "assistant", Content: "Hel"}, chunks[0].Choices[0].Delta)
+	assert.Equal(t, "lo", chunks[1].Choices[0].Delta.Content)
+	assert.Equal(t, openai.FinishReasonToolCalls, chunks[2].Choices[0].FinishReason)
+	assert.Equal(t, "call_1", chunks[2].Choices[0].Delta.ToolCalls[0].ID)
+	assert.Equal(t, 15, chunks[3].Usage.TotalTokens)
+}
+
+func TestQuotaAndLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "requests.jsonl")
+	key := Key{Name: "team-a", Key: "secret", RequestsPerDay: 2}
+
+	server := newTestServer(t, &fakeModel{}, logFile, key)
+	assert.Equal(t, http.StatusOK, post(t, server.URL, "secret", chatBody).StatusCode)
+	server.Close()
+
+	// The usage of today is read back from the log, so the quota holds across restarts.
+	server = newTestServer(t, &fakeModel{}, logFile, key)
+	assert.Equal(t, http.StatusOK, post(t, server.URL, "secret", chatBody).StatusCode)
+	resp := post(t, server.URL, "secret", chatBody)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v1/usage", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var usage Usage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&usage))
+	assert.Equal(t, 2, usage.Requests)
+	assert.Equal(t, 30, usage.TotalTokens)
+
+	data, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var entry logEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "team-a", entry.Key)
+	assert.Equal(t, "gpt-4o-mini", entry.Model)
+	assert.JSONEq(t, chatBody, string(entry.Request))
+}
+
+func TestTokenQuotaReservesRunningRequests(t *testing.T) {
+	key := Key{Name: "team-a", Key: "secret", TokensPerDay: 100}
+	m := newMeter([]Key{key})
+
+	// Requests that are still running can't all pass the check before any of them is counted.
+	require.NoError(t, m.start(key, 60))
+	assert.ErrorIs(t, m.start(key, 60), errQuotaExceeded)
+
+	// What the first request reserved but didn't use is free again once it is done.
+	m.finish(key, 60, types.Usage{TotalTokens: 30})
+	require.NoError(t, m.start(key, 60))
+	m.finish(key, 60, types.Usage{TotalTokens: 70})
+	assert.ErrorIs(t, m.start(key, 1), errQuotaExceeded)
+
+	usage := m.get(key)
+	assert.Equal(t, 2, usage.Requests)
+	assert.Equal(t, 100, usage.TotalTokens)
+}
+
+func TestUpstreamError(t *testing.T) {
+	server := newTestServer(t, &fakeModel{err: &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}}, "", Key{Name: "team-a", Key: "secret"})
+
+	resp := post(t, server.URL, "secret", `{"model":"fast","messages":[{"role":"user","content":"Hi"}]}`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	resp = post(t, server.URL, "secret", `{"messages":[{"role":"user","content":"Hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestProviders(t *testing.T) {
+	model := &fakeModel{}
+	server := newTestServer(t, model, "", Key{Name: "team-a", Key: "secret"})
+
+	for _, name := range []string{"x from github.com/someone/tool", "x from http://internal-host", "fast, x from github.com/someone/tool"} {
+		resp := post(t, server.URL, "secret", `{"model":"`+name+`","messages":[{"role":"user","content":"Hi"}]}`)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+	}
+	assert.Empty(t, model.request.Model)
+
+	resp := post(t, server.URL, "secret", `{"model":"x from github.com/example/provider","messages":[{"role":"user","content":"Hi"}]}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "x from github.com/example/provider", model.request.Model)
+}
+
+func TestNoKeys(t *testing.T) {
+	_, err := New(&fakeModel{}, nil, nil, nil, "")
+	assert.EqualError(t, err, "at least one API key is required")
+}
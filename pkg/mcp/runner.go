@@ -7,6 +7,7 @@ import (
 
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/types"
+	nmcp "github.com/nanobot-ai/nanobot/pkg/mcp"
 )
 
 func (l *Local) Run(ctx engine.Context, _ chan<- types.CompletionStatus, tool types.Tool, input string) (string, error) {
@@ -49,10 +50,30 @@ func (l *Local) Run(ctx engine.Context, _ chan<- types.CompletionStatus, tool ty
 		return "", fmt.Errorf("failed to call tool %s: %w", toolName, err)
 	}
 
+	attachments := attach(result)
+
 	str, err := json.Marshal(result)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	return string(str), nil
+	return strings.Join(append([]string{string(str)}, attachments...), "\n"), nil
+}
+
+// attach moves the images and attachable resources out of the result and returns them as data URLs, so that they are
+// passed to the LLM as images and files instead of as base64 text.
+func attach(result *nmcp.CallToolResult) (attachments []string) {
+	for i, content := range result.Content {
+		switch {
+		case content.Type == "image" && content.Data != "":
+			attachments = append(attachments, content.ToImageURL())
+			result.Content[i].Data = ""
+		case content.Resource != nil && content.Resource.Blob != "" && types.IsAttachable(content.Resource.MIMEType):
+			attachments = append(attachments, "data:"+content.Resource.MIMEType+";base64,"+content.Resource.Blob)
+			resource := *content.Resource
+			resource.Blob = ""
+			result.Content[i].Resource = &resource
+		}
+	}
+	return attachments
 }
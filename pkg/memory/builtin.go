@@ -0,0 +1,129 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const defaultSearchLimit = 10
+
+// storeFromEnv returns the store and namespace for a builtin call. Both come from the environment of the run so that
+// the LLM can't read or write the memories of another namespace.
+func storeFromEnv(envs []string) (*Store, string) {
+	namespace := env.Getenv(NamespaceEnvVar, envs)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	return New(env.Getenv(DirEnvVar, envs)), namespace
+}
+
+func SysMemoryPut(_ context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Key   string `json:"key,omitempty"`
+		Value string `json:"value,omitempty"`
+		Tags  string `json:"tags,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	var tags []string
+	for _, tag := range strings.Split(params.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	store, namespace := storeFromEnv(envs)
+	if _, err := store.Put(namespace, params.Key, params.Value, tags); err != nil {
+		return fmt.Sprintf("Failed to save memory %s: %v", params.Key, err), nil
+	}
+	return fmt.Sprintf("Saved memory %s", params.Key), nil
+}
+
+func SysMemoryGet(_ context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Key string `json:"key,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	store, namespace := storeFromEnv(envs)
+	entry, ok, err := store.Get(namespace, params.Key)
+	if err != nil {
+		return fmt.Sprintf("Failed to get memory %s: %v", params.Key, err), nil
+	}
+	if !ok {
+		return fmt.Sprintf("There is no memory %s", params.Key), nil
+	}
+	return entry.Value, nil
+}
+
+// SysMemorySearch can also be used as a context tool, in which case the input is the input of the tool that uses it,
+// which is used as the query.
+func SysMemorySearch(_ context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Query string `json:"query,omitempty"`
+		Limit string `json:"limit,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil || params.Query == "" && params.Limit == "" {
+		// Not the arguments of this tool, so search for the input as it is.
+		params.Query = input
+		params.Limit = ""
+	}
+
+	limit := defaultSearchLimit
+	if params.Limit != "" {
+		n, err := strconv.Atoi(params.Limit)
+		if err != nil {
+			return types.InvalidArgument(input, err), nil
+		}
+		limit = n
+	}
+
+	store, namespace := storeFromEnv(envs)
+	entries, err := store.Search(namespace, params.Query, limit)
+	if err != nil {
+		return fmt.Sprintf("Failed to search memories: %v", err), nil
+	}
+	if len(entries) == 0 {
+		return "No memories found", nil
+	}
+
+	var result strings.Builder
+	result.WriteString("Memories:\n")
+	for _, entry := range entries {
+		result.WriteString(fmt.Sprintf("- %s: %s", entry.Key, entry.Value))
+		if len(entry.Tags) > 0 {
+			result.WriteString(fmt.Sprintf(" (tags: %s)", strings.Join(entry.Tags, ", ")))
+		}
+		result.WriteString("\n")
+	}
+	return result.String(), nil
+}
+
+func SysMemoryDelete(_ context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Key string `json:"key,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	store, namespace := storeFromEnv(envs)
+	ok, err := store.Delete(namespace, params.Key)
+	if err != nil {
+		return fmt.Sprintf("Failed to delete memory %s: %v", params.Key, err), nil
+	}
+	if !ok {
+		return fmt.Sprintf("There is no memory %s", params.Key), nil
+	}
+	return fmt.Sprintf("Deleted memory %s", params.Key), nil
+}
@@ -0,0 +1,307 @@
+// Package memory is a local store that lets tools remember things across runs. Entries are grouped in namespaces, so
+// that unrelated agents don't see each other's memories.
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/locker"
+	"github.com/adrg/xdg"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/version"
+	"github.com/nightlyone/lockfile"
+)
+
+const (
+	DirEnvVar       = "GPTSCRIPT_MEMORY_DIR"
+	NamespaceEnvVar = "GPTSCRIPT_MEMORY_NAMESPACE"
+
+	DefaultNamespace = "default"
+
+	// lockTimeout is how long to wait for another process that is changing the same namespace.
+	lockTimeout = 10 * time.Second
+)
+
+var validNamespace = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+type Entry struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	Tags      []string  `json:"tags,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Store keeps every namespace in its own JSON file in a directory.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the directory memories are stored in, which can be changed with GPTSCRIPT_MEMORY_DIR.
+func DefaultDir() string {
+	if dir := os.Getenv(DirEnvVar); dir != "" {
+		return dir
+	}
+	return filepath.Join(xdg.DataHome, version.ProgramName, "memory")
+}
+
+func New(dir string) *Store {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Store{
+		dir: dir,
+	}
+}
+
+func ValidateNamespace(namespace string) error {
+	if !validNamespace.MatchString(namespace) {
+		return fmt.Errorf("invalid memory namespace %q, it must only contain letters, numbers, '.', '_' and '-'", namespace)
+	}
+	return nil
+}
+
+func (s *Store) file(namespace string) string {
+	return filepath.Join(s.dir, namespace+".json")
+}
+
+func (s *Store) read(namespace string) (map[string]Entry, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.file(namespace))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]Entry{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read memory namespace %s: %w", namespace, err)
+	}
+
+	var entries map[string]Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse memory namespace %s: %w", namespace, err)
+	}
+	if entries == nil {
+		entries = map[string]Entry{}
+	}
+	return entries, nil
+}
+
+func (s *Store) write(namespace string, entries map[string]Entry) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	file := s.file(namespace)
+	if err := system.WriteFileAtomic(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write memory namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// lock keeps other goroutines and processes from changing a namespace until the returned func is called. Reading a
+// namespace doesn't need the lock, because its file is only ever replaced as a whole.
+func (s *Store) lock(namespace string) (func(), error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+
+	file, err := filepath.Abs(filepath.Join(s.dir, namespace+".lock"))
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.New(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lock file is owned by the process, so goroutines have to be kept from sharing it.
+	locker.Lock(file)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = lock.TryLock()
+		if err == nil {
+			break
+		}
+		var temporary lockfile.TemporaryError
+		if !errors.As(err, &temporary) || time.Now().After(deadline) {
+			locker.Unlock(file)
+			return nil, fmt.Errorf("failed to lock memory namespace %s: %w", namespace, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return func() {
+		_ = lock.Unlock()
+		locker.Unlock(file)
+	}, nil
+}
+
+// Put saves the value under key, replacing the entry that was there.
+func (s *Store) Put(namespace, key, value string, tags []string) (Entry, error) {
+	if key == "" {
+		return Entry{}, errors.New("a key is required to save a memory")
+	}
+
+	unlock, err := s.lock(namespace)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer unlock()
+
+	entries, err := s.read(namespace)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := time.Now().UTC()
+	entry, ok := entries[key]
+	if !ok {
+		entry.CreatedAt = now
+	}
+	entry.Key = key
+	entry.Value = value
+	entry.Tags = tags
+	entry.UpdatedAt = now
+	entries[key] = entry
+
+	return entry, s.write(namespace, entries)
+}
+
+func (s *Store) Get(namespace, key string) (Entry, bool, error) {
+	entries, err := s.read(namespace)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	entry, ok := entries[key]
+	return entry, ok, nil
+}
+
+// Delete removes the entry with the key, and returns false if there was none.
+func (s *Store) Delete(namespace, key string) (bool, error) {
+	unlock, err := s.lock(namespace)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	entries, err := s.read(namespace)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := entries[key]; !ok {
+		return false, nil
+	}
+	delete(entries, key)
+	return true, s.write(namespace, entries)
+}
+
+// List returns all the entries in a namespace, the most recently updated first.
+func (s *Store) List(namespace string) ([]Entry, error) {
+	entries, err := s.read(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].UpdatedAt.Equal(result[j].UpdatedAt) {
+			return result[i].Key < result[j].Key
+		}
+		return result[i].UpdatedAt.After(result[j].UpdatedAt)
+	})
+	return result, nil
+}
+
+// Search returns up to limit entries that share the most words with the query, the best match first. An empty query
+// returns the most recently updated entries.
+func (s *Store) Search(namespace, query string, limit int) ([]Entry, error) {
+	entries, err := s.List(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := words(query)
+	if len(terms) > 0 {
+		scores := map[string]int{}
+		for _, entry := range entries {
+			text := words(strings.Join(append([]string{entry.Key, entry.Value}, entry.Tags...), " "))
+			for _, term := range terms {
+				if slices.Contains(text, term) {
+					scores[entry.Key]++
+				}
+			}
+		}
+
+		entries = slices.DeleteFunc(entries, func(entry Entry) bool {
+			return scores[entry.Key] == 0
+		})
+		// The entries are already ordered by when they were updated, which is kept for entries with the same score.
+		sort.SliceStable(entries, func(i, j int) bool {
+			return scores[entries[i].Key] > scores[entries[j].Key]
+		})
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Clear removes all the entries in a namespace.
+func (s *Store) Clear(namespace string) error {
+	unlock, err := s.lock(namespace)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := os.Remove(s.file(namespace)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear memory namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// Namespaces returns the names of the namespaces that have been saved.
+func (s *Store) Namespaces() ([]string, error) {
+	files, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, file := range files {
+		if namespace, ok := strings.CutSuffix(file.Name(), ".json"); ok && !file.IsDir() {
+			result = append(result, namespace)
+		}
+	}
+	return result, nil
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r == '_' || r == '-' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r > 127)
+	})
+}
@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	store := New(t.TempDir())
+
+	_, err := store.Put("default", "color", "The user's favorite color is blue", []string{"preferences"})
+	require.NoError(t, err)
+	_, err = store.Put("default", "pet", "The user has a dog named Rex", nil)
+	require.NoError(t, err)
+	_, err = store.Put("other", "color", "Green", nil)
+	require.NoError(t, err)
+
+	entry, ok, err := store.Get("default", "color")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "The user's favorite color is blue", entry.Value)
+	require.Equal(t, []string{"preferences"}, entry.Tags)
+
+	// Namespaces don't see each other's memories.
+	entry, ok, err = store.Get("other", "color")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "Green", entry.Value)
+
+	entries, err := store.Search("default", "what color does the user like?", 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "color", entries[0].Key)
+
+	entries, err = store.Search("default", "dog", 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "pet", entries[0].Key)
+
+	entries, err = store.Search("default", "preferences", 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "color", entries[0].Key)
+
+	// An empty query returns the most recent memories.
+	entries, err = store.Search("default", "", 1)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "pet", entries[0].Key)
+
+	deleted, err := store.Delete("default", "pet")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	_, ok, err = store.Get("default", "pet")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	namespaces, err := store.Namespaces()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"default", "other"}, namespaces)
+
+	require.NoError(t, store.Clear("other"))
+	entries, err = store.List("other")
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_, err = store.Put("../escape", "key", "value", nil)
+	require.ErrorContains(t, err, "invalid memory namespace")
+}
+
+func TestStoreLockedByOtherProcess(t *testing.T) {
+	dir := t.TempDir()
+	store := New(dir)
+
+	// The lock file of another process that is still running.
+	lock := filepath.Join(dir, "default.lock")
+	require.NoError(t, os.WriteFile(lock, []byte(fmt.Sprintf("%d\n", os.Getppid())), 0600))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = os.Remove(lock)
+	}()
+
+	start := time.Now()
+	_, err := store.Put("default", "color", "Blue", nil)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+	require.NoFileExists(t, lock)
+
+	_, ok, err := store.Get("default", "color")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestSysMemory(t *testing.T) {
+	envs := []string{DirEnvVar + "=" + t.TempDir(), NamespaceEnvVar + "=agent"}
+
+	out, err := SysMemoryPut(context.Background(), envs, `{"key": "deadline", "value": "The report is due on Friday", "tags": "work, report"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Saved memory deadline", out)
+
+	out, err = SysMemoryGet(context.Background(), envs, `{"key": "deadline"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "The report is due on Friday", out)
+
+	out, err = SysMemorySearch(context.Background(), envs, `{"query": "report", "limit": "5"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Memories:\n- deadline: The report is due on Friday (tags: work, report)\n", out)
+
+	// As a context tool, the input is the input of the tool that uses it.
+	out, err = SysMemorySearch(context.Background(), envs, `When is the report due?`, nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "deadline")
+
+	// The memories are in the namespace of the run.
+	out, err = SysMemoryGet(context.Background(), []string{envs[0]}, `{"key": "deadline"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "There is no memory deadline", out)
+
+	out, err = SysMemoryDelete(context.Background(), envs, `{"key": "deadline"}`, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Deleted memory deadline", out)
+}
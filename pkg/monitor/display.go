@@ -235,6 +235,9 @@ func (d *display) Event(event runner.Event) {
 	d.usage.PromptTokens += event.Usage.PromptTokens
 	d.usage.CompletionTokens += event.Usage.CompletionTokens
 	d.usage.TotalTokens += event.Usage.TotalTokens
+	d.usage.ReasoningTokens += event.Usage.ReasoningTokens
+	d.usage.CacheReadTokens += event.Usage.CacheReadTokens
+	d.usage.CacheWriteTokens += event.Usage.CacheWriteTokens
 
 	switch event.Type {
 	case runner.EventTypeCallStart:
@@ -263,6 +266,7 @@ func (d *display) Event(event runner.Event) {
 			log.Infof("sent     [%s]", callName)
 			log = log.Fields(
 				"completionID", event.ChatCompletionID,
+				"model", event.ChatModel,
 				"request", toJSON(event.ChatRequest),
 			)
 		}
@@ -277,6 +281,13 @@ func (d *display) Event(event runner.Event) {
 			Response:     event.ChatResponse,
 			Cached:       event.ChatResponseCached,
 		})
+	case runner.EventTypeCallCompaction:
+		d.livePrinter.end()
+		log.Fields(
+			"completionID", event.ChatCompletionID,
+			"strategy", event.Compaction.Strategy,
+			"droppedMessages", event.Compaction.DroppedMessages,
+		).Infof("compacted [%s]", callName)
 	case runner.EventTypeCallFinish:
 		d.livePrinter.progressEnd(currentCall)
 		d.livePrinter.end()
@@ -294,7 +305,8 @@ func (d *display) Stop(_ context.Context, output string, err error) {
 
 	log.Fields("runID", d.dump.ID, "output", output, "err", err, "type", runner.EventTypeRunFinish).Debugf("Run stopped")
 	if d.usage.TotalTokens > 0 {
-		log.Fields("runID", d.dump.ID, "total", d.usage.TotalTokens, "prompt", d.usage.PromptTokens, "completion", d.usage.CompletionTokens).Infof("usage   ")
+		log.Fields("runID", d.dump.ID, "total", d.usage.TotalTokens, "prompt", d.usage.PromptTokens, "completion", d.usage.CompletionTokens, "reasoning", d.usage.ReasoningTokens,
+			"cacheRead", d.usage.CacheReadTokens, "cacheWrite", d.usage.CacheWriteTokens).Infof("usage   ")
 	}
 	d.dump.Output = output
 	d.dump.Err = err
@@ -2,13 +2,17 @@ package openai
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	humav2 "github.com/danielgtaylor/huma/v2"
@@ -50,6 +54,11 @@ type Client struct {
 	cacheKeyBase string
 	setSeed      bool
 	credStore    credentials.CredentialStore
+
+	maxRetries        int
+	requestsPerMinute int
+	limitersLock      sync.Mutex
+	limiters          map[string]*limiter
 }
 
 type Options struct {
@@ -61,6 +70,9 @@ type Options struct {
 	SetSeed      bool   `usage:"-"`
 	CacheKey     string `usage:"-"`
 	Cache        *cache.Client
+
+	MaxRetries        int `usage:"Maximum retries of rate limited or failed OpenAI requests, -1 to disable (default 5)" name:"openai-max-retries" env:"OPENAI_MAX_RETRIES"`
+	RequestsPerMinute int `usage:"Limit the requests per minute sent to each OpenAI model, 0 for no limit" name:"openai-requests-per-minute" env:"OPENAI_REQUESTS_PER_MINUTE"`
 }
 
 func Complete(opts ...Options) (result Options) {
@@ -72,6 +84,8 @@ func Complete(opts ...Options) (result Options) {
 		result.DefaultModel = types.FirstSet(opt.DefaultModel, result.DefaultModel)
 		result.SetSeed = types.FirstSet(opt.SetSeed, result.SetSeed)
 		result.CacheKey = types.FirstSet(opt.CacheKey, result.CacheKey)
+		result.MaxRetries = types.FirstSet(opt.MaxRetries, result.MaxRetries)
+		result.RequestsPerMinute = types.FirstSet(opt.RequestsPerMinute, result.RequestsPerMinute)
 	}
 
 	return result
@@ -117,6 +131,9 @@ func NewClient(ctx context.Context, credStore credentials.CredentialStore, opts
 	cfg := openai.DefaultConfig(opt.APIKey)
 	cfg.BaseURL = types.FirstSet(opt.BaseURL, cfg.BaseURL)
 	cfg.OrgID = types.FirstSet(opt.OrgID, cfg.OrgID)
+	cfg.HTTPClient = &http.Client{
+		Transport: &retryTransport{next: http.DefaultTransport},
+	}
 
 	cacheKeyBase := opt.CacheKey
 	if cacheKeyBase == "" {
@@ -131,6 +148,10 @@ func NewClient(ctx context.Context, credStore credentials.CredentialStore, opts
 		invalidAuth:  opt.APIKey == "" && opt.BaseURL == "",
 		setSeed:      opt.SetSeed,
 		credStore:    credStore,
+
+		maxRetries:        max(types.FirstSet(opt.MaxRetries, DefaultMaxRetries), 0),
+		requestsPerMinute: max(opt.RequestsPerMinute, 0),
+		limiters:          map[string]*limiter{},
 	}, nil
 }
 
@@ -192,11 +213,15 @@ func (c *Client) ListModels(ctx context.Context, providers ...string) ([]openai.
 	return models.Models, nil
 }
 
-func (c *Client) cacheKey(request openai.ChatCompletionRequest) any {
-	return map[string]any{
+func (c *Client) cacheKey(request openai.ChatCompletionRequest, extra map[string]any) any {
+	key := map[string]any{
 		"base":    c.cacheKeyBase,
 		"request": request,
 	}
+	if len(extra) > 0 {
+		key["extra"] = extra
+	}
+	return key
 }
 
 func (c *Client) seed(request openai.ChatCompletionRequest) int {
@@ -222,7 +247,7 @@ func (c *Client) fromCache(ctx context.Context, messageRequest types.CompletionR
 	if !messageRequest.GetCache() {
 		return types.CompletionMessage{}, false, nil
 	}
-	found, err := c.cache.Get(ctx, c.cacheKey(request), &result)
+	found, err := c.cache.Get(ctx, c.cacheKey(request, extraBody(messageRequest)), &result)
 	if err != nil {
 		return types.CompletionMessage{}, false, err
 	} else if !found {
@@ -267,7 +292,9 @@ func toMessages(request types.CompletionRequest, compat bool) (result []openai.C
 		})
 	}
 
-	for _, message := range msgs {
+	// OpenAI only takes images from the user, so the images of tool results are sent in a user message after them.
+	var toolImages []openai.ChatMessagePart
+	for i, message := range msgs {
 		chatMessage := openai.ChatCompletionMessage{
 			Role: string(message.Role),
 		}
@@ -285,6 +312,28 @@ func toMessages(request types.CompletionRequest, compat bool) (result []openai.C
 			if content.Text != "" {
 				chatMessage.MultiContent = append(chatMessage.MultiContent, textToMultiContent(content.Text)...)
 			}
+			if content.Image != nil || content.File != nil {
+				chatMessage.MultiContent = append(chatMessage.MultiContent, mediaToMultiContent(content))
+			}
+		}
+
+		if message.Role == types.CompletionMessageRoleTypeTool {
+			var text, images []openai.ChatMessagePart
+			for _, part := range chatMessage.MultiContent {
+				if part.Type == openai.ChatMessagePartTypeImageURL {
+					images = append(images, part)
+				} else {
+					text = append(text, part)
+				}
+			}
+			toolImages = append(toolImages, images...)
+			if len(text) == 0 && len(images) > 0 {
+				text = append(text, openai.ChatMessagePart{
+					Type: openai.ChatMessagePartTypeText,
+					Text: "The images are in the next message.",
+				})
+			}
+			chatMessage.MultiContent = text
 		}
 
 		if len(chatMessage.MultiContent) == 1 && chatMessage.MultiContent[0].Type == openai.ChatMessagePartTypeText {
@@ -300,38 +349,102 @@ func toMessages(request types.CompletionRequest, compat bool) (result []openai.C
 		}
 
 		result = append(result, chatMessage)
+
+		if len(toolImages) > 0 && (i == len(msgs)-1 || msgs[i+1].Role != types.CompletionMessageRoleTypeTool) {
+			result = append(result, openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleUser,
+				MultiContent: append([]openai.ChatMessagePart{{
+					Type: openai.ChatMessagePartTypeText,
+					Text: "Images returned by the tool calls:",
+				}}, toolImages...),
+			})
+			toolImages = nil
+		}
 	}
 
 	return
 }
 
-const imagePrefix = "data:image/png;base64,"
-
 func textToMultiContent(text string) []openai.ChatMessagePart {
 	var chatParts []openai.ChatMessagePart
-	parts := strings.Split(text, "\n")
-	for i := len(parts) - 1; i >= 0; i-- {
-		if strings.HasPrefix(parts[i], imagePrefix) {
+	for _, part := range types.Content(text) {
+		if part.Image != nil || part.File != nil {
+			chatParts = append(chatParts, mediaToMultiContent(part))
+		} else {
 			chatParts = append(chatParts, openai.ChatMessagePart{
-				Type: openai.ChatMessagePartTypeImageURL,
-				ImageURL: &openai.ChatMessageImageURL{
-					URL: parts[i],
-				},
+				Type: openai.ChatMessagePartTypeText,
+				Text: part.Text,
 			})
-			parts = parts[:i]
-		} else {
-			break
 		}
 	}
-	if len(parts) > 0 {
-		chatParts = append(chatParts, openai.ChatMessagePart{
-			Type: openai.ChatMessagePartTypeText,
-			Text: strings.Join(parts, "\n"),
-		})
+	return chatParts
+}
+
+// mediaToMultiContent turns an image into an image part. Files can't be sent through the chat completions API, so
+// the model is told about them instead.
+func mediaToMultiContent(part types.ContentPart) openai.ChatMessagePart {
+	if part.Image != nil {
+		return openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{
+				URL: part.Image.PlainURL(),
+			},
+		}
+	}
+	return openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeText,
+		Text: fmt.Sprintf("[The file %s (%s) is attached, but this model can't read files]", types.FirstSet(part.File.Name, "without a name"), part.File.MimeType),
 	}
+}
 
-	slices.Reverse(chatParts)
-	return chatParts
+// extraBody returns the request fields for the parts of the completion request that the chat completion client
+// doesn't support.
+func extraBody(messageRequest types.CompletionRequest) map[string]any {
+	result := map[string]any{}
+	if effort := messageRequest.ReasoningLevel(); effort != "" {
+		result["reasoning_effort"] = effort
+	}
+	// parallel_tool_calls is only allowed when there are tools.
+	if messageRequest.ParallelToolCalls != nil && len(messageRequest.Tools) > 0 {
+		result["parallel_tool_calls"] = *messageRequest.ParallelToolCalls
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// extendBody adds the extra fields to the JSON request body.
+func extendBody(body []byte, extra map[string]any) ([]byte, error) {
+	if len(extra) == 0 {
+		return body, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return json.Marshal(fields)
+}
+
+// toolChoice returns the tool_choice of the request, which is a string for auto, none and required, and an object
+// for a function.
+func toolChoice(messageRequest types.CompletionRequest) any {
+	if name := messageRequest.ForcedFunction(); name != "" {
+		return openai.ToolChoice{
+			Type: openai.ToolTypeFunction,
+			Function: openai.ToolFunction{
+				Name: name,
+			},
+		}
+	}
+	if messageRequest.ToolChoice != "" {
+		return messageRequest.ToolChoice
+	}
+	return nil
 }
 
 func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
@@ -355,6 +468,10 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		return nil, err
 	}
 
+	var (
+		compaction CompactionStrategy
+		compacted  CompactionResult
+	)
 	if messageRequest.Chat {
 		// Check the last message. If it is from a tool call, and if it takes up more than 80% of the budget on its own, reject it.
 		lastMessage := msgs[len(msgs)-1]
@@ -369,10 +486,22 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 			messageRequest.Messages[len(messageRequest.Messages)-1].Content = types.Text(TooLongMessage)
 		}
 
-		msgs, err = dropMessagesOverCount(messageRequest.MaxTokens, toolTokenCount, msgs)
+		compaction, err = getCompactionStrategy(messageRequest.Compaction)
+		if err != nil {
+			return nil, err
+		}
+
+		compacted, err = compaction.Compact(ctx, CompactionRequest{
+			Request:        messageRequest,
+			Messages:       msgs,
+			MaxTokens:      messageRequest.MaxTokens,
+			ToolTokenCount: toolTokenCount,
+			Env:            env,
+		})
 		if err != nil {
 			return nil, err
 		}
+		msgs = compacted.Messages
 	}
 
 	if len(msgs) == 0 {
@@ -389,10 +518,11 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		MaxTokens: messageRequest.MaxTokens,
 	}
 
-	if messageRequest.Temperature == nil {
-		request.Temperature = new(float32)
-	} else {
+	if messageRequest.Temperature != nil {
 		request.Temperature = messageRequest.Temperature
+	} else if messageRequest.ReasoningEffort == "" {
+		// Reasoning models only support their default temperature.
+		request.Temperature = new(float32)
 	}
 
 	if messageRequest.JSONResponse {
@@ -424,6 +554,9 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 			},
 		})
 	}
+	if len(request.Tools) > 0 {
+		request.ToolChoice = toolChoice(messageRequest)
+	}
 
 	id := counter.Next()
 	status <- types.CompletionStatus{
@@ -434,6 +567,8 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		},
 	}
 
+	sendCompactionStatus(id, messageRequest, compacted, status)
+
 	var cacheResponse bool
 	if c.setSeed {
 		request.Seed = ptr(c.seed(request))
@@ -445,7 +580,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	if err != nil {
 		return nil, err
 	} else if !ok {
-		result, err = c.call(ctx, request, id, env, status)
+		result, err = c.call(ctx, request, extraBody(messageRequest), id, env, status)
 
 		// If we got back a context length exceeded error, keep retrying and shrinking the message history until we pass.
 		var apiError *openai.APIError
@@ -453,7 +588,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 			// Decrease maxTokens by 10% to make garbage collection more aggressive.
 			// The retry loop will further decrease maxTokens if needed.
 			maxTokens := decreaseTenPercent(messageRequest.MaxTokens)
-			result, err = c.contextLimitRetryLoop(ctx, request, id, env, maxTokens, toolTokenCount, status)
+			result, err = c.contextLimitRetryLoop(ctx, messageRequest, request, compaction, id, env, maxTokens, toolTokenCount, status)
 		}
 		if err != nil {
 			return nil, err
@@ -487,7 +622,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	return &result, nil
 }
 
-func (c *Client) contextLimitRetryLoop(ctx context.Context, request openai.ChatCompletionRequest, id string, env []string, maxTokens int, toolTokenCount int, status chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+func (c *Client) contextLimitRetryLoop(ctx context.Context, messageRequest types.CompletionRequest, request openai.ChatCompletionRequest, compaction CompactionStrategy, id string, env []string, maxTokens int, toolTokenCount int, status chan<- types.CompletionStatus) (types.CompletionMessage, error) {
 	var (
 		response types.CompletionMessage
 		err      error
@@ -495,12 +630,20 @@ func (c *Client) contextLimitRetryLoop(ctx context.Context, request openai.ChatC
 
 	for range 10 { // maximum 10 tries
 		// Try to drop older messages again, with a decreased max tokens.
-		request.Messages, err = dropMessagesOverCount(maxTokens, toolTokenCount, request.Messages)
+		compacted, err := compaction.Compact(ctx, CompactionRequest{
+			Request:        messageRequest,
+			Messages:       request.Messages,
+			MaxTokens:      maxTokens,
+			ToolTokenCount: toolTokenCount,
+			Env:            env,
+		})
 		if err != nil {
 			return types.CompletionMessage{}, err
 		}
+		request.Messages = compacted.Messages
+		sendCompactionStatus(id, messageRequest, compacted, status)
 
-		response, err = c.call(ctx, request, id, env, status)
+		response, err = c.call(ctx, request, extraBody(messageRequest), id, env, status)
 		if err == nil {
 			return response, nil
 		}
@@ -517,6 +660,21 @@ func (c *Client) contextLimitRetryLoop(ctx context.Context, request openai.ChatC
 	return types.CompletionMessage{}, err
 }
 
+func sendCompactionStatus(id string, messageRequest types.CompletionRequest, compacted CompactionResult, status chan<- types.CompletionStatus) {
+	if compacted.Dropped == 0 {
+		return
+	}
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Usage:        compacted.Usage,
+		Compaction: &types.CompactionStatus{
+			Strategy:        types.FirstSet(messageRequest.Compaction, types.CompactionDrop),
+			DroppedMessages: compacted.Dropped,
+			Summary:         compacted.Summary,
+		},
+	}
+}
+
 func appendMessage(msg types.CompletionMessage, response openai.ChatCompletionStreamResponse) types.CompletionMessage {
 	msg.Usage.CompletionTokens = types.FirstSet(msg.Usage.CompletionTokens, response.Usage.CompletionTokens)
 	msg.Usage.PromptTokens = types.FirstSet(msg.Usage.PromptTokens, response.Usage.PromptTokens)
@@ -592,7 +750,7 @@ func override(left, right string) string {
 
 const WaitingMessage = "Waiting for model response..."
 
-func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, env []string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest, extra map[string]any, transactionID string, env []string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
 	streamResponse := os.Getenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING") != "false"
 
 	partial <- types.CompletionStatus{
@@ -606,11 +764,16 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 	var (
 		headers          map[string]string
 		modelProviderEnv []string
-		retryOpts        = []openai.RetryOptions{
+		state            = &callState{
+			maxRetries: c.maxRetries,
+			limiter:    c.limiterFor(request.Model),
+			extraBody:  extra,
+		}
+		// Retries are done by the retryTransport, which honors the rate limit headers of the response, so the
+		// chat completion client must not retry or wait on its own.
+		retryOpts = []openai.RetryOptions{
 			{
-				Retries:        5,
-				RetryAboveCode: 499,        // 5xx errors
-				RetryCodes:     []int{429}, // 429 Too Many Requests (ratelimit)
+				RetryAboveCode: 999,
 			},
 		}
 	)
@@ -618,7 +781,7 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		if strings.HasPrefix(e, "GPTSCRIPT_MODEL_PROVIDER_") {
 			modelProviderEnv = append(modelProviderEnv, e)
 		} else if strings.HasPrefix(e, "GPTSCRIPT_DISABLE_RETRIES") {
-			retryOpts = nil
+			state.maxRetries = 0
 		}
 	}
 
@@ -638,16 +801,20 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		engineCtx.OnUserCancel(ctx, cancel)
 	}
 
+	ctx = withCallState(ctx, state)
+
 	if !streamResponse {
 		request.StreamOptions = nil
 		resp, err := c.c.CreateChatCompletion(ctx, request, headers, retryOpts...)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				err = nil
+			} else if state.apiError != nil {
+				err = state.apiError
 			}
 			return types.CompletionMessage{}, err
 		}
-		return appendMessage(types.CompletionMessage{}, openai.ChatCompletionStreamResponse{
+		return state.withReasoning(appendMessage(types.CompletionMessage{}, openai.ChatCompletionStreamResponse{
 			ID:      resp.ID,
 			Object:  resp.Object,
 			Created: resp.Created,
@@ -665,13 +832,15 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 					FinishReason: resp.Choices[0].FinishReason,
 				},
 			},
-		}), nil
+		})), nil
 	}
 
 	stream, err := c.c.CreateChatCompletionStream(ctx, request, headers, retryOpts...)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			err = nil
+		} else if state.apiError != nil {
+			err = state.apiError
 		}
 		return types.CompletionMessage{}, err
 	}
@@ -686,7 +855,8 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 			// If the stream is finished, either because we got an EOF or the context was canceled,
 			// then we're done. The cache won't save the response if the context was canceled.
-			return partialMessage, c.cache.Store(ctx, c.cacheKey(request), partialMessage)
+			partialMessage = state.withReasoning(partialMessage)
+			return partialMessage, c.cache.Store(ctx, c.cacheKey(request, extra), partialMessage)
 		} else if err != nil {
 			return types.CompletionMessage{}, err
 		}
@@ -1,19 +1,30 @@
 package openai
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"testing"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
 	"github.com/hexops/valast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTextToMultiContent(t *testing.T) {
-	autogold.Expect([]openai.ChatMessagePart{{
-		Type: "text",
-		Text: "hi\ndata:image/png;base64,xxxxx\n",
-	}}).Equal(t, textToMultiContent("hi\ndata:image/png;base64,xxxxx\n"))
+	autogold.Expect([]openai.ChatMessagePart{
+		{
+			Type: "text",
+			Text: "hi",
+		},
+		{
+			Type:     "image_url",
+			ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,xxxxx"},
+		},
+	}).Equal(t, textToMultiContent("hi\ndata:image/png;base64,xxxxx\n"))
 
 	autogold.Expect([]openai.ChatMessagePart{
 		{
@@ -47,6 +58,47 @@ func TestTextToMultiContent(t *testing.T) {
 	}).Equal(t, textToMultiContent("\none\ntwo\ndata:image/png;base64,xxxxx\ndata:image/png;base64,yyyyy"))
 }
 
+func TestToMessagesToolImages(t *testing.T) {
+	msgs, err := toMessages(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{ToolCall: &types.CompletionToolCall{ID: "1", Function: types.CompletionFunctionCall{Name: "screenshot"}}},
+				{ToolCall: &types.CompletionToolCall{ID: "2", Function: types.CompletionFunctionCall{Name: "read"}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Content("data:image/png;base64,xxxx"), ToolCall: &types.CompletionToolCall{ID: "1"}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: []types.ContentPart{
+				{Text: "The file report.pdf is attached"},
+				{File: &types.Media{URL: "data:application/pdf;base64,yyyy", MimeType: "application/pdf", Name: "report.pdf"}},
+			}, ToolCall: &types.CompletionToolCall{ID: "2"}},
+		},
+	}, false)
+	require.NoError(t, err)
+
+	require.Len(t, msgs, 4)
+	assert.Equal(t, "The images are in the next message.", msgs[1].Content)
+	assert.Equal(t, []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: "The file report.pdf is attached"},
+		{Type: openai.ChatMessagePartTypeText, Text: "[The file report.pdf (application/pdf) is attached, but this model can't read files]"},
+	}, msgs[2].MultiContent)
+	assert.Equal(t, openai.ChatCompletionMessage{
+		Role: openai.ChatMessageRoleUser,
+		MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "Images returned by the tool calls:"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,xxxx"}},
+		},
+	}, msgs[3])
+}
+
+func TestImageTokens(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1024, 2048))))
+
+	// Scaled to 768x1536, which is 2x3 tiles.
+	assert.Equal(t, 85+170*6, imageTokens(types.DataURL("image/png", "", buf.Bytes())))
+	assert.Equal(t, 765, imageTokens("https://example.com/chart.png"))
+}
+
 func Test_appendMessage(t *testing.T) {
 	autogold.Expect(types.CompletionMessage{Content: []types.ContentPart{
 		{ToolCall: &types.CompletionToolCall{
@@ -86,3 +138,18 @@ func Test_appendMessage(t *testing.T) {
 		},
 	}))
 }
+
+func TestToolChoice(t *testing.T) {
+	tools := []types.ChatCompletionTool{{Function: types.CompletionFunctionDefinition{Name: "weather"}}}
+
+	assert.Nil(t, toolChoice(types.CompletionRequest{Tools: tools}))
+	assert.Equal(t, "required", toolChoice(types.CompletionRequest{Tools: tools, ToolChoice: types.ToolChoiceRequired}))
+	assert.Equal(t, openai.ToolChoice{
+		Type:     openai.ToolTypeFunction,
+		Function: openai.ToolFunction{Name: "weather"},
+	}, toolChoice(types.CompletionRequest{Tools: tools, ToolChoice: "weather"}))
+
+	assert.Equal(t, map[string]any{"parallel_tool_calls": false}, extraBody(types.CompletionRequest{Tools: tools, ParallelToolCalls: new(bool)}))
+	// parallel_tool_calls can't be sent without tools.
+	assert.Nil(t, extraBody(types.CompletionRequest{ParallelToolCalls: new(bool)}))
+}
@@ -0,0 +1,241 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	// summaryReserveTokens is the room left in the budget for the summary message itself.
+	summaryReserveTokens = 1024
+	maxCachedSummaries   = 1000
+	summaryPrompt        = `You are compacting the history of a conversation between a user and an AI assistant so that it fits in the assistant's context window.
+Summarize the conversation below, including any tool calls and their results. Preserve all facts, decisions, names, numbers,
+file paths, identifiers and open tasks that could be needed to continue the conversation. Respond with only the summary.`
+	summaryMessagePrefix = "Summary of the earlier part of this conversation that is no longer included:\n"
+)
+
+// CompactionRequest is the input to a CompactionStrategy.
+type CompactionRequest struct {
+	Request        types.CompletionRequest
+	Messages       []openai.ChatCompletionMessage
+	MaxTokens      int
+	ToolTokenCount int
+	Env            []string
+}
+
+// CompactionResult is the output of a CompactionStrategy. Dropped is the number of messages that were removed from the
+// original messages and Summary, if set, is the content that was inserted in their place. Usage is the usage of any
+// completions made by the strategy itself.
+type CompactionResult struct {
+	Messages []openai.ChatCompletionMessage
+	Dropped  int
+	Summary  string
+	Usage    types.Usage
+}
+
+// CompactionStrategy reduces the messages of a chat so that they fit within the token budget of the request.
+type CompactionStrategy interface {
+	Compact(ctx context.Context, req CompactionRequest) (CompactionResult, error)
+}
+
+var (
+	compactionLock       sync.RWMutex
+	compactionStrategies = map[string]CompactionStrategy{
+		types.CompactionDrop:      DropStrategy{},
+		types.CompactionSummarize: NewSummarizeStrategy(),
+	}
+)
+
+// RegisterCompactionStrategy makes a strategy available to tools through the "Compaction" directive.
+func RegisterCompactionStrategy(name string, strategy CompactionStrategy) {
+	compactionLock.Lock()
+	defer compactionLock.Unlock()
+	compactionStrategies[strings.ToLower(name)] = strategy
+}
+
+func getCompactionStrategy(name string) (CompactionStrategy, error) {
+	if name == "" {
+		name = types.CompactionDrop
+	}
+
+	compactionLock.RLock()
+	defer compactionLock.RUnlock()
+
+	strategy, ok := compactionStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compaction strategy: %s", name)
+	}
+	return strategy, nil
+}
+
+// DropStrategy discards the oldest non-system messages.
+type DropStrategy struct{}
+
+func (DropStrategy) Compact(_ context.Context, req CompactionRequest) (CompactionResult, error) {
+	system, dropped, kept, err := splitMessagesOverCount(req.MaxTokens, req.ToolTokenCount, req.Messages)
+	if err != nil {
+		return CompactionResult{}, err
+	}
+	return CompactionResult{
+		Messages: append(system, kept...),
+		Dropped:  len(dropped),
+	}, nil
+}
+
+// SummarizeStrategy replaces the oldest non-system messages with a summary of them generated by the model of the
+// request, or the compaction model if one is set.
+type SummarizeStrategy struct {
+	lock      sync.Mutex
+	summaries map[string]string
+}
+
+func NewSummarizeStrategy() *SummarizeStrategy {
+	return &SummarizeStrategy{
+		summaries: map[string]string{},
+	}
+}
+
+func (s *SummarizeStrategy) Compact(ctx context.Context, req CompactionRequest) (CompactionResult, error) {
+	// Only summarize when something would have been dropped anyway.
+	if _, dropped, _, err := splitMessagesOverCount(req.MaxTokens, req.ToolTokenCount, req.Messages); err != nil {
+		return CompactionResult{}, err
+	} else if len(dropped) == 0 {
+		return CompactionResult{
+			Messages: req.Messages,
+		}, nil
+	}
+
+	system, dropped, kept, err := splitMessagesOverCount(getBudget(req.MaxTokens)-summaryReserveTokens, req.ToolTokenCount, req.Messages)
+	if err != nil {
+		return CompactionResult{}, err
+	} else if len(dropped) == 0 {
+		return CompactionResult{
+			Messages: req.Messages,
+		}, nil
+	}
+
+	engineCtx, ok := engine.FromContext(ctx)
+	if !ok || engineCtx.Engine == nil || engineCtx.Engine.Model == nil {
+		log.Warnf("unable to summarize dropped messages without an engine in the context, dropping them instead")
+		return DropStrategy{}.Compact(ctx, req)
+	}
+
+	model := types.FirstSet(req.Request.CompactionModel, req.Request.Model)
+	summary, usage, err := s.summarize(ctx, engineCtx.Engine.Model, model, req.Request.Cache, dropped, req.Env)
+	if err != nil {
+		// Losing the summary is better than failing the whole completion.
+		log.Errorf("failed to summarize dropped messages, dropping them instead: %v", err)
+		return DropStrategy{}.Compact(ctx, req)
+	}
+
+	result := append(system, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: summaryMessagePrefix + summary,
+	})
+	return CompactionResult{
+		Messages: append(result, kept...),
+		Dropped:  len(dropped),
+		Summary:  summary,
+		Usage:    usage,
+	}, nil
+}
+
+// summarize generates a summary of the messages. Summaries of each prefix of the messages are remembered so that,
+// as a chat grows, only the newly dropped messages need to be folded into the previous summary.
+func (s *SummarizeStrategy) summarize(ctx context.Context, model engine.Model, modelName string, cache *bool, msgs []openai.ChatCompletionMessage, env []string) (string, types.Usage, error) {
+	keys := make([]string, len(msgs))
+	prev := modelName
+	for i, msg := range msgs {
+		prev = hash.ID(prev, hash.Digest(msg))
+		keys[i] = prev
+	}
+
+	var (
+		previousSummary string
+		start           int
+	)
+
+	s.lock.Lock()
+	for i := len(keys) - 1; i >= 0; i-- {
+		if summary, ok := s.summaries[keys[i]]; ok {
+			previousSummary = summary
+			start = i + 1
+			break
+		}
+	}
+	s.lock.Unlock()
+
+	if start == len(msgs) {
+		return previousSummary, types.Usage{}, nil
+	}
+
+	transcript := strings.Builder{}
+	if previousSummary != "" {
+		transcript.WriteString("Summary of the conversation before this point:\n")
+		transcript.WriteString(previousSummary)
+		transcript.WriteString("\n\n")
+	}
+	for _, msg := range msgs[start:] {
+		writeTranscriptMessage(&transcript, msg)
+	}
+
+	status := make(chan types.CompletionStatus)
+	go func() {
+		for range status {
+		}
+	}()
+	defer close(status)
+
+	resp, err := model.Call(ctx, types.CompletionRequest{
+		Model:                modelName,
+		InternalSystemPrompt: new(bool),
+		Cache:                cache,
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: types.Text(summaryPrompt),
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text(transcript.String()),
+			},
+		},
+	}, env, status)
+	if err != nil {
+		return "", types.Usage{}, err
+	}
+
+	summary := strings.TrimSpace(resp.ChatText())
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.summaries) >= maxCachedSummaries {
+		clear(s.summaries)
+	}
+	s.summaries[keys[len(keys)-1]] = summary
+
+	return summary, resp.Usage, nil
+}
+
+func writeTranscriptMessage(buf *strings.Builder, msg openai.ChatCompletionMessage) {
+	buf.WriteString(msg.Role)
+	buf.WriteString(": ")
+	buf.WriteString(msg.Content)
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			buf.WriteString(part.Text)
+		}
+	}
+	for _, call := range msg.ToolCalls {
+		_, _ = fmt.Fprintf(buf, "\n<tool call> %s -> %s", call.Function.Name, call.Function.Arguments)
+	}
+	buf.WriteString("\n\n")
+}
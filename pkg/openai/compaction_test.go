@@ -0,0 +1,153 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type summaryModel struct {
+	requests []types.CompletionRequest
+	err      error
+}
+
+func (s *summaryModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	s.requests = append(s.requests, messageRequest)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text(fmt.Sprintf("summary %d", len(s.requests))),
+		Usage:   types.Usage{TotalTokens: 10},
+	}, nil
+}
+
+func (s *summaryModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func compactionMessages(n int) []openai.ChatCompletionMessage {
+	msgs := []openai.ChatCompletionMessage{{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: "system prompt",
+	}}
+	for i := range n {
+		role := openai.ChatMessageRoleUser
+		if i%2 == 1 {
+			role = openai.ChatMessageRoleAssistant
+		}
+		msgs = append(msgs, openai.ChatCompletionMessage{
+			Role:    role,
+			Content: fmt.Sprintf("message %d %s", i, strings.Repeat("word ", 50)),
+		})
+	}
+	return msgs
+}
+
+func TestDropStrategy(t *testing.T) {
+	msgs := compactionMessages(10)
+
+	result, err := DropStrategy{}.Compact(context.Background(), CompactionRequest{
+		Messages:  msgs,
+		MaxTokens: 200,
+	})
+	require.NoError(t, err)
+	require.Equal(t, len(msgs)-len(result.Messages), result.Dropped)
+	require.Equal(t, msgs[0], result.Messages[0])
+	require.Equal(t, msgs[len(msgs)-1], result.Messages[len(result.Messages)-1])
+	require.Empty(t, result.Summary)
+
+	result, err = DropStrategy{}.Compact(context.Background(), CompactionRequest{
+		Messages: msgs,
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Dropped)
+	require.Equal(t, msgs, result.Messages)
+}
+
+func TestSummarizeStrategy(t *testing.T) {
+	model := &summaryModel{}
+	ctx := (&engine.Context{Ctx: context.Background()}).WrappedContext(&engine.Engine{Model: model})
+	strategy := NewSummarizeStrategy()
+
+	request := CompactionRequest{
+		Request: types.CompletionRequest{
+			Model:           "chat-model",
+			CompactionModel: "summary-model",
+		},
+		Messages:  compactionMessages(30),
+		MaxTokens: 1200,
+	}
+
+	result, err := strategy.Compact(ctx, request)
+	require.NoError(t, err)
+	require.NotZero(t, result.Dropped)
+	require.Equal(t, "summary 1", result.Summary)
+	require.Equal(t, 10, result.Usage.TotalTokens)
+	require.Equal(t, request.Messages[0], result.Messages[0])
+	require.Equal(t, openai.ChatMessageRoleSystem, result.Messages[1].Role)
+	require.Equal(t, summaryMessagePrefix+"summary 1", result.Messages[1].Content)
+	require.Equal(t, request.Messages[len(request.Messages)-1], result.Messages[len(result.Messages)-1])
+
+	require.Len(t, model.requests, 1)
+	require.Equal(t, "summary-model", model.requests[0].Model)
+	require.Contains(t, model.requests[0].Messages[1].ChatText(), "message 0 ")
+
+	// Compacting the same history again reuses the previous summary.
+	result, err = strategy.Compact(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, "summary 1", result.Summary)
+	require.Zero(t, result.Usage.TotalTokens)
+	require.Len(t, model.requests, 1)
+
+	// As the history grows only the newly dropped messages are summarized, along with the previous summary.
+	request.Messages = compactionMessages(40)
+	result, err = strategy.Compact(ctx, request)
+	require.NoError(t, err)
+	require.Equal(t, "summary 2", result.Summary)
+	require.Len(t, model.requests, 2)
+	transcript := model.requests[1].Messages[1].ChatText()
+	require.Contains(t, transcript, "summary 1")
+	require.NotContains(t, transcript, "message 0 ")
+}
+
+func TestSummarizeStrategyNotNeeded(t *testing.T) {
+	model := &summaryModel{}
+	ctx := (&engine.Context{Ctx: context.Background()}).WrappedContext(&engine.Engine{Model: model})
+	msgs := compactionMessages(4)
+
+	result, err := NewSummarizeStrategy().Compact(ctx, CompactionRequest{
+		Messages: msgs,
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Dropped)
+	require.Equal(t, msgs, result.Messages)
+	require.Empty(t, model.requests)
+}
+
+func TestSummarizeStrategyFailed(t *testing.T) {
+	model := &summaryModel{err: errors.New("rate limited")}
+	ctx := (&engine.Context{Ctx: context.Background()}).WrappedContext(&engine.Engine{Model: model})
+	request := CompactionRequest{
+		Messages:  compactionMessages(30),
+		MaxTokens: 1200,
+	}
+
+	// The dropped messages are discarded without a summary instead of failing the completion.
+	result, err := NewSummarizeStrategy().Compact(ctx, request)
+	require.NoError(t, err)
+	require.Len(t, model.requests, 1)
+
+	dropped, err := DropStrategy{}.Compact(ctx, request)
+	require.NoError(t, err)
+	require.NotZero(t, result.Dropped)
+	require.Equal(t, dropped, result)
+}
@@ -1,7 +1,15 @@
 package openai
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"image"
+	// Register the decoders of the image formats that can be sent to the LLM
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -27,32 +35,30 @@ func getBudget(maxTokens int) int {
 	return maxTokens
 }
 
-func dropMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) (result []openai.ChatCompletionMessage, err error) {
-	var (
-		lastSystem   int
-		withinBudget int
-		budget       = getBudget(maxTokens) - toolTokenCount
-	)
+// splitMessagesOverCount splits the messages into the leading system messages, the oldest messages that do not fit in
+// the budget, and the newest messages that do.
+func splitMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatCompletionMessage) (system, dropped, kept []openai.ChatCompletionMessage, err error) {
+	budget := getBudget(maxTokens) - toolTokenCount
 
-	for i, msg := range msgs {
+	for _, msg := range msgs {
 		if msg.Role == openai.ChatMessageRoleSystem {
 			count, err := countMessage(msg)
 			if err != nil {
-				return nil, err
+				return nil, nil, nil, err
 			}
 			budget -= count
-			lastSystem = i
-			result = append(result, msg)
+			system = append(system, msg)
 		} else {
 			break
 		}
 	}
 
-	for i := len(msgs) - 1; i > lastSystem; i-- {
+	withinBudget := len(system)
+	for i := len(msgs) - 1; i >= len(system); i-- {
 		withinBudget = i
 		count, err := countMessage(msgs[i])
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 		budget -= count
 		if budget <= 0 {
@@ -71,10 +77,10 @@ func dropMessagesOverCount(maxTokens, toolTokenCount int, msgs []openai.ChatComp
 	if withinBudget == len(msgs)-1 {
 		// We are going to drop all non system messages, which seems useless, so just return them
 		// all and let it fail
-		return msgs, nil
+		return nil, nil, msgs, nil
 	}
 
-	return append(result, msgs[withinBudget:]...), nil
+	return system, msgs[len(system):withinBudget], msgs[withinBudget:], nil
 }
 
 func countMessage(msg openai.ChatCompletionMessage) (int, error) {
@@ -87,6 +93,9 @@ func countMessage(msg openai.ChatCompletionMessage) (int, error) {
 	count += len(encoding.Encode(msg.Content, nil, nil))
 	for _, content := range msg.MultiContent {
 		count += len(encoding.Encode(content.Text, nil, nil))
+		if content.ImageURL != nil {
+			count += imageTokens(content.ImageURL.URL)
+		}
 	}
 	for _, tool := range msg.ToolCalls {
 		count += len(encoding.Encode(tool.Function.Name, nil, nil))
@@ -97,6 +106,31 @@ func countMessage(msg openai.ChatCompletionMessage) (int, error) {
 	return count, nil
 }
 
+// imageTokens estimates the tokens of an image the way OpenAI counts them: the image is scaled to fit in 2048x2048
+// and then down to 768 pixels on its shortest side, and every 512x512 tile costs 170 tokens, plus 85 for the image.
+// Images that can't be decoded, like URLs, are counted as 1024x1024.
+func imageTokens(url string) int {
+	width, height := 1024, 1024
+	if media, ok := types.ParseDataURL(url); ok {
+		if data, ok := media.Base64(); ok {
+			if config, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data))); err == nil && config.Width > 0 && config.Height > 0 {
+				width, height = config.Width, config.Height
+			}
+		}
+	}
+
+	scale := func(factor float64) {
+		if factor < 1 {
+			width, height = int(math.Ceil(float64(width)*factor)), int(math.Ceil(float64(height)*factor))
+		}
+	}
+	scale(2048 / float64(max(width, height)))
+	scale(768 / float64(min(width, height)))
+
+	tiles := int(math.Ceil(float64(width)/512) * math.Ceil(float64(height)/512))
+	return 85 + 170*tiles
+}
+
 func countTools(tools []types.ChatCompletionTool) (int, error) {
 	encoding, err := tiktoken.GetEncoding("o200k_base")
 	if err != nil {
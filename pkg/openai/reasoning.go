@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// reasoningChunk has the fields of a response, or a chunk of a streamed response, that carry the reasoning and the
+// details of the usage. Different OpenAI compatible APIs return the reasoning text as either reasoning_content or
+// reasoning.
+type reasoningChunk struct {
+	Choices []struct {
+		Delta   reasoningContent `json:"delta"`
+		Message reasoningContent `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		CompletionTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+		// OpenAI caches long prompts automatically, and reports how much of the prompt was read from the cache.
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage"`
+}
+
+type reasoningContent struct {
+	ReasoningContent string          `json:"reasoning_content"`
+	Reasoning        json.RawMessage `json:"reasoning"`
+}
+
+func (r reasoningContent) text() string {
+	if r.ReasoningContent != "" {
+		return r.ReasoningContent
+	}
+	var text string
+	// The reasoning field is an object in some APIs, which has no text to show.
+	_ = json.Unmarshal(r.Reasoning, &text)
+	return text
+}
+
+func (s *callState) addReasoning(data []byte) {
+	var chunk reasoningChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		s.reasoning.WriteString(choice.Delta.text())
+		s.reasoning.WriteString(choice.Message.text())
+	}
+	if chunk.Usage != nil {
+		s.reasoningTokens = max(s.reasoningTokens, chunk.Usage.CompletionTokensDetails.ReasoningTokens)
+		s.cachedTokens = max(s.cachedTokens, chunk.Usage.PromptTokensDetails.CachedTokens)
+	}
+}
+
+// readReasoning picks the reasoning out of a successful response while it passes through to the chat completion
+// client.
+func (s *callState) readReasoning(resp *http.Response) (*http.Response, error) {
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/event-stream" {
+		resp.Body = &reasoningReader{
+			ReadCloser: resp.Body,
+			state:      s,
+		}
+		return resp, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	s.addReasoning(data)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// withReasoning puts the reasoning in front of the content of the message.
+func (s *callState) withReasoning(msg types.CompletionMessage) types.CompletionMessage {
+	msg.Usage.ReasoningTokens = types.FirstSet(msg.Usage.ReasoningTokens, s.reasoningTokens)
+	msg.Usage.CacheReadTokens = types.FirstSet(msg.Usage.CacheReadTokens, s.cachedTokens)
+	if s.reasoning.Len() == 0 {
+		return msg
+	}
+	msg.Content = append([]types.ContentPart{{
+		Reasoning: &types.Reasoning{Text: s.reasoning.String()},
+	}}, msg.Content...)
+	return msg
+}
+
+// reasoningReader reads the reasoning from the events of a streamed response.
+type reasoningReader struct {
+	io.ReadCloser
+	state *callState
+	line  []byte
+}
+
+func (r *reasoningReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.line = append(r.line, p[:n]...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		if data, ok := bytes.CutPrefix(bytes.TrimSpace(r.line[:i]), []byte("data:")); ok {
+			r.state.addReasoning(bytes.TrimSpace(data))
+		}
+		r.line = r.line[i+1:]
+	}
+	return n, err
+}
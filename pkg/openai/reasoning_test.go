@@ -0,0 +1,88 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testReasoningCall(t *testing.T, handler http.HandlerFunc) (*types.CompletionMessage, map[string]any) {
+	t.Helper()
+
+	var received map[string]any
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	c, err := NewClient(context.Background(), nil, Options{BaseURL: s.URL, APIKey: "test-key"})
+	require.NoError(t, err)
+
+	result, err := c.Call(context.Background(), types.CompletionRequest{
+		Model:           "o4-mini",
+		ReasoningEffort: "6000",
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("Hi")},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{Reasoning: &types.Reasoning{Text: "The user greets me."}},
+				{Text: "Hello!"},
+			}},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("How are you?")},
+		},
+	}, nil, make(chan types.CompletionStatus, 100))
+	require.NoError(t, err)
+	return result, received
+}
+
+func TestReasoning(t *testing.T) {
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	result, received := testReasoningCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"Fine.","reasoning_content":"They ask how I am."}}],
+			"usage":{"prompt_tokens":10,"completion_tokens":50,"total_tokens":60,"completion_tokens_details":{"reasoning_tokens":40}}}`))
+	})
+
+	assert.Equal(t, "medium", received["reasoning_effort"])
+	assert.NotContains(t, received, "temperature")
+	// The reasoning isn't sent back to the model.
+	messages := received["messages"].([]any)
+	assert.Equal(t, map[string]any{"role": "assistant", "content": "Hello!"}, messages[len(messages)-2])
+
+	assert.Equal(t, []types.ContentPart{
+		{Reasoning: &types.Reasoning{Text: "They ask how I am."}},
+		{Text: "Fine."},
+	}, result.Content)
+	assert.Equal(t, types.Usage{PromptTokens: 10, CompletionTokens: 50, TotalTokens: 60, ReasoningTokens: 40}, result.Usage)
+}
+
+func TestReasoningStream(t *testing.T) {
+	result, received := testReasoningCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"id":"1","choices":[{"index":0,"delta":{"role":"assistant","reasoning":"They ask "}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"reasoning":"how I am."}}]}`,
+			`{"id":"1","choices":[{"index":0,"delta":{"content":"Fine."},"finish_reason":"stop"}]}`,
+			`{"id":"1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":50,"total_tokens":60,"completion_tokens_details":{"reasoning_tokens":40},"prompt_tokens_details":{"cached_tokens":8}}}`,
+		} {
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+
+	assert.Equal(t, "medium", received["reasoning_effort"])
+	assert.Equal(t, []types.ContentPart{
+		{Reasoning: &types.Reasoning{Text: "They ask how I am."}},
+		{Text: "Fine."},
+	}, result.Content)
+	assert.Equal(t, 40, result.Usage.ReasoningTokens)
+	assert.Equal(t, 8, result.Usage.CacheReadTokens)
+}
@@ -0,0 +1,279 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+)
+
+const DefaultMaxRetries = 5
+
+var (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+)
+
+type callStateKey struct{}
+
+// callState is the per call state shared between Client.call and the retryTransport.
+type callState struct {
+	maxRetries int
+	limiter    *limiter
+	// apiError is the error returned by the last failed response, so that callers get a typed error instead of
+	// the string errors returned by the chat completion client.
+	apiError error
+	// extraBody holds the request fields that the chat completion client doesn't know about.
+	extraBody map[string]any
+	// reasoning, reasoningTokens and cachedTokens are read from the response, the chat completion client drops them.
+	reasoning       strings.Builder
+	reasoningTokens int
+	cachedTokens    int
+}
+
+func withCallState(ctx context.Context, state *callState) context.Context {
+	return context.WithValue(ctx, callStateKey{}, state)
+}
+
+// retryTransport retries requests that were rate limited or failed with a server error and waits for the
+// limiter of the call before each attempt. Requests without a callState are passed through as is.
+type retryTransport struct {
+	next http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	state, _ := req.Context().Value(callStateKey{}).(*callState)
+	if state == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil && (state.maxRetries > 0 || len(state.extraBody) > 0) {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if body, err = extendBody(body, state.extraBody); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := state.limiter.wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		attemptReq := req
+		if body != nil {
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			attemptReq.ContentLength = int64(len(body))
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+		state.limiter.update(resp.Header)
+
+		if resp.StatusCode < http.StatusBadRequest {
+			return state.readReasoning(resp)
+		}
+
+		if !retryableStatus(resp.StatusCode) || attempt >= state.maxRetries {
+			return state.recordError(resp), nil
+		}
+
+		delay := retryDelay(resp.Header, attempt)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// Hold back the other calls to this model too, they would only be rate limited as well.
+			state.limiter.pause(delay)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		log.Infof("Request to %s failed with status %d, retrying in %s (attempt %d/%d)", req.URL.Path, resp.StatusCode, delay.Round(time.Millisecond), attempt+1, state.maxRetries)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// recordError saves the error of a failed response in the state and returns the response with its body restored.
+func (s *callState) recordError(resp *http.Response) *http.Response {
+	data, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	var errResp openai.ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error != nil && errResp.Error.Message != "" {
+		errResp.Error.HTTPStatusCode = resp.StatusCode
+		errResp.Error.HTTPStatus = resp.Status
+		s.apiError = errResp.Error
+	} else {
+		s.apiError = &openai.RequestError{
+			HTTPStatusCode: resp.StatusCode,
+			HTTPStatus:     resp.Status,
+			Err:            errorString(strings.TrimSpace(string(data))),
+		}
+	}
+	return resp
+}
+
+type errorString string
+
+func (e errorString) Error() string {
+	return string(e)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// retryDelay returns how long to wait before the next attempt. The Retry-After and x-ratelimit-reset-* headers
+// win over the exponential backoff because the provider knows best when the limit resets.
+func retryDelay(header http.Header, attempt int) time.Duration {
+	if delay, ok := retryAfter(header); ok {
+		return min(delay, retryMaxDelay)
+	}
+
+	if delay, ok := rateLimitReset(header); ok {
+		return min(delay, retryMaxDelay)
+	}
+
+	delay := min(retryBaseDelay<<attempt, retryMaxDelay)
+	// Full jitter over the upper half of the delay keeps parallel calls from retrying in lockstep.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func retryAfter(header http.Header) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// rateLimitReset returns the time until the exhausted request or token limit resets.
+func rateLimitReset(header http.Header) (time.Duration, bool) {
+	var (
+		result time.Duration
+		found  bool
+	)
+	for _, kind := range []string{"requests", "tokens"} {
+		if header.Get("X-Ratelimit-Remaining-"+kind) != "0" {
+			continue
+		}
+		if reset, err := time.ParseDuration(header.Get("X-Ratelimit-Reset-" + kind)); err == nil {
+			result = max(result, reset)
+			found = true
+		}
+	}
+	return result, found
+}
+
+// limiter is a token bucket of requests per minute. Independent of the configured rate it also stops sending
+// requests while the provider reports that the rate limit is exhausted.
+type limiter struct {
+	lock        sync.Mutex
+	perSecond   float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time
+}
+
+func newLimiter(requestsPerMinute int) *limiter {
+	return &limiter{
+		perSecond: float64(requestsPerMinute) / 60,
+		tokens:    float64(requestsPerMinute),
+		last:      time.Now(),
+	}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		delay := l.reserve()
+		if delay <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// reserve takes a token if one is available, otherwise it returns how long to wait before trying again.
+func (l *limiter) reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(l.pausedUntil) {
+		return l.pausedUntil.Sub(now)
+	}
+
+	if l.perSecond <= 0 {
+		return 0
+	}
+
+	capacity := l.perSecond * 60
+	l.tokens = min(capacity, l.tokens+now.Sub(l.last).Seconds()*l.perSecond)
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.perSecond * float64(time.Second))
+}
+
+func (l *limiter) pause(delay time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if until := time.Now().Add(delay); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+func (l *limiter) update(header http.Header) {
+	if reset, ok := rateLimitReset(header); ok {
+		l.pause(min(reset, retryMaxDelay))
+	}
+}
+
+// limiterFor returns the limiter shared by all calls of this client to the given model.
+func (c *Client) limiterFor(model string) *limiter {
+	c.limitersLock.Lock()
+	defer c.limitersLock.Unlock()
+
+	l, ok := c.limiters[model]
+	if !ok {
+		l = newLimiter(c.requestsPerMinute)
+		c.limiters[model] = l
+	}
+	return l
+}
@@ -0,0 +1,150 @@
+package openai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/gptscript-ai/chat-completion-client"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCall(t *testing.T, handler http.HandlerFunc, opts Options, env ...string) (types.CompletionMessage, error) {
+	t.Helper()
+	t.Setenv("GPTSCRIPT_INTERNAL_OPENAI_STREAMING", "false")
+
+	s := httptest.NewServer(handler)
+	t.Cleanup(s.Close)
+
+	opts.BaseURL = s.URL
+	opts.APIKey = "test-key"
+	c, err := NewClient(context.Background(), nil, opts)
+	require.NoError(t, err)
+
+	status := make(chan types.CompletionStatus, 100)
+	return c.call(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Hi"}},
+	}, nil, "1", env, status)
+}
+
+func writeCompletion(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"id":"1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"}}]}`))
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	var calls int
+	result, err := testCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`))
+			return
+		}
+		writeCompletion(w)
+	}, Options{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, "Hello", result.String())
+}
+
+func TestRetryServerErrorExhausted(t *testing.T) {
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = time.Second })
+
+	var calls int
+	_, err := testCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("upstream unavailable"))
+	}, Options{MaxRetries: 2})
+	assert.Equal(t, 3, calls)
+
+	var reqErr *openai.RequestError
+	require.ErrorAs(t, err, &reqErr)
+	assert.Equal(t, http.StatusBadGateway, reqErr.HTTPStatusCode)
+	assert.Contains(t, err.Error(), "upstream unavailable")
+}
+
+func TestRetryDisabled(t *testing.T) {
+	var calls int
+	_, err := testCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, Options{}, "GPTSCRIPT_DISABLE_RETRIES=true")
+	require.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	var calls int
+	_, err := testCall(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":{"message":"This model's maximum context length is 128000 tokens","type":"invalid_request_error","code":"context_length_exceeded"}}`))
+	}, Options{})
+	assert.Equal(t, 1, calls)
+
+	var apiErr *openai.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "context_length_exceeded", apiErr.Code)
+	assert.Equal(t, http.StatusBadRequest, apiErr.HTTPStatusCode)
+}
+
+func TestRetryDelay(t *testing.T) {
+	delay, ok := retryAfter(http.Header{"Retry-After": []string{"3"}})
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, delay)
+
+	delay, ok = retryAfter(http.Header{"Retry-After-Ms": []string{"250"}})
+	assert.True(t, ok)
+	assert.Equal(t, 250*time.Millisecond, delay)
+
+	_, ok = retryAfter(http.Header{"Retry-After": []string{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}})
+	assert.True(t, ok)
+
+	delay, ok = rateLimitReset(http.Header{
+		"X-Ratelimit-Remaining-Requests": []string{"10"},
+		"X-Ratelimit-Reset-Requests":     []string{"1s"},
+		"X-Ratelimit-Remaining-Tokens":   []string{"0"},
+		"X-Ratelimit-Reset-Tokens":       []string{"6m0s"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, 6*time.Minute, delay)
+
+	assert.Equal(t, retryMaxDelay, retryDelay(http.Header{"Retry-After": []string{"3600"}}, 0))
+
+	for attempt := range 3 {
+		delay := retryDelay(http.Header{}, attempt)
+		assert.GreaterOrEqual(t, delay, (retryBaseDelay<<attempt)/2)
+		assert.LessOrEqual(t, delay, retryBaseDelay<<attempt)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(60)
+	for range 60 {
+		assert.Zero(t, l.reserve())
+	}
+	delay := l.reserve()
+	assert.Greater(t, delay, time.Duration(0))
+	assert.LessOrEqual(t, delay, time.Second)
+
+	unlimited := newLimiter(0)
+	assert.Zero(t, unlimited.reserve())
+	unlimited.update(http.Header{
+		"X-Ratelimit-Remaining-Requests": []string{"0"},
+		"X-Ratelimit-Reset-Requests":     []string{"2s"},
+	})
+	assert.Greater(t, unlimited.reserve(), time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, unlimited.wait(ctx), context.Canceled)
+}
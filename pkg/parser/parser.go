@@ -114,6 +114,10 @@ func isParam(line string, tool *types.Tool, scan *simplescanner) (_ bool, err er
 		tool.OutputFilters = append(tool.OutputFilters, csv(scan.AddMultiline(value))...)
 	case "shareoutputfilter", "shareoutputfilters", "sharedoutputfilter", "sharedoutputfilters":
 		tool.ExportOutputFilters = append(tool.ExportOutputFilters, csv(scan.AddMultiline(value))...)
+	case "hook", "hooks":
+		tool.Hooks = append(tool.Hooks, csv(scan.AddMultiline(value))...)
+	case "sharehook", "sharehooks", "sharedhook", "sharedhooks":
+		tool.ExportHooks = append(tool.ExportHooks, csv(scan.AddMultiline(value))...)
 	case "agent", "agents":
 		tool.Agents = append(tool.Agents, csv(scan.AddMultiline(value))...)
 	case "globaltool", "globaltools":
@@ -159,6 +163,23 @@ func isParam(line string, tool *types.Tool, scan *simplescanner) (_ bool, err er
 		if err != nil {
 			return false, err
 		}
+	case "compaction", "contextcompaction":
+		tool.Compaction = strings.ToLower(value)
+	case "compactionmodel", "compactionmodelname":
+		tool.CompactionModel = value
+	case "reasoningeffort", "reasoning":
+		tool.ReasoningEffort, err = types.ParseReasoningEffort(value)
+		if err != nil {
+			return false, err
+		}
+	case "toolchoice":
+		tool.ToolChoice = types.ParseToolChoice(value)
+	case "paralleltoolcalls", "paralleltools":
+		b, err := toBool(value)
+		if err != nil {
+			return false, err
+		}
+		tool.ParallelToolCalls = &b
 	case "credentials", "creds", "credential", "cred":
 		tool.Credentials = append(tool.Credentials, csv(scan.AddMultiline(value))...)
 	case "sharecredentials", "sharecreds", "sharecredential", "sharecred", "sharedcredentials", "sharedcreds", "sharedcredential", "sharedcred":
@@ -216,6 +237,7 @@ func (c *context) finish(tools *[]Node) {
 		len(c.tool.GlobalTools) > 0 ||
 		len(c.tool.ExportInputFilters) > 0 ||
 		len(c.tool.ExportOutputFilters) > 0 ||
+		len(c.tool.ExportHooks) > 0 ||
 		len(c.tool.Agents) > 0 ||
 		len(c.tool.ExportCredentials) > 0 ||
 		c.tool.Chat {
@@ -242,6 +242,59 @@ share output filters: shared
 	}}).Equal(t, out)
 }
 
+func TestParseReasoningEffort(t *testing.T) {
+	out, err := Parse(strings.NewReader(`
+reasoning effort: High
+
+Solve the puzzle
+`))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	assert.Equal(t, types.ReasoningEffortHigh, out.Nodes[0].ToolNode.Tool.ReasoningEffort)
+
+	out, err = Parse(strings.NewReader(`
+reasoning: 2048
+
+Solve the puzzle
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "2048", out.Nodes[0].ToolNode.Tool.ReasoningEffort)
+
+	_, err = Parse(strings.NewReader(`
+reasoning effort: extreme
+
+Solve the puzzle
+`))
+	assert.ErrorContains(t, err, `invalid reasoning effort "extreme"`)
+}
+
+func TestParseToolChoice(t *testing.T) {
+	out, err := Parse(strings.NewReader(`
+tools: weather
+tool choice: Required
+parallel tool calls: false
+
+What is the weather?
+`))
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	tool := out.Nodes[0].ToolNode.Tool
+	assert.Equal(t, types.ToolChoiceRequired, tool.ToolChoice)
+	require.NotNil(t, tool.ParallelToolCalls)
+	assert.False(t, *tool.ParallelToolCalls)
+	assert.Contains(t, tool.Print(), "Tool Choice: required\nParallel Tool Calls: false\n")
+
+	// The names of tools keep their case.
+	out, err = Parse(strings.NewReader(`
+tools: Weather
+tool choice: Weather
+
+What is the weather?
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "Weather", out.Nodes[0].ToolNode.Tool.ToolChoice)
+}
+
 func TestParseMetaDataSpace(t *testing.T) {
 	input := `
 name: a space
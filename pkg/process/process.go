@@ -0,0 +1,271 @@
+// Package process runs commands in the background for the duration of a run, so that a tool can start a long-running
+// command like a server, use it, and stop it again.
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// maxOutput is how much unread output of each stream is kept. Older output is dropped when a process writes more
+	// than this between two reads.
+	maxOutput = 1 << 20
+
+	// stopTimeout is how long a process has to exit after it is interrupted before it is killed.
+	stopTimeout = 5 * time.Second
+)
+
+type managerContextKey struct{}
+
+// WithManager returns a context with a new Manager. The processes of the manager are not stopped when the context is
+// canceled, Close must be called for that.
+func WithManager(ctx context.Context) (context.Context, *Manager) {
+	m := &Manager{
+		procs: map[string]*Process{},
+	}
+	m.ctx, m.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	return context.WithValue(ctx, managerContextKey{}, m), m
+}
+
+// FromContext returns the Manager of the run, or nil if there is none.
+func FromContext(ctx context.Context) *Manager {
+	m, _ := ctx.Value(managerContextKey{}).(*Manager)
+	return m
+}
+
+// Manager keeps track of the background processes of a run.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	lock   sync.Mutex
+	next   int
+	procs  map[string]*Process
+	closed bool
+}
+
+// Start starts command with the shell in dir.
+func (m *Manager) Start(command, dir string, env []string) (*Process, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return nil, errors.New("the run has finished")
+	}
+
+	m.next++
+	p := &Process{
+		ID:      fmt.Sprintf("proc-%d", m.next),
+		Command: command,
+		done:    make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	p.ctx, p.stop = ctx, cancel
+
+	if runtime.GOOS == "windows" {
+		p.cmd = exec.CommandContext(ctx, "cmd.exe", "/c", command)
+	} else {
+		p.cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	p.cmd.Env = env
+	p.cmd.Dir = dir
+	p.cmd.Stdout = &p.stdout
+	p.cmd.Stderr = &p.stderr
+	setProcessGroup(p.cmd)
+	// Give the process a chance to shut down cleanly when it is stopped.
+	p.cmd.Cancel = func() error {
+		if runtime.GOOS == "windows" {
+			return p.cmd.Process.Kill()
+		}
+		return signal(p.cmd.Process, os.Interrupt)
+	}
+	p.cmd.WaitDelay = stopTimeout
+
+	if err := p.cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+	p.StartedAt = time.Now()
+
+	log.Debugf("Started process %s (pid %d): %s", p.ID, p.cmd.Process.Pid, command)
+	go p.wait()
+
+	m.procs[p.ID] = p
+	return p, nil
+}
+
+// Get returns the process with the given ID.
+func (m *Manager) Get(id string) (*Process, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	p, ok := m.procs[id]
+	if !ok {
+		return nil, fmt.Errorf("there is no process with ID %q", id)
+	}
+	return p, nil
+}
+
+// List returns all processes in the order they were started.
+func (m *Manager) List() []*Process {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := make([]*Process, 0, len(m.procs))
+	for _, p := range m.procs {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartedAt.Before(result[j].StartedAt)
+	})
+	return result
+}
+
+// Close stops all processes that are still running and waits for them to exit. No processes can be started after.
+func (m *Manager) Close() {
+	m.lock.Lock()
+	m.closed = true
+	procs := make([]*Process, 0, len(m.procs))
+	for _, p := range m.procs {
+		procs = append(procs, p)
+	}
+	m.lock.Unlock()
+
+	m.cancel()
+	for _, p := range procs {
+		<-p.done
+	}
+}
+
+// Process is a command running in the background.
+type Process struct {
+	ID        string
+	Command   string
+	StartedAt time.Time
+
+	ctx    context.Context
+	stop   context.CancelFunc
+	cmd    *exec.Cmd
+	stdout outputBuffer
+	stderr outputBuffer
+
+	done       chan struct{}
+	err        error
+	finishedAt time.Time
+}
+
+func (p *Process) wait() {
+	err := p.cmd.Wait()
+	log.Debugf("Process %s exited: %v", p.ID, err)
+
+	p.err = err
+	p.finishedAt = time.Now()
+	close(p.done)
+	p.stop()
+}
+
+func (p *Process) Pid() int {
+	return p.cmd.Process.Pid
+}
+
+// Context is done when the process exited or was stopped.
+func (p *Process) Context() context.Context {
+	return p.ctx
+}
+
+// Stop interrupts the process, and kills it if it doesn't exit in time.
+func (p *Process) Stop() {
+	p.stop()
+}
+
+// Signal sends a signal to the process and the processes it started.
+func (p *Process) Signal(sig os.Signal) error {
+	if p.Exited() {
+		return errors.New("the process has already exited")
+	}
+	return signal(p.cmd.Process, sig)
+}
+
+func (p *Process) Exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits until the process exits, the timeout passes or ctx is canceled. It returns true if the process exited.
+func (p *Process) Wait(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.done:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// Output returns the output the process wrote since the last call, and how many bytes of it were dropped because
+// there was too much.
+func (p *Process) Output() (stdout, stderr string, dropped int) {
+	stdout, droppedStdout := p.stdout.read()
+	stderr, droppedStderr := p.stderr.read()
+	return stdout, stderr, droppedStdout + droppedStderr
+}
+
+// Status describes whether the process is still running, or how it exited.
+func (p *Process) Status() string {
+	if !p.Exited() {
+		return fmt.Sprintf("is running for %s", time.Since(p.StartedAt).Round(time.Second))
+	}
+
+	elapsed := p.finishedAt.Sub(p.StartedAt).Round(time.Second)
+	var exitErr *exec.ExitError
+	switch {
+	case p.err == nil:
+		return fmt.Sprintf("exited with code 0 after %s", elapsed)
+	case errors.As(p.err, &exitErr) && exitErr.ExitCode() >= 0:
+		return fmt.Sprintf("exited with code %d after %s", exitErr.ExitCode(), elapsed)
+	default:
+		return fmt.Sprintf("exited after %s: %v", elapsed, p.err)
+	}
+}
+
+type outputBuffer struct {
+	lock    sync.Mutex
+	data    []byte
+	dropped int
+}
+
+func (o *outputBuffer) Write(p []byte) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.data = append(o.data, p...)
+	if extra := len(o.data) - maxOutput; extra > 0 {
+		o.dropped += extra
+		o.data = append([]byte(nil), o.data[extra:]...)
+	}
+	return len(p), nil
+}
+
+func (o *outputBuffer) read() (string, int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	data, dropped := string(o.data), o.dropped
+	o.data, o.dropped = nil, 0
+	return data, dropped
+}
@@ -0,0 +1,12 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(*exec.Cmd) {}
+
+func signal(p *os.Process, sig os.Signal) error {
+	return p.Signal(sig)
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -60,6 +62,10 @@ func SysPrompt(ctx context.Context, envs []string, input string, _ chan<- string
 		return "", err
 	}
 
+	if err := params.Fields.Check(); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
 	for _, env := range envs {
 		if url, ok := strings.CutPrefix(env, types.PromptURLEnvVar+"="); ok {
 			httpPrompt := types.Prompt{
@@ -96,22 +102,11 @@ func sysPrompt(ctx context.Context, req types.Prompt) (_ string, err error) {
 
 	results := map[string]string{}
 	for _, f := range req.Fields {
-		var (
-			value     string
-			msg       = f.Name
-			sensitive = req.Sensitive
-		)
-		if f.Sensitive != nil {
-			sensitive = *f.Sensitive
-		}
+		msg := f.Name
 		if len(req.Fields) == 1 && req.Message != "" {
 			msg = req.Message
 		}
-		if sensitive {
-			err = survey.AskOne(&survey.Password{Message: msg, Help: f.Description}, &value, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr))
-		} else {
-			err = survey.AskOne(&survey.Input{Message: msg, Help: f.Description}, &value, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr))
-		}
+		value, err := askField(f, msg, req.Sensitive)
 		if err != nil {
 			return "", err
 		}
@@ -125,3 +120,60 @@ func sysPrompt(ctx context.Context, req types.Prompt) (_ string, err error) {
 
 	return string(resultsStr), nil
 }
+
+// askField asks for the value of a field with the survey prompt that fits its type. The default value is used if
+// nothing is entered.
+func askField(f types.Field, msg string, sensitive bool) (string, error) {
+	var (
+		value string
+		opts  = []survey.AskOpt{
+			survey.WithStdio(os.Stdin, os.Stderr, os.Stderr),
+			survey.WithValidator(func(ans any) error {
+				if s, ok := ans.(string); ok {
+					return f.Validate(s)
+				}
+				return nil
+			}),
+		}
+		err error
+	)
+
+	switch {
+	case f.IsSensitive(sensitive):
+		err = survey.AskOne(&survey.Password{Message: msg, Help: f.Description}, &value, opts...)
+	case f.Type == types.FieldTypeBoolean:
+		var (
+			answer bool
+			def, _ = strconv.ParseBool(f.Default)
+		)
+		if err := survey.AskOne(&survey.Confirm{Message: msg, Help: f.Description, Default: def}, &answer, opts...); err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(answer), nil
+	case len(f.Options) > 0:
+		s := &survey.Select{Message: msg, Help: f.Description, Options: f.Options}
+		if f.Default != "" {
+			s.Default = f.Default
+		}
+		err = survey.AskOne(s, &value, opts...)
+	case f.Type == types.FieldTypeMultiline:
+		err = survey.AskOne(&survey.Multiline{Message: msg, Help: f.Description, Default: f.Default}, &value, opts...)
+	case f.Type == types.FieldTypeFile:
+		err = survey.AskOne(&survey.Input{Message: msg, Help: f.Description, Default: f.Default, Suggest: suggestFiles}, &value, opts...)
+	default:
+		err = survey.AskOne(&survey.Input{Message: msg, Help: f.Description, Default: f.Default}, &value, opts...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		value = f.Default
+	}
+	return value, nil
+}
+
+func suggestFiles(toComplete string) []string {
+	files, _ := filepath.Glob(toComplete + "*")
+	return files
+}
@@ -11,6 +11,7 @@ import (
 
 	openai2 "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/config"
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	env2 "github.com/gptscript-ai/gptscript/pkg/env"
@@ -29,21 +30,23 @@ type Client struct {
 	envs            []string
 	credStore       credentials.CredentialStore
 	defaultProvider string
+	aliases         config.ModelAliases
 }
 
-func New(r *runner.Runner, envs []string, cache *cache.Client, credStore credentials.CredentialStore, defaultProvider string) *Client {
+func New(r *runner.Runner, envs []string, cache *cache.Client, credStore credentials.CredentialStore, defaultProvider string, aliases config.ModelAliases) *Client {
 	return &Client{
 		cache:           cache,
 		runner:          r,
 		envs:            envs,
 		credStore:       credStore,
 		defaultProvider: defaultProvider,
+		aliases:         aliases,
 		clients:         make(map[string]clientInfo),
 	}
 }
 
 func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, env []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
-	_, provider := c.parseModel(messageRequest.Model)
+	modelName, provider := c.parseModel(messageRequest.Model)
 	if provider == "" {
 		return nil, fmt.Errorf("failed to find remote model %s", messageRequest.Model)
 	}
@@ -53,12 +56,6 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		return nil, err
 	}
 
-	toolName, modelName := types.SplitToolRef(messageRequest.Model)
-	if modelName == "" {
-		// modelName is empty, then the messageRequest.Model is not of the form 'modelName from provider'
-		// Therefore, the modelName is the toolName
-		modelName = toolName
-	}
 	messageRequest.Model = modelName
 	return client.Call(ctx, messageRequest, env, status)
 }
@@ -87,6 +84,7 @@ func (c *Client) ListModels(ctx context.Context, providers ...string) (result []
 }
 
 func (c *Client) parseModel(modelString string) (modelName, providerName string) {
+	modelString, _, _ = c.aliases.Resolve(modelString)
 	toolName, subTool := types.SplitToolRef(modelString)
 	if subTool == "" {
 		// This is just a plain model string "gpt4o"
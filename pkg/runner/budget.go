@@ -0,0 +1,256 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const maxPartialResultLength = 500
+
+// Budget defines the limits enforced across all calls of a single run. A zero value for any limit disables it.
+type Budget struct {
+	MaxPromptTokens     int                   `json:"maxPromptTokens,omitempty"`
+	MaxCompletionTokens int                   `json:"maxCompletionTokens,omitempty"`
+	MaxTotalTokens      int                   `json:"maxTotalTokens,omitempty"`
+	MaxDuration         time.Duration         `json:"maxDuration,omitempty"`
+	MaxCost             float64               `json:"maxCost,omitempty"`
+	ModelPrices         map[string]ModelPrice `json:"modelPrices,omitempty"`
+}
+
+// ModelPrice is the price of a model in an arbitrary currency per one million tokens. Prompt tokens that were read
+// from or written to the prompt cache of the provider cost the prompt price unless their own price is set.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt,omitempty"`
+	Completion float64 `json:"completion,omitempty"`
+	CacheRead  float64 `json:"cacheRead,omitempty"`
+	CacheWrite float64 `json:"cacheWrite,omitempty"`
+}
+
+func (p ModelPrice) cost(usage types.Usage) float64 {
+	prompt := usage.PromptTokens - usage.CacheReadTokens - usage.CacheWriteTokens
+	return (float64(prompt)*p.Prompt +
+		float64(usage.CacheReadTokens)*types.FirstSet(p.CacheRead, p.Prompt) +
+		float64(usage.CacheWriteTokens)*types.FirstSet(p.CacheWrite, p.Prompt) +
+		float64(usage.CompletionTokens)*p.Completion) / 1_000_000
+}
+
+func completeBudget(left, right Budget) Budget {
+	left.MaxPromptTokens = types.FirstSet(right.MaxPromptTokens, left.MaxPromptTokens)
+	left.MaxCompletionTokens = types.FirstSet(right.MaxCompletionTokens, left.MaxCompletionTokens)
+	left.MaxTotalTokens = types.FirstSet(right.MaxTotalTokens, left.MaxTotalTokens)
+	left.MaxDuration = types.FirstSet(right.MaxDuration, left.MaxDuration)
+	left.MaxCost = types.FirstSet(right.MaxCost, left.MaxCost)
+	if right.ModelPrices != nil {
+		left.ModelPrices = right.ModelPrices
+	}
+	return left
+}
+
+// ReadModelPrices reads a JSON file that maps model names to their prices per one million tokens.
+func ReadModelPrices(file string) (map[string]ModelPrice, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model prices %s: %w", file, err)
+	}
+
+	var result map[string]ModelPrice
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse model prices %s: %w", file, err)
+	}
+	return result, nil
+}
+
+// RunUsage is the aggregate usage of all the LLM calls made during a run.
+type RunUsage struct {
+	types.Usage `json:",inline"`
+	Cost        float64       `json:"cost,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+}
+
+type PartialResult struct {
+	ToolName string `json:"toolName,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+type ErrBudgetExceeded struct {
+	Reason  string          `json:"reason,omitempty"`
+	Usage   RunUsage        `json:"usage,omitempty"`
+	Partial []PartialResult `json:"partial,omitempty"`
+}
+
+func (e *ErrBudgetExceeded) Error() string {
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("run budget exceeded: %s (prompt tokens: %d, completion tokens: %d, total tokens: %d, estimated cost: %.4f, duration: %s)",
+		e.Reason, e.Usage.PromptTokens, e.Usage.CompletionTokens, e.Usage.TotalTokens, e.Usage.Cost, e.Usage.Duration.Round(time.Millisecond)))
+
+	if len(e.Partial) > 0 {
+		buf.WriteString("\n\nPartial results:")
+		for _, result := range e.Partial {
+			content := result.Content
+			if len(content) > maxPartialResultLength {
+				content = content[:maxPartialResultLength] + "..."
+			}
+			buf.WriteString(fmt.Sprintf("\n[%s] %s", result.ToolName, content))
+		}
+	}
+
+	return buf.String()
+}
+
+type budgetContextKey struct{}
+
+type budgetTracker struct {
+	budget    Budget
+	start     time.Time
+	cancel    context.CancelCauseFunc
+	timer     *time.Timer
+	lock      sync.Mutex
+	usage     types.Usage
+	cost      float64
+	partial   []PartialResult
+	exceeded  *ErrBudgetExceeded
+	unpriced  map[string]struct{}
+	closeOnce sync.Once
+}
+
+func newBudgetTracker(ctx context.Context, budget Budget) (context.Context, *budgetTracker) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	b := &budgetTracker{
+		budget:   budget,
+		start:    time.Now(),
+		cancel:   cancel,
+		unpriced: map[string]struct{}{},
+	}
+	if budget.MaxDuration > 0 {
+		b.timer = time.AfterFunc(budget.MaxDuration, func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+			b.exceed(fmt.Sprintf("maximum duration of %s reached", budget.MaxDuration))
+		})
+	}
+	return context.WithValue(ctx, budgetContextKey{}, b), b
+}
+
+func budgetFromContext(ctx context.Context) *budgetTracker {
+	b, _ := ctx.Value(budgetContextKey{}).(*budgetTracker)
+	return b
+}
+
+func (b *budgetTracker) close() {
+	if b == nil {
+		return
+	}
+	b.closeOnce.Do(func() {
+		if b.timer != nil {
+			b.timer.Stop()
+		}
+		b.cancel(nil)
+	})
+}
+
+func (b *budgetTracker) price(modelName string) (ModelPrice, bool) {
+	if price, ok := b.budget.ModelPrices[modelName]; ok {
+		return price, true
+	}
+	model, provider := types.SplitToolRef(modelName)
+	if provider != "" {
+		model = provider
+	}
+	price, ok := b.budget.ModelPrices[model]
+	return price, ok
+}
+
+// add records the usage of a single completion and aborts the run if any limit has been exceeded.
+func (b *budgetTracker) add(modelName string, usage types.Usage) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.usage.PromptTokens += usage.PromptTokens
+	b.usage.CompletionTokens += usage.CompletionTokens
+	b.usage.TotalTokens += types.FirstSet(usage.TotalTokens, usage.PromptTokens+usage.CompletionTokens)
+	b.usage.CacheReadTokens += usage.CacheReadTokens
+	b.usage.CacheWriteTokens += usage.CacheWriteTokens
+
+	if price, ok := b.price(modelName); ok {
+		b.cost += price.cost(usage)
+	} else if _, warned := b.unpriced[modelName]; !warned && b.budget.MaxCost > 0 {
+		b.unpriced[modelName] = struct{}{}
+		log.Warnf("No price configured for model %s, its usage will not count towards the cost budget", modelName)
+	}
+
+	switch {
+	case b.budget.MaxPromptTokens > 0 && b.usage.PromptTokens > b.budget.MaxPromptTokens:
+		b.exceed(fmt.Sprintf("maximum prompt tokens of %d reached", b.budget.MaxPromptTokens))
+	case b.budget.MaxCompletionTokens > 0 && b.usage.CompletionTokens > b.budget.MaxCompletionTokens:
+		b.exceed(fmt.Sprintf("maximum completion tokens of %d reached", b.budget.MaxCompletionTokens))
+	case b.budget.MaxTotalTokens > 0 && b.usage.TotalTokens > b.budget.MaxTotalTokens:
+		b.exceed(fmt.Sprintf("maximum total tokens of %d reached", b.budget.MaxTotalTokens))
+	case b.budget.MaxCost > 0 && b.cost > b.budget.MaxCost:
+		b.exceed(fmt.Sprintf("maximum estimated cost of %.4f reached", b.budget.MaxCost))
+	}
+}
+
+// recordResult saves the output of a finished call so that it can be reported if the run is aborted.
+func (b *budgetTracker) recordResult(callCtx engine.Context, content string) {
+	if b == nil || content == "" || callCtx.ToolCategory == engine.CredentialToolCategory {
+		return
+	}
+
+	toolName := callCtx.Tool.Name
+	if toolName == "" {
+		toolName = callCtx.Tool.ID
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.partial = append(b.partial, PartialResult{
+		ToolName: toolName,
+		Content:  content,
+	})
+}
+
+// exceed must be called with the lock held.
+func (b *budgetTracker) exceed(reason string) {
+	if b.exceeded != nil {
+		return
+	}
+	b.exceeded = &ErrBudgetExceeded{
+		Reason: reason,
+	}
+	b.cancel(b.exceeded)
+}
+
+// Err returns an ErrBudgetExceeded if any limit of the run has been reached, otherwise nil.
+func (b *budgetTracker) Err() error {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.exceeded == nil {
+		return nil
+	}
+
+	result := *b.exceeded
+	result.Usage = RunUsage{
+		Usage:    b.usage,
+		Cost:     b.cost,
+		Duration: time.Since(b.start),
+	}
+	result.Partial = append([]PartialResult(nil), b.partial...)
+	return &result
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type usageModel struct {
+	usage types.Usage
+	calls int
+}
+
+func (u *usageModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	u.calls++
+	result := &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text("partial answer"),
+		Usage:   u.usage,
+	}
+	if len(messageRequest.Tools) > 0 && u.calls == 1 {
+		result.Content = []types.ContentPart{{
+			ToolCall: &types.CompletionToolCall{
+				Index:    new(int),
+				ID:       "call_1",
+				Function: types.CompletionFunctionCall{Name: messageRequest.Tools[0].Function.Name},
+			},
+		}}
+	}
+	status <- types.CompletionStatus{
+		Response: result,
+		Usage:    u.usage,
+	}
+	return result, nil
+}
+
+func (u *usageModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func budgetProgram() types.Program {
+	return types.Program{
+		EntryToolID: "main",
+		ToolSet: types.ToolSet{
+			"main": {
+				ID: "main",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name:      "main",
+						ModelName: "test-model",
+						Tools:     []string{"sub"},
+					},
+					Instructions: "call sub",
+				},
+				ToolMapping: map[string][]types.ToolReference{
+					"sub": {{Reference: "sub", ToolID: "sub"}},
+				},
+			},
+			"sub": {
+				ID: "sub",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name:      "sub",
+						ModelName: "test-model",
+					},
+					Instructions: "answer",
+				},
+			},
+		},
+	}
+}
+
+func TestBudgetTokensExceeded(t *testing.T) {
+	model := &usageModel{
+		usage: types.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+	}
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Sequential: true,
+		Budget: Budget{
+			MaxTotalTokens: 150,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = r.Run(context.Background(), budgetProgram(), nil, "", RunOptions{})
+	require.Error(t, err)
+
+	budgetErr := (*ErrBudgetExceeded)(nil)
+	require.ErrorAs(t, err, &budgetErr)
+	require.Equal(t, "maximum total tokens of 150 reached", budgetErr.Reason)
+	require.Equal(t, 220, budgetErr.Usage.TotalTokens)
+	require.Equal(t, []PartialResult{{ToolName: "sub", Content: "partial answer"}}, budgetErr.Partial)
+	// The main tool must not be called again once the budget is exceeded.
+	require.Equal(t, 2, model.calls)
+}
+
+func TestBudgetCost(t *testing.T) {
+	model := &usageModel{
+		usage: types.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000},
+	}
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Budget: Budget{
+			MaxCost: 5,
+			ModelPrices: map[string]ModelPrice{
+				"test-model": {Prompt: 2, Completion: 4},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = r.Run(context.Background(), budgetProgram(), nil, "", RunOptions{})
+	budgetErr := (*ErrBudgetExceeded)(nil)
+	require.ErrorAs(t, err, &budgetErr)
+	require.Equal(t, 8.0, budgetErr.Usage.Cost)
+	require.Equal(t, 3_000_000, budgetErr.Usage.TotalTokens)
+}
+
+func TestBudgetCacheCost(t *testing.T) {
+	model := &usageModel{
+		usage: types.Usage{PromptTokens: 1_000_000, CompletionTokens: 100_000, CacheReadTokens: 600_000, CacheWriteTokens: 200_000},
+	}
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Budget: Budget{
+			MaxCost: 2,
+			ModelPrices: map[string]ModelPrice{
+				"test-model": {Prompt: 2, Completion: 10, CacheRead: 0.5},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = r.Run(context.Background(), budgetProgram(), nil, "", RunOptions{})
+	budgetErr := (*ErrBudgetExceeded)(nil)
+	require.ErrorAs(t, err, &budgetErr)
+	// Each call costs 0.2*2 + 0.6*0.5 + 0.2*2 + 0.1*10 = 2.1, the cache writes cost the prompt price.
+	require.InDelta(t, 2.1, budgetErr.Usage.Cost, 1e-9)
+	require.Equal(t, 600_000, budgetErr.Usage.CacheReadTokens)
+	require.Equal(t, 200_000, budgetErr.Usage.CacheWriteTokens)
+}
+
+func TestBudgetNotExceeded(t *testing.T) {
+	model := &usageModel{
+		usage: types.Usage{PromptTokens: 10, CompletionTokens: 10},
+	}
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Budget: Budget{
+			MaxTotalTokens: 1000,
+			MaxDuration:    time.Minute,
+		},
+	})
+	require.NoError(t, err)
+
+	out, err := r.Run(context.Background(), budgetProgram(), nil, "", RunOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "partial answer", out)
+}
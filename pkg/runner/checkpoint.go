@@ -0,0 +1,233 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+)
+
+const checkpointStateFile = "state.json"
+
+// Checkpoint is the persisted state of a run. Every call is a node in the tree, keyed by the ID of the tool call that
+// started it. A node either has the state of its latest continuation, or its result once it has finished.
+type Checkpoint struct {
+	Input string          `json:"input"`
+	Root  *CheckpointNode `json:"root,omitempty"`
+}
+
+type CheckpointNode struct {
+	ToolID string                     `json:"toolID,omitempty"`
+	State  *State                     `json:"state,omitempty"`
+	Result *string                    `json:"result,omitempty"`
+	Calls  map[string]*CheckpointNode `json:"calls,omitempty"`
+}
+
+// ReadCheckpoint reads the checkpoint saved in dir.
+func ReadCheckpoint(dir string) (*Checkpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, checkpointStateFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %w", dir, err)
+	}
+
+	var result Checkpoint
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", dir, err)
+	}
+	return &result, nil
+}
+
+type checkpointContextKey struct{}
+
+type checkpointer struct {
+	dir        string
+	lock       sync.Mutex
+	checkpoint Checkpoint
+}
+
+func newCheckpointer(ctx context.Context, opts RunOptions, input string) (context.Context, *checkpointer, error) {
+	if opts.CheckpointDir == "" {
+		if opts.Resume {
+			return nil, nil, errors.New("a checkpoint directory is required to resume a run")
+		}
+		return ctx, nil, nil
+	}
+
+	c := &checkpointer{
+		dir: opts.CheckpointDir,
+		checkpoint: Checkpoint{
+			Input: input,
+		},
+	}
+
+	if opts.Resume {
+		checkpoint, err := ReadCheckpoint(opts.CheckpointDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.checkpoint = *checkpoint
+	} else if err := os.MkdirAll(opts.CheckpointDir, 0700); err != nil {
+		return nil, nil, err
+	}
+
+	if c.checkpoint.Root == nil {
+		c.checkpoint.Root = &CheckpointNode{}
+	}
+
+	return context.WithValue(ctx, checkpointContextKey{}, c), c, nil
+}
+
+func checkpointerFromContext(ctx context.Context) *checkpointer {
+	c, _ := ctx.Value(checkpointContextKey{}).(*checkpointer)
+	return c
+}
+
+// checkpointPath returns the IDs of the calls leading to this call. The root call is not included because its ID is
+// different every time the run is started. Only calls made by the LLM, and the root call, are checkpointed.
+func checkpointPath(callCtx engine.Context) ([]string, bool) {
+	var path []string
+	for c := &callCtx; c.Parent != nil; c = c.Parent {
+		if c.ToolCategory != engine.NoCategory {
+			return nil, false
+		}
+		path = append([]string{c.ID}, path...)
+	}
+	return path, true
+}
+
+// node must be called with the lock held.
+func (c *checkpointer) node(path []string) *CheckpointNode {
+	node := c.checkpoint.Root
+	for _, id := range path {
+		if node.Calls == nil {
+			node.Calls = map[string]*CheckpointNode{}
+		}
+		child, ok := node.Calls[id]
+		if !ok {
+			child = &CheckpointNode{}
+			node.Calls[id] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// lookup returns the saved node for the tool call with the given ID made by the call of callCtx.
+func (c *checkpointer) lookup(callCtx engine.Context, callID string) *CheckpointNode {
+	if c == nil {
+		return nil
+	}
+
+	path, ok := checkpointPath(callCtx)
+	if !ok {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	parent := c.checkpoint.Root
+	for _, id := range path {
+		if parent = parent.Calls[id]; parent == nil {
+			return nil
+		}
+	}
+	return parent.Calls[callID]
+}
+
+// update saves the latest state of the call. The calls of the previous state have all finished at this point, so they
+// are dropped.
+func (c *checkpointer) update(callCtx engine.Context, state *State) error {
+	if c == nil {
+		return nil
+	}
+
+	path, ok := checkpointPath(callCtx)
+	if !ok {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	node := c.node(path)
+	node.ToolID = callCtx.Tool.ID
+	node.State = state
+	node.Calls = nil
+	return c.save()
+}
+
+// finish saves the result of the tool call with the given ID made by the call of callCtx.
+func (c *checkpointer) finish(callCtx engine.Context, callID, toolID, result string) error {
+	if c == nil {
+		return nil
+	}
+
+	path, ok := checkpointPath(callCtx)
+	if !ok {
+		return nil
+	}
+
+	return c.finishPath(append(path, callID), toolID, result)
+}
+
+// finishRoot saves the result of the run.
+func (c *checkpointer) finishRoot(toolID, result string) error {
+	if c == nil {
+		return nil
+	}
+	return c.finishPath(nil, toolID, result)
+}
+
+func (c *checkpointer) finishPath(path []string, toolID, result string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	node := c.node(path)
+	node.ToolID = toolID
+	node.State = nil
+	node.Calls = nil
+	node.Result = &result
+	return c.save()
+}
+
+// save must be called with the lock held.
+func (c *checkpointer) save() error {
+	data, err := json.Marshal(c.checkpoint)
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(c.dir, checkpointStateFile)
+	if err := system.WriteFileAtomic(file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// resumeState returns the state and input the run should continue from.
+func (c *checkpointer) resumeState() (*State, string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	root := c.checkpoint.Root
+	if root.Result != nil {
+		return &State{
+			Result: root.Result,
+		}, c.checkpoint.Input, nil
+	}
+	if root.State == nil {
+		// The run never got past starting, so it is started again.
+		return nil, c.checkpoint.Input, nil
+	}
+	if root.State.Continuation == nil {
+		return nil, "", errors.New("invalid checkpoint, the root call has no continuation")
+	}
+	return root.State, c.checkpoint.Input, nil
+}
@@ -0,0 +1,154 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// crashModel has the main tool call both sub tools, and fails the call to the second sub tool while crash is set.
+type crashModel struct {
+	lock  sync.Mutex
+	crash bool
+	calls map[string]int
+}
+
+func (c *crashModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	instructions := messageRequest.Messages[0].ChatText()
+
+	c.lock.Lock()
+	c.calls[instructions]++
+	crash := c.crash
+	c.lock.Unlock()
+
+	result := &types.CompletionMessage{
+		Role: types.CompletionMessageRoleTypeAssistant,
+	}
+
+	switch instructions {
+	case "call both":
+		last := messageRequest.Messages[len(messageRequest.Messages)-1]
+		if last.Role != types.CompletionMessageRoleTypeTool {
+			for i, tool := range messageRequest.Tools {
+				result.Content = append(result.Content, types.ContentPart{
+					ToolCall: &types.CompletionToolCall{
+						Index:    &i,
+						ID:       "call_" + tool.Function.Name,
+						Function: types.CompletionFunctionCall{Name: tool.Function.Name},
+					},
+				})
+			}
+			break
+		}
+		var results []string
+		for _, msg := range messageRequest.Messages {
+			if msg.Role == types.CompletionMessageRoleTypeTool {
+				results = append(results, msg.ChatText())
+			}
+		}
+		result.Content = types.Text("done: " + strings.Join(results, ", "))
+	case "second":
+		if crash {
+			return nil, errors.New("crashed")
+		}
+		result.Content = types.Text(instructions + " result")
+	default:
+		result.Content = types.Text(instructions + " result")
+	}
+
+	status <- types.CompletionStatus{
+		Response: result,
+	}
+	return result, nil
+}
+
+func (c *crashModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+func checkpointProgram() types.Program {
+	prg := types.Program{
+		EntryToolID: "main",
+		ToolSet: types.ToolSet{
+			"main": {
+				ID: "main",
+				ToolDef: types.ToolDef{
+					Parameters: types.Parameters{
+						Name:  "main",
+						Tools: []string{"first", "second"},
+					},
+					Instructions: "call both",
+				},
+				ToolMapping: map[string][]types.ToolReference{
+					"first":  {{Reference: "first", ToolID: "first"}},
+					"second": {{Reference: "second", ToolID: "second"}},
+				},
+			},
+		},
+	}
+	for _, name := range []string{"first", "second"} {
+		prg.ToolSet[name] = types.Tool{
+			ID: name,
+			ToolDef: types.ToolDef{
+				Parameters: types.Parameters{
+					Name: name,
+				},
+				Instructions: name,
+			},
+		}
+	}
+	return prg
+}
+
+func TestCheckpointResume(t *testing.T) {
+	dir := t.TempDir()
+	model := &crashModel{
+		crash: true,
+		calls: map[string]int{},
+	}
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Sequential: true,
+	})
+	require.NoError(t, err)
+
+	_, err = r.Run(context.Background(), checkpointProgram(), nil, "input", RunOptions{
+		CheckpointDir: dir,
+	})
+	require.ErrorContains(t, err, "crashed")
+
+	checkpoint, err := ReadCheckpoint(dir)
+	require.NoError(t, err)
+	require.Equal(t, "input", checkpoint.Input)
+	require.Equal(t, "first result", *checkpoint.Root.Calls["call_first"].Result)
+	// The second call failed before it saved any state, so it will be started again.
+	require.NotContains(t, checkpoint.Root.Calls, "call_second")
+
+	model.crash = false
+	out, err := r.Run(context.Background(), checkpointProgram(), nil, "", RunOptions{
+		CheckpointDir: dir,
+		Resume:        true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "done: first result, second result", out)
+	// The first sub call finished before the crash, so only the second one is called again.
+	require.Equal(t, map[string]int{
+		"call both": 2,
+		"first":     1,
+		"second":    2,
+	}, model.calls)
+
+	// Resuming a finished run returns its result.
+	out, err = r.Run(context.Background(), checkpointProgram(), nil, "", RunOptions{
+		CheckpointDir: dir,
+		Resume:        true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "done: first result, second result", out)
+	require.Equal(t, 2, model.calls["call both"])
+}
@@ -0,0 +1,252 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	HookEventBeforeCall = "beforeCall"
+	HookEventAfterCall  = "afterCall"
+)
+
+// CallHook is invoked around every tool call requested by an LLM. Hooks are called in the order they are registered
+// before the call, and in the reverse order after the call.
+type CallHook interface {
+	// BeforeCall may change the input of the call by setting Input, or skip the call entirely by setting Result.
+	BeforeCall(ctx engine.Context, input string) (BeforeCallResponse, error)
+	// AfterCall receives the output or error of the call and returns the output and error to use instead.
+	AfterCall(ctx engine.Context, input, output string, err error) (string, error)
+}
+
+type BeforeCallResponse struct {
+	Input  *string
+	Result *string
+}
+
+// HookInput is the JSON input passed to hook tools declared with the "Hooks" directive.
+type HookInput struct {
+	Event    string `json:"event"`
+	ToolName string `json:"toolName,omitempty"`
+	ToolID   string `json:"toolID,omitempty"`
+	CallID   string `json:"callID,omitempty"`
+	Input    string `json:"input"`
+	Output   string `json:"output,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Args holds the arguments passed to the hook tool with "Hooks: tool with ...". They are kept under their own key
+	// so that an argument can not replace any of the fields above.
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// HookOutput is the JSON a hook tool may respond with. An empty response from a hook tool leaves the call unchanged.
+type HookOutput struct {
+	Input  *string `json:"input,omitempty"`
+	Result *string `json:"result,omitempty"`
+	Output *string `json:"output,omitempty"`
+	Error  *string `json:"error,omitempty"`
+}
+
+// toolHook runs a hook tool declared in a .gpt file as a CallHook.
+type toolHook struct {
+	r       *Runner
+	monitor Monitor
+	env     []string
+	parent  engine.Context
+	ref     types.ToolReference
+}
+
+func (t toolHook) BeforeCall(ctx engine.Context, input string) (BeforeCallResponse, error) {
+	out, err := t.run(ctx, HookInput{
+		Event: HookEventBeforeCall,
+		Input: input,
+	})
+	if err != nil {
+		return BeforeCallResponse{}, err
+	}
+	return BeforeCallResponse{
+		Input:  out.Input,
+		Result: out.Result,
+	}, nil
+}
+
+func (t toolHook) AfterCall(ctx engine.Context, input, output string, callErr error) (string, error) {
+	hookInput := HookInput{
+		Event:  HookEventAfterCall,
+		Input:  input,
+		Output: output,
+	}
+	if callErr != nil {
+		hookInput.Error = callErr.Error()
+	}
+
+	out, err := t.run(ctx, hookInput)
+	if err != nil {
+		return "", err
+	}
+
+	if out.Output != nil {
+		output = *out.Output
+	}
+	if out.Error != nil {
+		if *out.Error == "" {
+			callErr = nil
+		} else {
+			callErr = errors.New(*out.Error)
+		}
+	}
+	return output, callErr
+}
+
+func (t toolHook) run(ctx engine.Context, input HookInput) (result HookOutput, _ error) {
+	input.ToolName = ctx.Tool.Name
+	input.ToolID = ctx.Tool.ID
+	input.CallID = ctx.ID
+
+	args, err := types.GetToolRefInput(t.parent.Program, t.ref, input.Input)
+	if err != nil {
+		return result, err
+	}
+	if strings.HasPrefix(args, "{") {
+		if err := json.Unmarshal([]byte(args), &input.Args); err != nil {
+			return result, fmt.Errorf("failed to unmarshal args for hook: %w", err)
+		}
+	} else if args != "" {
+		input.Args = map[string]any{
+			"input": args,
+		}
+	}
+
+	inputData, err := json.Marshal(input)
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal input for hook: %w", err)
+	}
+
+	res, err := t.r.subCall(t.parent.Ctx, t.parent, t.monitor, t.env, t.ref.ToolID, string(inputData), "", engine.HookToolCategory)
+	if err != nil {
+		return result, err
+	}
+	if res.Result == nil {
+		return result, fmt.Errorf("invalid state: hook tool [%s] can not result in a chat continuation", t.ref.Reference)
+	}
+
+	if strings.TrimSpace(*res.Result) == "" {
+		return result, nil
+	}
+	if err := json.Unmarshal([]byte(*res.Result), &result); err != nil {
+		return result, fmt.Errorf("invalid response from hook tool [%s], expected JSON: %w", t.ref.Reference, err)
+	}
+	return result, nil
+}
+
+// getHooks returns the hooks that apply to the tool calls made by the tool of callCtx.
+func (r *Runner) getHooks(callCtx engine.Context, monitor Monitor, env []string) ([]CallHook, error) {
+	if callCtx.ToolCategory == engine.HookToolCategory || callCtx.ToolCategory == engine.CredentialToolCategory {
+		return nil, nil
+	}
+
+	hookToolRefs, err := callCtx.Tool.GetToolsByType(callCtx.Program, types.ToolTypeHook)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := slices.Clone(r.hooks)
+	for _, hookToolRef := range hookToolRefs {
+		if callCtx.Program.ToolSet[hookToolRef.ToolID].IsNoop() {
+			continue
+		}
+		hooks = append(hooks, toolHook{
+			r:       r,
+			monitor: monitor,
+			env:     env,
+			parent:  callCtx,
+			ref:     hookToolRef,
+		})
+	}
+
+	return hooks, nil
+}
+
+// callWithHooks runs the call with the before and after hooks applied.
+func callWithHooks(callCtx engine.Context, hooks []CallHook, call func(callCtx engine.Context) (*State, error)) (*State, error) {
+	if len(hooks) == 0 {
+		return call(callCtx)
+	}
+
+	input := callCtx.Input
+	for _, hook := range hooks {
+		resp, err := hook.BeforeCall(callCtx, input)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Result != nil {
+			return &State{
+				Result: resp.Result,
+			}, nil
+		}
+		if resp.Input != nil {
+			input = *resp.Input
+		}
+	}
+
+	callCtx.Input = input
+	state, err := call(callCtx)
+	return afterCall(callCtx, hooks, input, state, err)
+}
+
+// afterCall applies the after hooks once the call has produced a result or an error.
+func afterCall(callCtx engine.Context, hooks []CallHook, input string, state *State, err error) (*State, error) {
+	if len(hooks) == 0 || (err == nil && (state == nil || state.Result == nil)) {
+		// Either there is nothing to do or the call is waiting on chat input, in which case the after hooks are
+		// called when it finishes.
+		return state, err
+	}
+
+	var output string
+	if err == nil {
+		output = *state.Result
+	}
+
+	for _, hook := range slices.Backward(hooks) {
+		output, err = hook.AfterCall(callCtx, input, output, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Result: &output,
+	}, nil
+}
+
+// startEngine starts the call with the command hooks applied if the tool runs a command. Unlike the hooks from getHooks,
+// command hooks apply to every call of a command, including the root tool and context, input, output, credential and
+// hook tools. Calls that do not end with a plain result can not be hooked.
+func (r *Runner) startEngine(callCtx engine.Context, e *engine.Engine, input string) (*engine.Return, error) {
+	tool := callCtx.Tool
+	if len(r.commandHooks) == 0 || !tool.IsCommand() && !tool.IsMCPInvoke() || tool.IsCall() || tool.ID == "sys.chat.finish" {
+		return e.Start(callCtx, input)
+	}
+
+	callCtx.Input = input
+	state, err := callWithHooks(callCtx, r.commandHooks, func(callCtx engine.Context) (*State, error) {
+		ret, err := e.Start(callCtx, callCtx.Input)
+		if err != nil {
+			return nil, err
+		}
+		return &State{
+			Result: ret.Result,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &engine.Return{
+		Result: state.Result,
+	}, nil
+}
@@ -0,0 +1,119 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// echoModel calls the first available tool once, and otherwise echoes the last message it was sent.
+type echoModel struct {
+	calls int
+}
+
+func (e *echoModel) Call(_ context.Context, messageRequest types.CompletionRequest, _ []string, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	e.calls++
+	last := messageRequest.Messages[len(messageRequest.Messages)-1]
+	result := &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text(string(last.Role) + ": " + last.ChatText()),
+	}
+	if len(messageRequest.Tools) > 0 && last.Role != types.CompletionMessageRoleTypeTool {
+		result.Content = []types.ContentPart{{
+			ToolCall: &types.CompletionToolCall{
+				Index:    new(int),
+				ID:       "call_1",
+				Function: types.CompletionFunctionCall{Name: messageRequest.Tools[0].Function.Name, Arguments: "original"},
+			},
+		}}
+	}
+	status <- types.CompletionStatus{
+		Response: result,
+	}
+	return result, nil
+}
+
+func (e *echoModel) ProxyInfo([]string) (string, string, error) {
+	return "", "", nil
+}
+
+type testHook struct {
+	input  *string
+	result *string
+	before []string
+	after  func(output string, err error) (string, error)
+}
+
+func (h *testHook) BeforeCall(ctx engine.Context, input string) (BeforeCallResponse, error) {
+	h.before = append(h.before, ctx.Tool.Name+": "+input)
+	return BeforeCallResponse{
+		Input:  h.input,
+		Result: h.result,
+	}, nil
+}
+
+func (h *testHook) AfterCall(_ engine.Context, _, output string, err error) (string, error) {
+	if h.after == nil {
+		return output, err
+	}
+	return h.after(output, err)
+}
+
+func runHooks(t *testing.T, model *echoModel, hooks ...CallHook) (string, error) {
+	t.Helper()
+	r, err := New(model, credentials.NoopStore{}, Options{
+		Hooks: hooks,
+	})
+	require.NoError(t, err)
+	return r.Run(context.Background(), budgetProgram(), nil, "", RunOptions{})
+}
+
+func TestHooksModifyInputAndOutput(t *testing.T) {
+	first := &testHook{
+		input: &[]string{"rewritten"}[0],
+		after: func(output string, err error) (string, error) {
+			return "[" + output + "]", err
+		},
+	}
+	second := &testHook{
+		after: func(output string, err error) (string, error) {
+			return "(" + output + ")", err
+		},
+	}
+
+	out, err := runHooks(t, &echoModel{}, first, second)
+	require.NoError(t, err)
+	// The after hooks are applied in reverse order.
+	require.Equal(t, "tool: [(user: rewritten)]", out)
+	require.Equal(t, []string{"sub: original"}, first.before)
+	require.Equal(t, []string{"sub: rewritten"}, second.before)
+}
+
+func TestHooksShortCircuit(t *testing.T) {
+	model := &echoModel{}
+	hook := &testHook{
+		result: &[]string{"denied by policy"}[0],
+	}
+
+	out, err := runHooks(t, model, hook)
+	require.NoError(t, err)
+	require.Equal(t, "tool: denied by policy", out)
+	// The sub tool is never called.
+	require.Equal(t, 2, model.calls)
+}
+
+func TestHooksError(t *testing.T) {
+	hook := &testHook{
+		after: func(string, error) (string, error) {
+			return "", errors.New("output rejected")
+		},
+	}
+
+	_, err := runHooks(t, &echoModel{}, hook)
+	require.ErrorContains(t, err, "output rejected")
+}
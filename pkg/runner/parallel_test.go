@@ -0,0 +1,63 @@
+package runner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDispatcher(t *testing.T) {
+	r := &Runner{}
+	assert.IsType(t, &parallelDispatcher{}, r.newDispatcher(context.Background(), types.Tool{}))
+
+	var tool types.Tool
+	tool.ParallelToolCalls = new(bool)
+	assert.IsType(t, &serialDispatcher{}, r.newDispatcher(context.Background(), tool))
+
+	r.sequential = true
+	assert.IsType(t, &serialDispatcher{}, r.newDispatcher(context.Background(), types.Tool{}))
+}
+
+func TestToolChoiceNone(t *testing.T) {
+	model := &usageModel{}
+	r, err := New(model, credentials.NoopStore{}, Options{})
+	require.NoError(t, err)
+
+	prg := budgetProgram()
+	main := prg.ToolSet["main"]
+	main.ToolChoice = types.ToolChoiceNone
+	prg.ToolSet["main"] = main
+
+	// The model calls sub anyway, which is refused instead of run.
+	out, err := r.Run(context.Background(), prg, nil, "", RunOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "partial answer", out)
+	assert.Equal(t, 2, model.calls)
+}
+
+func TestToolChoiceOtherTool(t *testing.T) {
+	model := &usageModel{}
+	r, err := New(model, credentials.NoopStore{}, Options{})
+	require.NoError(t, err)
+
+	prg := budgetProgram()
+	other := prg.ToolSet["sub"]
+	other.ID = "other"
+	other.Name = "other"
+	prg.ToolSet["other"] = other
+	main := prg.ToolSet["main"]
+	main.Tools = append(main.Tools, "other")
+	main.ToolMapping["other"] = []types.ToolReference{{Reference: "other", ToolID: "other"}}
+	main.ToolChoice = "other"
+	prg.ToolSet["main"] = main
+
+	// The model calls sub although the tool choice is other, which is refused instead of run.
+	out, err := r.Run(context.Background(), prg, nil, "", RunOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "partial answer", out)
+	assert.Equal(t, 2, model.calls)
+}
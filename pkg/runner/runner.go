@@ -15,6 +15,7 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/process"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"golang.org/x/exp/maps"
 )
@@ -39,10 +40,17 @@ type Options struct {
 	Sequential          bool                  `usage:"-"`
 	Authorizer          AuthorizerFunc        `usage:"-"`
 	MCPRunner           engine.MCPRunner      `usage:"-"`
+	Budget              Budget                `usage:"-"`
+	Hooks               []CallHook            `usage:"-"`
+	CommandHooks        []CallHook            `usage:"-"`
 }
 
 type RunOptions struct {
 	UserCancel <-chan struct{}
+	// CheckpointDir, if set, is where the state of the run is saved after every call that finishes.
+	CheckpointDir string
+	// Resume continues the run saved in CheckpointDir instead of starting a new one.
+	Resume bool
 }
 
 type AuthorizerResponse struct {
@@ -74,6 +82,9 @@ func Complete(opts ...Options) (result Options) {
 		if opt.MCPRunner != nil {
 			result.MCPRunner = opt.MCPRunner
 		}
+		result.Budget = completeBudget(result.Budget, opt.Budget)
+		result.Hooks = append(result.Hooks, opt.Hooks...)
+		result.CommandHooks = append(result.CommandHooks, opt.CommandHooks...)
 	}
 	return
 }
@@ -108,6 +119,9 @@ type Runner struct {
 	credStore      credentials.CredentialStore
 	sequential     bool
 	mcpRunner      engine.MCPRunner
+	budget         Budget
+	hooks          []CallHook
+	commandHooks   []CallHook
 }
 
 func New(client engine.Model, credStore credentials.CredentialStore, opts ...Options) (*Runner, error) {
@@ -123,6 +137,9 @@ func New(client engine.Model, credStore credentials.CredentialStore, opts ...Opt
 		sequential:     opt.Sequential,
 		auth:           opt.Authorizer,
 		mcpRunner:      opt.MCPRunner,
+		budget:         opt.Budget,
+		hooks:          opt.Hooks,
+		commandHooks:   opt.CommandHooks,
 	}
 
 	if opt.StartPort != 0 {
@@ -181,7 +198,44 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		monitor.Stop(ctx, resp.Content, err)
 	}()
 
-	callCtx, err := engine.NewContext(ctx, &prg, input, opts.UserCancel)
+	runCtx, budget := newBudgetTracker(ctx, r.budget)
+	defer budget.close()
+	defer func() {
+		// If the budget was exceeded, whatever error or result was produced is a consequence of the run being aborted.
+		if budgetErr := budget.Err(); budgetErr != nil {
+			resp = ChatResponse{}
+			err = budgetErr
+		}
+	}()
+
+	runCtx, checkpoint, err := newCheckpointer(runCtx, opts, input)
+	if err != nil {
+		return resp, err
+	}
+
+	// Processes started in the background by sys.exec.start don't outlive the run.
+	runCtx, processes := process.WithManager(runCtx)
+	defer processes.Close()
+
+	var resumeCheckpoint bool
+	if opts.Resume {
+		if state != nil {
+			return resp, errors.New("a chat state can not be used when resuming from a checkpoint")
+		}
+		state, input, err = checkpoint.resumeState()
+		if err != nil {
+			return resp, err
+		}
+		if state != nil && state.Result != nil {
+			return ChatResponse{
+				Done:    true,
+				Content: *state.Result,
+			}, nil
+		}
+		resumeCheckpoint = state != nil
+	}
+
+	callCtx, err := engine.NewContext(runCtx, &prg, input, opts.UserCancel)
 	if err != nil {
 		return resp, err
 	}
@@ -191,7 +245,7 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		if err != nil {
 			return resp, err
 		}
-	} else {
+	} else if !resumeCheckpoint {
 		state = state.WithResumeInput(&input)
 	}
 
@@ -201,6 +255,9 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 	}
 
 	if state.Result != nil {
+		if err := checkpoint.finishRoot(callCtx.Tool.ID, *state.Result); err != nil {
+			return resp, err
+		}
 		return ChatResponse{
 			Done:    true,
 			Content: *state.Result,
@@ -233,30 +290,33 @@ func (r *Runner) Run(ctx context.Context, prg types.Program, env []string, input
 }
 
 type Event struct {
-	Time               time.Time              `json:"time,omitempty"`
-	CallContext        *engine.CallContext    `json:"callContext,omitempty"`
-	ToolSubCalls       map[string]engine.Call `json:"toolSubCalls,omitempty"`
-	ToolResults        int                    `json:"toolResults,omitempty"`
-	Type               EventType              `json:"type,omitempty"`
-	ChatCompletionID   string                 `json:"chatCompletionId,omitempty"`
-	ChatRequest        any                    `json:"chatRequest,omitempty"`
-	ChatResponse       any                    `json:"chatResponse,omitempty"`
-	Usage              types.Usage            `json:"usage,omitempty"`
-	ChatResponseCached bool                   `json:"chatResponseCached,omitempty"`
-	Content            string                 `json:"content,omitempty"`
+	Time               time.Time               `json:"time,omitempty"`
+	CallContext        *engine.CallContext     `json:"callContext,omitempty"`
+	ToolSubCalls       map[string]engine.Call  `json:"toolSubCalls,omitempty"`
+	ToolResults        int                     `json:"toolResults,omitempty"`
+	Type               EventType               `json:"type,omitempty"`
+	ChatCompletionID   string                  `json:"chatCompletionId,omitempty"`
+	ChatModel          string                  `json:"chatModel,omitempty"`
+	ChatRequest        any                     `json:"chatRequest,omitempty"`
+	ChatResponse       any                     `json:"chatResponse,omitempty"`
+	Usage              types.Usage             `json:"usage,omitempty"`
+	ChatResponseCached bool                    `json:"chatResponseCached,omitempty"`
+	Content            string                  `json:"content,omitempty"`
+	Compaction         *types.CompactionStatus `json:"compaction,omitempty"`
 }
 
 type EventType string
 
 var (
-	EventTypeRunStart     EventType = "runStart"
-	EventTypeCallStart    EventType = "callStart"
-	EventTypeCallContinue EventType = "callContinue"
-	EventTypeCallSubCalls EventType = "callSubCalls"
-	EventTypeCallProgress EventType = "callProgress"
-	EventTypeChat         EventType = "callChat"
-	EventTypeCallFinish   EventType = "callFinish"
-	EventTypeRunFinish    EventType = "runFinish"
+	EventTypeRunStart       EventType = "runStart"
+	EventTypeCallStart      EventType = "callStart"
+	EventTypeCallContinue   EventType = "callContinue"
+	EventTypeCallSubCalls   EventType = "callSubCalls"
+	EventTypeCallProgress   EventType = "callProgress"
+	EventTypeChat           EventType = "callChat"
+	EventTypeCallCompaction EventType = "callCompaction"
+	EventTypeCallFinish     EventType = "callFinish"
+	EventTypeRunFinish      EventType = "runFinish"
 )
 
 func (r *Runner) getContext(callCtx engine.Context, state *State, monitor Monitor, env []string, input string) (result []engine.InputContext, _ error) {
@@ -365,15 +425,23 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 		}
 	}
 
-	ret, err := e.Start(callCtx, input)
+	if err := budgetFromContext(callCtx.Ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	ret, err := r.startEngine(callCtx, &e, input)
 	if err != nil {
 		return nil, err
 	}
 
-	return &State{
+	state = &State{
 		StartInput:   &input,
 		Continuation: ret,
-	}, nil
+	}
+	if err := checkpointerFromContext(callCtx.Ctx).update(callCtx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
 }
 
 type State struct {
@@ -473,6 +541,7 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 				} else if retState.Result != nil {
 					content = *retState.Result
 				}
+				budgetFromContext(callCtx.Ctx).recordResult(callCtx, content)
 				monitor.Event(Event{
 					Time:        time.Now(),
 					CallContext: callCtx.GetCallContext(),
@@ -566,6 +635,10 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			})
 		}
 
+		if err := budgetFromContext(callCtx.Ctx).Err(); err != nil {
+			return nil, err
+		}
+
 		nextContinuation, err := e.Continue(callCtx, state.Continuation.State, engineResults...)
 		if err != nil {
 			return nil, err
@@ -575,18 +648,32 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			Continuation: nextContinuation,
 			SubCalls:     callResults,
 		}
+		if err := checkpointerFromContext(callCtx.Ctx).update(callCtx, state); err != nil {
+			return nil, err
+		}
 	}
 }
 
 func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.CompletionStatus, func()) {
 	progress := make(chan types.CompletionStatus)
+	budget := budgetFromContext(callCtx.Ctx)
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for status := range progress {
-			if message := status.PartialResponse; message != nil {
+			if compaction := status.Compaction; compaction != nil {
+				budget.add(types.FirstSet(callCtx.Tool.CompactionModel, callCtx.Tool.ModelName), status.Usage)
+				monitor.Event(Event{
+					Time:             time.Now(),
+					CallContext:      callCtx.GetCallContext(),
+					Type:             EventTypeCallCompaction,
+					ChatCompletionID: status.CompletionID,
+					Usage:            status.Usage,
+					Compaction:       compaction,
+				})
+			} else if message := status.PartialResponse; message != nil {
 				monitor.Event(Event{
 					Time:             time.Now(),
 					CallContext:      callCtx.GetCallContext(),
@@ -595,11 +682,15 @@ func streamProgress(callCtx *engine.Context, monitor Monitor) (chan<- types.Comp
 					Content:          getEventContent(message.String(), *callCtx),
 				})
 			} else {
+				if status.Response != nil {
+					budget.add(types.FirstSet(status.Model, callCtx.Tool.ModelName), status.Usage)
+				}
 				monitor.Event(Event{
 					Time:               time.Now(),
 					CallContext:        callCtx.GetCallContext(),
 					Type:               EventTypeChat,
 					ChatCompletionID:   status.CompletionID,
+					ChatModel:          status.Model,
 					ChatRequest:        status.Request,
 					ChatResponse:       status.Response,
 					Usage:              status.Usage,
@@ -630,13 +721,24 @@ func (r *Runner) subCall(ctx context.Context, parentContext engine.Context, moni
 		}, nil
 	}
 
-	state, err := r.call(callCtx, monitor, env, input)
-	if finishErr := (*engine.ErrChatFinish)(nil); errors.As(err, &finishErr) && callCtx.Tool.Chat {
-		return &State{
-			Result: &finishErr.Message,
-		}, nil
+	var hooks []CallHook
+	if callID != "" {
+		// Only the tool calls requested by the LLM are hooked.
+		hooks, err = r.getHooks(parentContext, monitor, env)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return state, err
+
+	return callWithHooks(callCtx, hooks, func(callCtx engine.Context) (*State, error) {
+		state, err := r.call(callCtx, monitor, env, callCtx.Input)
+		if finishErr := (*engine.ErrChatFinish)(nil); errors.As(err, &finishErr) && callCtx.Tool.Chat {
+			return &State{
+				Result: &finishErr.Message,
+			}, nil
+		}
+		return state, err
+	})
 }
 
 func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context, monitor Monitor, env []string, toolID, callID string, state *State, toolCategory engine.ToolCategory) (*State, error) {
@@ -645,13 +747,18 @@ func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context
 		return nil, err
 	}
 
+	hooks, err := r.getHooks(parentContext, monitor, env)
+	if err != nil {
+		return nil, err
+	}
+
 	state, err = r.resume(callCtx, monitor, env, state)
 	if finishErr := (*engine.ErrChatFinish)(nil); errors.As(err, &finishErr) && callCtx.Tool.Chat {
-		return &State{
+		state, err = &State{
 			Result: &finishErr.Message,
 		}, nil
 	}
-	return state, err
+	return afterCall(callCtx, hooks, callCtx.Input, state, err)
 }
 
 type SubCallResult struct {
@@ -660,8 +767,10 @@ type SubCallResult struct {
 	State  *State `json:"state,omitempty"`
 }
 
-func (r *Runner) newDispatcher(ctx context.Context) dispatcher {
-	if r.sequential {
+// newDispatcher returns the dispatcher for the tool calls of a tool, which runs them one after another if the runner
+// is sequential or the tool turned off parallel tool calls.
+func (r *Runner) newDispatcher(ctx context.Context, tool types.Tool) dispatcher {
+	if r.sequential || (tool.ParallelToolCalls != nil && !*tool.ParallelToolCalls) {
 		return newSerialDispatcher(ctx)
 	}
 	return newParallelDispatcher(ctx)
@@ -717,7 +826,8 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 		return state, callResults, nil
 	}
 
-	d := r.newDispatcher(callCtx.Ctx)
+	d := r.newDispatcher(callCtx.Ctx, callCtx.Tool)
+	checkpoint := checkpointerFromContext(callCtx.Ctx)
 
 	// Sort the id so if sequential the results are predictable
 	ids := maps.Keys(state.Continuation.Calls)
@@ -727,24 +837,60 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 
 	for _, id := range ids {
 		call := state.Continuation.Calls[id]
-		if call.Missing {
+		if call.Missing || call.NotForced || callCtx.Tool.ToolChoice == types.ToolChoiceNone {
+			// Not all providers honor the tool choice, so the calls it rules out are refused here as well.
+			result := fmt.Sprintf("ERROR: can not call tool [%s], tool calls are turned off", call.ToolID)
+			if call.Missing {
+				result = fmt.Sprintf("ERROR: can not call unknown tool named [%s]", call.ToolID)
+			} else if call.NotForced {
+				result = fmt.Sprintf("ERROR: can not call tool [%s], the tool choice is [%s]", call.ToolID, callCtx.Tool.ToolChoice)
+			}
+			resultLock.Lock()
+			callResults = append(callResults, SubCallResult{
+				ToolID: call.ToolID,
+				CallID: id,
+				State: &State{
+					Result: &result,
+				},
+			})
+			resultLock.Unlock()
+			continue
+		}
+		saved := checkpoint.lookup(callCtx, id)
+		if saved != nil && saved.Result != nil {
+			// This call already finished before the run was resumed.
 			resultLock.Lock()
 			callResults = append(callResults, SubCallResult{
 				ToolID: call.ToolID,
 				CallID: id,
 				State: &State{
-					Result: &[]string{fmt.Sprintf("ERROR: can not call unknown tool named [%s]", call.ToolID)}[0],
+					Result: saved.Result,
 				},
 			})
 			resultLock.Unlock()
 			continue
 		}
+
 		d.Run(func(ctx context.Context) error {
-			result, err := r.subCall(ctx, callCtx, monitor, env, call.ToolID, call.Input, id, toolCategory)
+			var (
+				result *State
+				err    error
+			)
+			if saved != nil && saved.State != nil && saved.State.Continuation != nil {
+				result, err = r.subCallResume(ctx, callCtx, monitor, env, call.ToolID, id, saved.State, toolCategory)
+			} else {
+				result, err = r.subCall(ctx, callCtx, monitor, env, call.ToolID, call.Input, id, toolCategory)
+			}
 			if err != nil {
 				return err
 			}
 
+			if result.Result != nil {
+				if err := checkpoint.finish(callCtx, id, call.ToolID, *result.Result); err != nil {
+					return err
+				}
+			}
+
 			resultLock.Lock()
 			defer resultLock.Unlock()
 			callResults = append(callResults, SubCallResult{
@@ -13,15 +13,21 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
+// waitingPrompt is a prompt that is waiting for its response. The fields are kept to validate the response.
+type waitingPrompt struct {
+	fields   types.Fields
+	response chan map[string]string
+}
+
 func (s *server) promptResponse(w http.ResponseWriter, r *http.Request) {
 	logger := gcontext.GetLogger(r.Context())
 	id := r.PathValue("id")
 
 	s.lock.RLock()
-	promptChan := s.waitingToPrompt[id]
+	waiting := s.waitingToPrompt[id]
 	s.lock.RUnlock()
 
-	if promptChan == nil {
+	if waiting == nil {
 		writeError(logger, w, http.StatusNotFound, fmt.Errorf("no prompt found with id %q", id))
 		return
 	}
@@ -31,10 +37,19 @@ func (s *server) promptResponse(w http.ResponseWriter, r *http.Request) {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("failed to decode request body: %w", err))
 		return
 	}
+	if promptResponse == nil {
+		promptResponse = map[string]string{}
+	}
+
+	// The prompt keeps waiting when the response is invalid, so that it can be corrected.
+	if err := waiting.fields.Validate(promptResponse); err != nil {
+		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid prompt response: %w", err))
+		return
+	}
 
 	// Don't block here because, if the prompter is no longer waiting on this then it will never unblock.
 	select {
-	case promptChan <- promptResponse:
+	case waiting.response <- promptResponse:
 		w.WriteHeader(http.StatusAccepted)
 	default:
 		w.WriteHeader(http.StatusConflict)
@@ -51,10 +66,10 @@ func (s *server) prompt(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
 	s.lock.RLock()
-	promptChan := s.waitingToPrompt[id]
+	waiting := s.waitingToPrompt[id]
 	s.lock.RUnlock()
 
-	if promptChan != nil {
+	if waiting != nil {
 		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("prompt called multiple times for same ID: %s", id))
 		return
 	}
@@ -65,9 +80,17 @@ func (s *server) prompt(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := prompt.Fields.Check(); err != nil {
+		writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid prompt: %w", err))
+		return
+	}
+
+	promptChan := make(chan map[string]string)
 	s.lock.Lock()
-	promptChan = make(chan map[string]string)
-	s.waitingToPrompt[id] = promptChan
+	s.waitingToPrompt[id] = &waitingPrompt{
+		fields:   prompt.Fields,
+		response: promptChan,
+	}
 	s.lock.Unlock()
 	defer func(id string) {
 		s.lock.Lock()
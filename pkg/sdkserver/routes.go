@@ -9,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/gptscript-ai/broadcaster"
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
@@ -30,13 +31,14 @@ type server struct {
 	serverToolsEnv             []string
 	client                     *gptscript.GPTScript
 	mcpLoader                  loader.MCPLoader
+	authPolicy                 *auth.Policy
 	events                     *broadcaster.Broadcaster[event]
 
 	runtimeManager engine.RuntimeManager
 
 	lock             sync.RWMutex
 	waitingToConfirm map[string]chan runner.AuthorizerResponse
-	waitingToPrompt  map[string]chan map[string]string
+	waitingToPrompt  map[string]*waitingPrompt
 
 	runningLock sync.Mutex
 	running     map[string]chan struct{}
@@ -216,6 +218,12 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		programLoader = loader.Program
 	}
 
+	budget, err := reqObject.toBudget()
+	if err != nil {
+		writeError(logger, w, http.StatusBadRequest, err)
+		return
+	}
+
 	opts := gptscript.Options{
 		Cache:              cache.Options(reqObject.cacheOptions),
 		OpenAI:             openai.Options(reqObject.openAIOptions),
@@ -227,11 +235,30 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 			MonitorFactory:      NewSessionFactory(s.events),
 			CredentialOverrides: reqObject.CredentialOverrides,
 			Sequential:          reqObject.ForceSequential,
+			Budget:              budget,
 		},
 		DefaultModelProvider: reqObject.DefaultModelProvider,
 	}
 
-	if reqObject.Confirm {
+	authPolicy := s.authPolicy
+	if reqObject.AuthPolicy != "" {
+		requestPolicy, err := auth.ParsePolicy([]byte(reqObject.AuthPolicy))
+		if err != nil {
+			writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid authorization policy: %w", err))
+			return
+		}
+		if authPolicy != nil {
+			// The policy of a run can only narrow the policy of the server, never allow more than it.
+			authPolicy = authPolicy.Narrow(requestPolicy)
+		} else {
+			authPolicy = requestPolicy
+		}
+	}
+
+	if authPolicy != nil {
+		// Calls the policy asks about are confirmed the same way as with confirm set.
+		opts.Runner.Authorizer = auth.NewPolicyAuthorizer(authPolicy, s.authorize)
+	} else if reqObject.Confirm {
 		opts.Runner.Authorizer = s.authorize
 	}
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/gptscript-ai/broadcaster"
+	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
 	"github.com/gptscript-ai/gptscript/pkg/mcp"
@@ -29,6 +30,7 @@ type Options struct {
 	gptscript.Options
 
 	MCPLoader                  loader.MCPLoader
+	AuthPolicy                 *auth.Policy
 	ListenAddress              string
 	DatasetTool, WorkspaceTool string
 	ServerToolsEnv             []string
@@ -118,10 +120,11 @@ func run(ctx context.Context, listener net.Listener, opts Options) error {
 
 		client:           g,
 		mcpLoader:        opts.MCPLoader,
+		authPolicy:       opts.AuthPolicy,
 		events:           events,
 		runtimeManager:   runtimes.Default(opts.Cache.CacheDir, opts.SystemToolsDir),
 		waitingToConfirm: make(map[string]chan runner.AuthorizerResponse),
-		waitingToPrompt:  make(map[string]chan map[string]string),
+		waitingToPrompt:  make(map[string]*waitingPrompt),
 		running:          make(map[string]chan struct{}),
 	}
 	defer s.close()
@@ -173,6 +176,7 @@ func complete(opts ...Options) Options {
 		result.Debug = types.FirstSet(opt.Debug, result.Debug)
 		result.DisableServerErrorLogging = types.FirstSet(opt.DisableServerErrorLogging, result.DisableServerErrorLogging)
 		result.MCPLoader = types.FirstSet(opt.MCPLoader, result.MCPLoader)
+		result.AuthPolicy = types.FirstSet(opt.AuthPolicy, result.AuthPolicy)
 	}
 
 	if result.ListenAddress == "" {
@@ -2,6 +2,7 @@ package sdkserver
 
 import (
 	"encoding/json"
+	"fmt"
 	"maps"
 	"time"
 
@@ -48,6 +49,7 @@ type toolOrFileRequest struct {
 	file          `json:",inline"`
 	cacheOptions  `json:",inline"`
 	openAIOptions `json:",inline"`
+	budgetOptions `json:",inline"`
 
 	ToolDefs             toolDefs `json:"toolDefs,inline"`
 	SubTool              string   `json:"subTool"`
@@ -58,11 +60,41 @@ type toolOrFileRequest struct {
 	CredentialContexts   []string `json:"credentialContexts"`
 	CredentialOverrides  []string `json:"credentialOverrides"`
 	Confirm              bool     `json:"confirm"`
+	AuthPolicy           string   `json:"authPolicy,omitempty"`
 	Location             string   `json:"location,omitempty"`
 	ForceSequential      bool     `json:"forceSequential"`
 	DefaultModelProvider string   `json:"DefaultModelProvider,omitempty"`
 }
 
+type budgetOptions struct {
+	MaxPromptTokens     int                          `json:"maxPromptTokens"`
+	MaxCompletionTokens int                          `json:"maxCompletionTokens"`
+	MaxTotalTokens      int                          `json:"maxTotalTokens"`
+	MaxDuration         string                       `json:"maxDuration"`
+	MaxCost             float64                      `json:"maxCost"`
+	ModelPrices         map[string]runner.ModelPrice `json:"modelPrices"`
+}
+
+func (b budgetOptions) toBudget() (runner.Budget, error) {
+	result := runner.Budget{
+		MaxPromptTokens:     b.MaxPromptTokens,
+		MaxCompletionTokens: b.MaxCompletionTokens,
+		MaxTotalTokens:      b.MaxTotalTokens,
+		MaxCost:             b.MaxCost,
+		ModelPrices:         b.ModelPrices,
+	}
+
+	if b.MaxDuration != "" {
+		d, err := time.ParseDuration(b.MaxDuration)
+		if err != nil {
+			return runner.Budget{}, fmt.Errorf("invalid max duration %q: %w", b.MaxDuration, err)
+		}
+		result.MaxDuration = d
+	}
+
+	return result, nil
+}
+
 type content struct {
 	Content string `json:"content"`
 }
@@ -184,6 +216,9 @@ func (r *runInfo) process(e event) map[string]any {
 		call.End = e.Time
 		call.setOutput(e.Content)
 
+	case runner.EventTypeCallCompaction:
+		call.Compaction = e.Compaction
+
 	case runner.EventTypeChat:
 		call.Usage = e.Usage
 		call.ChatResponseCached = e.ChatResponseCached
@@ -212,16 +247,17 @@ func (r *runInfo) processStdout(cs runner.ChatResponse) {
 type call struct {
 	engine.CallContext `json:",inline"`
 
-	Type               runner.EventType `json:"type"`
-	Start              time.Time        `json:"start"`
-	End                time.Time        `json:"end"`
-	Input              string           `json:"input"`
-	Output             []output         `json:"output"`
-	Usage              types.Usage      `json:"usage"`
-	ChatResponseCached bool             `json:"chatResponseCached"`
-	ToolResults        int              `json:"toolResults"`
-	LLMRequest         any              `json:"llmRequest"`
-	LLMResponse        any              `json:"llmResponse"`
+	Type               runner.EventType        `json:"type"`
+	Start              time.Time               `json:"start"`
+	End                time.Time               `json:"end"`
+	Input              string                  `json:"input"`
+	Output             []output                `json:"output"`
+	Usage              types.Usage             `json:"usage"`
+	ChatResponseCached bool                    `json:"chatResponseCached"`
+	ToolResults        int                     `json:"toolResults"`
+	LLMRequest         any                     `json:"llmRequest"`
+	LLMResponse        any                     `json:"llmResponse"`
+	Compaction         *types.CompactionStatus `json:"compaction,omitempty"`
 }
 
 func (c *call) setSubCalls(subCalls map[string]engine.Call) {
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	defaultGrepResults   = 100
+	defaultSearchResults = 10
+)
+
+// intArgument parses an optional number argument. All arguments of builtin tools are strings.
+func intArgument(name, value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number: %w", name, err)
+	}
+	return n, nil
+}
+
+func SysGrep(_ context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Pattern    string `json:"pattern,omitempty"`
+		Directory  string `json:"directory,omitempty"`
+		Include    string `json:"include,omitempty"`
+		Context    string `json:"context,omitempty"`
+		MaxResults string `json:"max_results,omitempty"`
+		IgnoreCase string `json:"ignore_case,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	contextLines, err := intArgument("context", params.Context, 0)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+	maxResults, err := intArgument("max_results", params.MaxResults, defaultGrepResults)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	log.Debugf("Searching for %s in %s", params.Pattern, params.Directory)
+	results, truncated, err := Grep(params.Directory, params.Pattern, GrepOptions{
+		Include:    params.Include,
+		Context:    contextLines,
+		MaxResults: maxResults,
+		IgnoreCase: params.IgnoreCase == "true",
+	})
+	if err != nil {
+		return fmt.Sprintf("Failed to search %s: %v", params.Directory, err), nil
+	}
+	if len(results) == 0 {
+		return "No matches found", nil
+	}
+
+	// The output looks like grep's, with ':' after the line number of matching lines and '-' after context lines.
+	var out strings.Builder
+	for i, result := range results {
+		if i > 0 && contextLines > 0 {
+			out.WriteString("--\n")
+		}
+		file := filepath.Join(params.Directory, filepath.FromSlash(result.File))
+		for _, line := range result.Lines {
+			sep := "-"
+			if line.Match {
+				sep = ":"
+			}
+			out.WriteString(fmt.Sprintf("%s%s%d%s%s\n", file, sep, line.Number, sep, line.Text))
+		}
+	}
+	if truncated {
+		out.WriteString(fmt.Sprintf("\nOnly the first %d matches are shown\n", maxResults))
+	}
+	return out.String(), nil
+}
+
+func SysSearch(_ context.Context, envs []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		Query     string `json:"query,omitempty"`
+		Directory string `json:"directory,omitempty"`
+		Limit     string `json:"limit,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	if params.Directory == "" {
+		params.Directory = "."
+	}
+
+	limit, err := intArgument("limit", params.Limit, defaultSearchResults)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	cacheDir := cache.Complete(cache.Options{
+		CacheDir: env.Getenv("GPTSCRIPT_CACHE_DIR", envs),
+	}).CacheDir
+
+	index, err := NewIndex(params.Directory, cacheDir)
+	if err != nil {
+		return fmt.Sprintf("Failed to search %s: %v", params.Directory, err), nil
+	}
+
+	log.Debugf("Searching for %s in %s", params.Query, params.Directory)
+	results, err := index.Search(params.Query, limit)
+	if err != nil {
+		return fmt.Sprintf("Failed to search %s: %v", params.Directory, err), nil
+	}
+	if len(results) == 0 {
+		return "No matches found", nil
+	}
+
+	var out strings.Builder
+	for _, result := range results {
+		out.WriteString(fmt.Sprintf("%s (score %.2f)\n", filepath.Join(params.Directory, filepath.FromSlash(result.File)), result.Score))
+		for _, line := range result.Snippet {
+			out.WriteString(fmt.Sprintf("  %d: %s\n", line.Number, line.Text))
+		}
+	}
+	return out.String(), nil
+}
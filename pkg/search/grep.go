@@ -0,0 +1,103 @@
+package search
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type GrepOptions struct {
+	// Include only searches the files whose name or path matches this glob, like "*.go".
+	Include string
+	// Context is the number of lines to return before and after every matching line.
+	Context int
+	// MaxResults is the maximum number of matching lines to return. There is no limit if it is zero.
+	MaxResults int
+	IgnoreCase bool
+}
+
+type Line struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	Match  bool   `json:"match,omitempty"`
+}
+
+// GrepResult is a group of consecutive lines of a file, with at least one matching line.
+type GrepResult struct {
+	File  string `json:"file"`
+	Lines []Line `json:"lines"`
+}
+
+// Grep searches the files under dir for lines that match the regular expression pattern. The second return value is
+// true if there were more matches than opts.MaxResults.
+func Grep(dir, pattern string, opts GrepOptions) ([]GrepResult, bool, error) {
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	var (
+		result    []GrepResult
+		matches   int
+		truncated bool
+	)
+	err = walk(dir, opts.Include, func(rel string, _ fs.FileInfo) error {
+		if truncated {
+			return filepath.SkipAll
+		}
+
+		data, ok, err := readText(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil || !ok {
+			// Files that can't be read are skipped, like grep does.
+			return nil
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		var current *GrepResult
+		// last is the index of the last line added to current.
+		last := -1
+		for i, line := range lines {
+			if !re.MatchString(line) {
+				continue
+			}
+			if opts.MaxResults > 0 && matches >= opts.MaxResults {
+				truncated = true
+				break
+			}
+			matches++
+
+			start := max(i-opts.Context, 0)
+			if current == nil || start > last+1 {
+				// Not touching the previous group of lines, so start a new one.
+				result = append(result, GrepResult{
+					File: rel,
+				})
+				current = &result[len(result)-1]
+			} else {
+				start = last + 1
+			}
+
+			for j := start; j < i; j++ {
+				current.Lines = append(current.Lines, Line{Number: j + 1, Text: lines[j]})
+			}
+			if last >= i {
+				// This line was added as context for the previous match.
+				current.Lines[len(current.Lines)-1-(last-i)].Match = true
+			} else {
+				current.Lines = append(current.Lines, Line{Number: i + 1, Text: line, Match: true})
+				last = i
+			}
+			for j := last + 1; j <= min(i+opts.Context, len(lines)-1); j++ {
+				current.Lines = append(current.Lines, Line{Number: j + 1, Text: lines[j]})
+				last = j
+			}
+		}
+		return nil
+	})
+	return result, truncated, err
+}
@@ -0,0 +1,304 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BurntSushi/locker"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+)
+
+const (
+	indexVersion = 1
+
+	// The usual BM25 parameters.
+	k1 = 1.2
+	b  = 0.75
+
+	maxSnippetLines = 3
+)
+
+type indexedFile struct {
+	ModTime time.Time      `json:"modTime"`
+	Size    int64          `json:"size"`
+	Length  int            `json:"length"`
+	Terms   map[string]int `json:"terms"`
+}
+
+type index struct {
+	Version int                     `json:"version"`
+	Root    string                  `json:"root"`
+	Files   map[string]*indexedFile `json:"files"`
+}
+
+// Index is a full-text index of the files in a directory, saved in a cache directory. It is brought up to date before
+// every search by reading only the files that changed since the last search.
+type Index struct {
+	dir, file string
+}
+
+func NewIndex(dir, cacheDir string) (*Index, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{
+		dir:  abs,
+		file: filepath.Join(cacheDir, "search", hash.ID(abs)+".json"),
+	}, nil
+}
+
+type SearchResult struct {
+	File    string  `json:"file"`
+	Score   float64 `json:"score"`
+	Snippet []Line  `json:"snippet,omitempty"`
+}
+
+// Search returns up to limit files that best match the query, the best match first.
+func (i *Index) Search(query string, limit int) ([]SearchResult, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil, errors.New("the query has no words to search for")
+	}
+
+	locker.Lock(i.file)
+	defer locker.Unlock(i.file)
+
+	idx, err := i.update()
+	if err != nil {
+		return nil, err
+	}
+
+	var totalLength int
+	docFreq := map[string]int{}
+	for _, file := range idx.Files {
+		totalLength += file.Length
+		for _, term := range terms {
+			if file.Terms[term] > 0 {
+				docFreq[term]++
+			}
+		}
+	}
+	if len(idx.Files) == 0 {
+		return nil, nil
+	}
+	avgLength := float64(totalLength) / float64(len(idx.Files))
+
+	var result []SearchResult
+	for name, file := range idx.Files {
+		var score float64
+		for _, term := range terms {
+			tf := float64(file.Terms[term])
+			if tf == 0 {
+				continue
+			}
+			n := float64(len(idx.Files))
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(file.Length)/avgLength))
+		}
+		if score > 0 {
+			result = append(result, SearchResult{
+				File:  name,
+				Score: score,
+			})
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		if result[a].Score == result[b].Score {
+			return result[a].File < result[b].File
+		}
+		return result[a].Score > result[b].Score
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	for j := range result {
+		result[j].Snippet = i.snippet(result[j].File, terms)
+	}
+	return result, nil
+}
+
+// update brings the saved index up to date with the files in the directory, and saves it if anything changed.
+func (i *Index) update() (*index, error) {
+	idx, err := i.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		changed bool
+		seen    = map[string]struct{}{}
+	)
+	err = walk(i.dir, "", func(rel string, info fs.FileInfo) error {
+		seen[rel] = struct{}{}
+
+		if existing, ok := idx.Files[rel]; ok && existing.ModTime.Equal(info.ModTime()) && existing.Size == info.Size() {
+			return nil
+		}
+
+		changed = true
+		data, ok, err := readText(filepath.Join(i.dir, filepath.FromSlash(rel)))
+		if err != nil || !ok {
+			delete(idx.Files, rel)
+			return nil
+		}
+
+		file := &indexedFile{
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Terms:   map[string]int{},
+		}
+		for _, term := range tokenize(string(data)) {
+			file.Terms[term]++
+			file.Length++
+		}
+		idx.Files[rel] = file
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %s: %w", i.dir, err)
+	}
+
+	for name := range idx.Files {
+		if _, ok := seen[name]; !ok {
+			delete(idx.Files, name)
+			changed = true
+		}
+	}
+
+	if changed {
+		return idx, i.write(idx)
+	}
+	return idx, nil
+}
+
+func (i *Index) read() (*index, error) {
+	idx := &index{
+		Version: indexVersion,
+		Root:    i.dir,
+		Files:   map[string]*indexedFile{},
+	}
+
+	data, err := os.ReadFile(i.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var saved index
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Version != indexVersion || saved.Root != i.dir || saved.Files == nil {
+		// A broken or outdated index is rebuilt.
+		return idx, nil
+	}
+	return &saved, nil
+}
+
+func (i *Index) write(idx *index) error {
+	if err := os.MkdirAll(filepath.Dir(i.file), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := system.WriteFileAtomic(i.file, data, 0600); err != nil {
+		return fmt.Errorf("failed to write search index: %w", err)
+	}
+	return nil
+}
+
+// snippet returns the lines of a file with the most query terms in them.
+func (i *Index) snippet(rel string, terms []string) []Line {
+	data, ok, err := readText(filepath.Join(i.dir, filepath.FromSlash(rel)))
+	if err != nil || !ok {
+		return nil
+	}
+
+	var lines []Line
+	scores := map[int]int{}
+	for n, text := range strings.Split(string(data), "\n") {
+		var score int
+		for _, term := range tokenize(text) {
+			for _, queryTerm := range terms {
+				if term == queryTerm {
+					score++
+				}
+			}
+		}
+		if score > 0 {
+			lines = append(lines, Line{Number: n + 1, Text: strings.TrimSpace(text), Match: true})
+			scores[n+1] = score
+		}
+	}
+
+	sort.SliceStable(lines, func(a, b int) bool {
+		return scores[lines[a].Number] > scores[lines[b].Number]
+	})
+	if len(lines) > maxSnippetLines {
+		lines = lines[:maxSnippetLines]
+	}
+	sort.Slice(lines, func(a, b int) bool {
+		return lines[a].Number < lines[b].Number
+	})
+	return lines
+}
+
+// tokenize splits text into lower case words. Identifiers like fooBar and foo_bar are also split into their parts, so
+// that searching for "bar" finds them.
+func tokenize(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		parts := splitIdentifier(word)
+		if len(parts) > 1 || parts[0] != word {
+			result = append(result, strings.ToLower(word))
+		}
+		for _, part := range parts {
+			if len(part) > 1 {
+				result = append(result, strings.ToLower(part))
+			}
+		}
+	}
+	return result
+}
+
+func splitIdentifier(word string) []string {
+	var (
+		parts []string
+		start int
+		runes = []rune(word)
+	)
+	for j := 1; j <= len(runes); j++ {
+		switch {
+		case j == len(runes):
+		case runes[j] == '_':
+		case unicode.IsUpper(runes[j]) && unicode.IsLower(runes[j-1]):
+		case unicode.IsUpper(runes[j]) && j+1 < len(runes) && unicode.IsLower(runes[j+1]) && unicode.IsUpper(runes[j-1]):
+		default:
+			continue
+		}
+		if part := strings.Trim(string(runes[start:j]), "_"); part != "" {
+			parts = append(parts, part)
+		}
+		start = j
+	}
+	if len(parts) == 0 {
+		return []string{word}
+	}
+	return parts
+}
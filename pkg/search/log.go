@@ -0,0 +1,5 @@
+package search
+
+import "github.com/gptscript-ai/gptscript/pkg/mvl"
+
+var log = mvl.Package()
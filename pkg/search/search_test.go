@@ -0,0 +1,149 @@
+package search
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func TestGrep(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go":        "package main\n\nfunc main() {\n\tgreet()\n}\n\nfunc greet() {\n\tprintln(\"hello\")\n}\n",
+		"pkg/util.go":    "package pkg\n\n// Greet says hello\nfunc Greet() {}\n",
+		"README.md":      "Greet the world\n",
+		".git/config":    "func greet\n",
+		"data/blob.bin":  "func greet\x00",
+		"pkg/notes.txt":  "nothing to see\n",
+		"pkg/more.go":    "package pkg\n",
+		"vendor/x/x.go":  "func greetVendor() {}\n",
+		"pkg/sub/sub.go": "func greet2() {}\n",
+	})
+
+	results, truncated, err := Grep(dir, `func \w*greet`, GrepOptions{Include: "*.go", IgnoreCase: true})
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, []GrepResult{
+		{File: "main.go", Lines: []Line{{Number: 7, Text: "func greet() {", Match: true}}},
+		{File: "pkg/sub/sub.go", Lines: []Line{{Number: 1, Text: "func greet2() {}", Match: true}}},
+		{File: "pkg/util.go", Lines: []Line{{Number: 4, Text: "func Greet() {}", Match: true}}},
+		{File: "vendor/x/x.go", Lines: []Line{{Number: 1, Text: "func greetVendor() {}", Match: true}}},
+	}, results)
+
+	// Matches with overlapping context are in the same group.
+	results, _, err = Grep(dir, `greet|hello`, GrepOptions{Include: "main.go", Context: 1})
+	require.NoError(t, err)
+	require.Equal(t, []GrepResult{{File: "main.go", Lines: []Line{
+		{Number: 3, Text: "func main() {"},
+		{Number: 4, Text: "\tgreet()", Match: true},
+		{Number: 5, Text: "}"},
+		{Number: 6, Text: ""},
+		{Number: 7, Text: "func greet() {", Match: true},
+		{Number: 8, Text: "\tprintln(\"hello\")", Match: true},
+		{Number: 9, Text: "}"},
+	}}}, results)
+
+	results, truncated, err = Grep(dir, `greet`, GrepOptions{MaxResults: 2})
+	require.NoError(t, err)
+	require.True(t, truncated)
+	require.Equal(t, []GrepResult{
+		{File: "main.go", Lines: []Line{{Number: 4, Text: "\tgreet()", Match: true}}},
+		{File: "main.go", Lines: []Line{{Number: 7, Text: "func greet() {", Match: true}}},
+	}, results)
+}
+
+func TestWalkUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt":   "a",
+		"b/c.txt": "c",
+		"d/e.txt": "e",
+	})
+	if os.Geteuid() != 0 {
+		require.NoError(t, os.Chmod(filepath.Join(dir, "d"), 0))
+		t.Cleanup(func() { _ = os.Chmod(filepath.Join(dir, "d"), 0755) })
+	}
+
+	var files []string
+	err := walk(dir, "", func(rel string, _ fs.FileInfo) error {
+		files = append(files, rel)
+		// A directory that is removed before it is read is skipped.
+		return os.RemoveAll(filepath.Join(dir, "b"))
+	})
+	require.NoError(t, err)
+	require.Contains(t, files, "a.txt")
+	require.NotContains(t, files, "b/c.txt")
+
+	// The directory that is searched has to exist.
+	require.Error(t, walk(filepath.Join(dir, "missing"), "", func(string, fs.FileInfo) error { return nil }))
+}
+
+func TestSysGrep(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+	})
+
+	out, err := SysGrep(context.Background(), nil, `{"pattern": "two", "directory": "`+dir+`", "context": "1"}`, nil)
+	require.NoError(t, err)
+	file := filepath.Join(dir, "a.txt")
+	require.Equal(t, file+"-1-one\n"+file+":2:two\n"+file+"-3-three\n", out)
+}
+
+func TestIndexSearch(t *testing.T) {
+	dir, cacheDir := t.TempDir(), t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"compaction.go": "package openai\n\n// CompactionStrategy decides which messages to drop.\ntype CompactionStrategy interface{}\n\nfunc summarize() {}\n",
+		"client.go":     "package openai\n\nfunc (c *Client) Call() {\n\t// call the compaction strategy\n}\n",
+		"count.go":      "package openai\n\nfunc countTokens() {}\n",
+	})
+
+	index, err := NewIndex(dir, cacheDir)
+	require.NoError(t, err)
+
+	results, err := index.Search("compaction strategy", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "compaction.go", results[0].File)
+	require.Equal(t, "client.go", results[1].File)
+	require.Equal(t, []Line{
+		{Number: 3, Text: "// CompactionStrategy decides which messages to drop.", Match: true},
+		{Number: 4, Text: "type CompactionStrategy interface{}", Match: true},
+	}, results[0].Snippet)
+
+	// The index is updated when files change.
+	writeFiles(t, dir, map[string]string{
+		"count.go": "package openai\n\nfunc countTokens() {\n\t// before compaction\n}\n",
+	})
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "count.go"), time.Now(), time.Now().Add(time.Minute)))
+	require.NoError(t, os.Remove(filepath.Join(dir, "client.go")))
+
+	results, err = index.Search("compaction", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "compaction.go", results[0].File)
+	require.Equal(t, "count.go", results[1].File)
+
+	saved, err := index.read()
+	require.NoError(t, err)
+	require.Len(t, saved.Files, 2)
+}
+
+func TestTokenize(t *testing.T) {
+	require.Equal(t, []string{"splitmessagesovercount", "split", "messages", "over", "count", "httpserver", "http", "server", "http_server", "http", "server", "to"},
+		tokenize("splitMessagesOverCount(HTTPServer, http_server) to a"))
+}
@@ -0,0 +1,94 @@
+// Package search finds text in the files of a directory, either by regular expression or with a ranked full-text
+// search over an index that is kept on disk.
+package search
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxFileSize is the size of the largest file that is searched. Larger files are most likely generated or data.
+const maxFileSize = 1 << 20
+
+// walk calls fn for every file under dir that should be searched, with the path of the file relative to dir. Hidden
+// files and directories are skipped, like .git. If include is set, only the files whose name or relative path match
+// the glob are searched. Files and directories that can't be read, or that are removed during the walk, are skipped.
+func walk(dir, include string, fn func(rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return skipUnreadable(p != dir, d, err)
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if include != "" {
+			nameMatch, err := path.Match(include, d.Name())
+			if err != nil {
+				return err
+			}
+			relMatch, _ := path.Match(include, rel)
+			if !nameMatch && !relMatch {
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return skipUnreadable(true, d, err)
+		}
+		if info.Size() > maxFileSize {
+			return nil
+		}
+		return fn(rel, info)
+	})
+}
+
+// skipUnreadable returns the error of a walk, or nil or fs.SkipDir if the entry can't be read and isn't the directory
+// that is searched.
+func skipUnreadable(skip bool, d fs.DirEntry, err error) error {
+	if !skip || (!errors.Is(err, fs.ErrPermission) && !errors.Is(err, fs.ErrNotExist)) {
+		return err
+	}
+	if d != nil && d.IsDir() {
+		return fs.SkipDir
+	}
+	return nil
+}
+
+// readText returns the contents of a file, or false if it is not a text file.
+func readText(file string) ([]byte, bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize))
+	if err != nil {
+		return nil, false, err
+	}
+	// Assume the file is not text if it contains a null byte, like sys.read does.
+	if bytes.IndexByte(data, 0) != -1 {
+		return nil, false, nil
+	}
+	return data, true, nil
+}
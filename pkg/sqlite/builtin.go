@@ -0,0 +1,111 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const defaultLimit = 100
+
+type params struct {
+	Database string `json:"database,omitempty"`
+	Tables   string `json:"tables,omitempty"`
+}
+
+func (p params) options(write bool) (Options, error) {
+	opts := Options{
+		Database: p.Database,
+		Write:    write,
+	}
+	if p.Tables != "" {
+		if err := json.Unmarshal([]byte(p.Tables), &opts.Tables); err != nil {
+			return opts, fmt.Errorf("tables must be a JSON object of table names to files: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+func SysSQLQuery(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		params
+		Query  string `json:"query,omitempty"`
+		Format string `json:"format,omitempty"`
+		Limit  string `json:"limit,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	opts, err := params.options(false)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	limit := defaultLimit
+	if params.Limit != "" {
+		if limit, err = strconv.Atoi(params.Limit); err != nil {
+			return types.InvalidArgument(input, fmt.Errorf("limit must be a number: %w", err)), nil
+		}
+	}
+
+	if params.Format != "" && params.Format != "markdown" && params.Format != "json" {
+		return types.InvalidArgument(input, fmt.Errorf("format must be markdown or json, not %q", params.Format)), nil
+	}
+
+	db, err := Open(ctx, opts)
+	if err != nil {
+		return fmt.Sprintf("Failed to open database: %v", err), nil
+	}
+	defer db.Close()
+
+	log.Debugf("Running query %s", params.Query)
+	result, err := db.Query(ctx, params.Query, limit)
+	if err != nil {
+		return fmt.Sprintf("Failed to run query: %v", err), nil
+	}
+
+	var out string
+	if params.Format == "json" {
+		if out, err = result.JSON(); err != nil {
+			return "", err
+		}
+	} else {
+		out = result.Markdown()
+	}
+	if result.Truncated {
+		out += fmt.Sprintf("\nOnly the first %d rows are shown", limit)
+	}
+	return out, nil
+}
+
+func SysSQLExec(ctx context.Context, _ []string, input string, _ chan<- string) (string, error) {
+	var params struct {
+		params
+		Statements string `json:"statements,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	opts, err := params.options(true)
+	if err != nil {
+		return types.InvalidArgument(input, err), nil
+	}
+
+	db, err := Open(ctx, opts)
+	if err != nil {
+		return fmt.Sprintf("Failed to open database: %v", err), nil
+	}
+	defer db.Close()
+
+	log.Debugf("Running statements %s", params.Statements)
+	n, err := db.Exec(ctx, params.Statements)
+	if err != nil {
+		return fmt.Sprintf("Failed to run statements: %v", err), nil
+	}
+	return fmt.Sprintf("Changed %d rows", n), nil
+}
@@ -0,0 +1,424 @@
+// Package sqlite runs SQL against local SQLite databases, with CSV and JSONL files loaded as tables.
+//
+// It uses the pure-Go driver from modernc.org/sqlite so that builds without cgo keep working.
+package sqlite
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const DriverName = "sqlite"
+
+var validTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type Options struct {
+	// Database is the SQLite database file. An in-memory database is used if it is not set.
+	Database string
+	// Tables maps table names to CSV, TSV or JSONL files that are loaded as temporary tables.
+	Tables map[string]string
+	// Write opens the database for writing. Otherwise nothing can be changed, not even the temporary tables.
+	Write bool
+}
+
+type DB struct {
+	db *sql.DB
+}
+
+func Open(ctx context.Context, opts Options) (*DB, error) {
+	dsn := ":memory:"
+	if opts.Database != "" {
+		mode := "rwc"
+		if !opts.Write {
+			// Opening a database that doesn't exist read-only gives a confusing error, so check first.
+			if _, err := os.Stat(opts.Database); err != nil {
+				return nil, err
+			}
+			mode = "ro"
+		}
+		dsn = "file:" + escapeURIPath(filepath.ToSlash(opts.Database)) + "?mode=" + mode
+	}
+
+	db, err := sql.Open(DriverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// Temporary tables only exist on the connection that created them.
+	db.SetMaxOpenConns(1)
+
+	d := &DB{db: db}
+	names := make([]string, 0, len(opts.Tables))
+	for name := range opts.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := d.load(ctx, name, opts.Tables[name]); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+
+	if !opts.Write {
+		if err := readOnly(ctx, db); err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// readOnly stops the connection from changing anything. query_only does not cover ATTACH, which creates the database
+// file it attaches if it doesn't exist, so attaching databases is turned off too.
+func readOnly(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = driver.Limit(conn, sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+	return err
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+func escapeURIPath(p string) string {
+	return strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(p)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// load creates a temporary table with the contents of a file. Temporary tables can be created even if the database
+// is read-only.
+func (d *DB) load(ctx context.Context, name, file string) error {
+	if !validTableName.MatchString(name) {
+		return fmt.Errorf("invalid table name %q, it must only contain letters, digits and underscores", name)
+	}
+
+	columns, rows, err := ReadTable(file)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Loaded %d rows from %s as table %s", len(rows), file, name)
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+		placeholders[i] = "?"
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TEMP TABLE %s (%s)", quoteIdentifier(name), strings.Join(quoted, ", "))); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", name, err)
+	}
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO temp.%s VALUES (%s)", quoteIdentifier(name), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, row := range rows {
+		if _, err := insert.ExecContext(ctx, row...); err != nil {
+			return fmt.Errorf("failed to load %s into table %s: %w", file, name, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ReadTable reads the columns and rows of a CSV, TSV or JSONL file, chosen by its extension. Numbers are converted so
+// that they compare like numbers in SQL.
+func ReadTable(file string) ([]string, [][]any, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		return readCSV(f, ',')
+	case ".tsv":
+		return readCSV(f, '\t')
+	case ".jsonl", ".ndjson":
+		return readJSONL(f)
+	}
+	return nil, nil, fmt.Errorf("unsupported file %s, only .csv, .tsv and .jsonl files can be loaded as tables", file)
+}
+
+func readCSV(r io.Reader, comma rune) ([]string, [][]any, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("the file is empty, the first line must have the names of the columns")
+	} else if err != nil {
+		return nil, nil, err
+	}
+	columns := columnNames(header)
+
+	var rows [][]any
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		row := make([]any, len(columns))
+		for i := range row {
+			if i < len(record) {
+				row[i] = parseValue(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// columnNames makes sure that all columns have a name, and that the names are unique.
+func columnNames(header []string) []string {
+	var (
+		columns = make([]string, len(header))
+		seen    = map[string]bool{}
+	)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = fmt.Sprintf("column%d", i+1)
+		}
+		for unique, n := name, 2; ; n++ {
+			if !seen[strings.ToLower(unique)] {
+				name = unique
+				break
+			}
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		seen[strings.ToLower(name)] = true
+		columns[i] = name
+	}
+	return columns
+}
+
+func parseValue(s string) any {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return f
+	}
+	return s
+}
+
+func readJSONL(r io.Reader) ([]string, [][]any, error) {
+	var (
+		columns []string
+		index   = map[string]int{}
+		objects []map[string]any
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+			return nil, nil, fmt.Errorf("line %d is not a JSON object: %w", line, err)
+		}
+		// The columns are the keys of all objects, in the order they are first seen. The order of the keys in a JSON
+		// object is lost when it is decoded, so the new keys of each object are sorted.
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if _, ok := index[key]; !ok {
+				index[key] = len(columns)
+				columns = append(columns, key)
+			}
+		}
+		objects = append(objects, obj)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil, errors.New("the file has no JSON objects with any keys")
+	}
+
+	rows := make([][]any, 0, len(objects))
+	for _, obj := range objects {
+		row := make([]any, len(columns))
+		for key, value := range obj {
+			row[index[key]] = jsonValue(value)
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case nil, string:
+		return v
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	default:
+		// Objects and lists are kept as JSON, which can be queried with the JSON functions of SQLite.
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+type Result struct {
+	Columns []string
+	Rows    [][]any
+	// Truncated is true if the query returned more rows than the limit.
+	Truncated bool
+}
+
+// Query runs a query and returns up to limit rows, or all rows if limit is not positive.
+func (d *DB) Query(ctx context.Context, query string, limit int) (*Result, error) {
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Columns: columns,
+	}
+	for rows.Next() {
+		if limit > 0 && len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// Exec runs statements that don't return rows, and returns how many rows they changed.
+func (d *DB) Exec(ctx context.Context, statements string) (int64, error) {
+	result, err := d.db.ExecContext(ctx, statements)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Markdown formats the result as a markdown table.
+func (r *Result) Markdown() string {
+	var out strings.Builder
+	writeRow := func(cells []string) {
+		out.WriteString("|")
+		for _, cell := range cells {
+			out.WriteString(" " + cell + " |")
+		}
+		out.WriteString("\n")
+	}
+
+	header := make([]string, len(r.Columns))
+	separator := make([]string, len(r.Columns))
+	for i, column := range r.Columns {
+		header[i] = markdownCell(column)
+		separator[i] = "---"
+	}
+	writeRow(header)
+	writeRow(separator)
+
+	for _, row := range r.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			if v == nil {
+				cells[i] = "NULL"
+			} else {
+				cells[i] = markdownCell(fmt.Sprint(v))
+			}
+		}
+		writeRow(cells)
+	}
+	return out.String()
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>").Replace(s)
+}
+
+// JSON formats the result as a JSON list of objects, one per row.
+func (r *Result) JSON() (string, error) {
+	objects := make([]map[string]any, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		obj := make(map[string]any, len(row))
+		for i, v := range row {
+			obj[r.Columns[i]] = v
+		}
+		objects = append(objects, obj)
+	}
+	data, err := json.Marshal(objects)
+	return string(data), err
+}
@@ -0,0 +1,142 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTable(t *testing.T) {
+	dir := t.TempDir()
+
+	csvFile := filepath.Join(dir, "people.csv")
+	require.NoError(t, os.WriteFile(csvFile, []byte("name,age,,Name\nalice,30,x,a\n\"bob, jr\",4.5\n"), 0600))
+	columns, rows, err := ReadTable(csvFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"name", "age", "column3", "Name_2"}, columns)
+	require.Equal(t, [][]any{
+		{"alice", int64(30), "x", "a"},
+		{"bob, jr", 4.5, nil, nil},
+	}, rows)
+
+	jsonlFile := filepath.Join(dir, "events.jsonl")
+	require.NoError(t, os.WriteFile(jsonlFile, []byte(`{"type": "click", "count": 2}
+
+{"type": "view", "ok": true, "tags": ["a"]}
+`), 0600))
+	columns, rows, err = ReadTable(jsonlFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"count", "type", "ok", "tags"}, columns)
+	require.Equal(t, [][]any{
+		{int64(2), "click", nil, nil},
+		{nil, "view", int64(1), `["a"]`},
+	}, rows)
+
+	require.NoError(t, os.WriteFile(jsonlFile, []byte("{\"a\": 1}\n[1]\n"), 0600))
+	_, _, err = ReadTable(jsonlFile)
+	require.ErrorContains(t, err, "line 2 is not a JSON object")
+
+	_, _, err = ReadTable(filepath.Join(dir, "data.xlsx"))
+	require.Error(t, err)
+}
+
+func TestResultFormats(t *testing.T) {
+	result := &Result{
+		Columns: []string{"name", "note"},
+		Rows: [][]any{
+			{"alice", "a|b\nc"},
+			{"bob", nil},
+		},
+	}
+	require.Equal(t, "| name | note |\n| --- | --- |\n| alice | a\\|b<br>c |\n| bob | NULL |\n", result.Markdown())
+
+	out, err := result.JSON()
+	require.NoError(t, err)
+	require.Equal(t, `[{"name":"alice","note":"a|b\nc"},{"name":"bob","note":null}]`, out)
+}
+
+func TestSysSQL(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		dir      = t.TempDir()
+		database = filepath.Join(dir, "shop.db")
+		sales    = filepath.Join(dir, "sales.csv")
+	)
+	require.NoError(t, os.WriteFile(sales, []byte("item,amount\nbook,12\npen,2.5\nbook,8\n"), 0600))
+
+	args := func(v map[string]string) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return string(data)
+	}
+	tables := args(map[string]string{"sales": sales})
+
+	out, err := SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":  "SELECT item, SUM(amount) AS total FROM sales GROUP BY item ORDER BY total DESC",
+		"tables": tables,
+	}), nil)
+	require.NoError(t, err)
+	require.Equal(t, "| item | total |\n| --- | --- |\n| book | 20 |\n| pen | 2.5 |\n", out)
+
+	out, err = SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":  "SELECT item FROM sales ORDER BY amount",
+		"tables": tables,
+		"format": "json",
+		"limit":  "2",
+	}), nil)
+	require.NoError(t, err)
+	require.Equal(t, `[{"item":"pen"},{"item":"book"}]`+"\nOnly the first 2 rows are shown", out)
+
+	// Queries can not change anything, not even the loaded tables.
+	out, err = SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":  "DELETE FROM sales",
+		"tables": tables,
+	}), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "Failed to run query")
+
+	// Queries can not attach databases, which would create the attached file.
+	attached := filepath.Join(dir, "attached.db")
+	out, err = SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":  "ATTACH DATABASE '" + attached + "' AS x",
+		"tables": tables,
+	}), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "Failed to run query")
+	require.NoFileExists(t, attached)
+
+	// A database that doesn't exist is only created by sys.sql.exec.
+	out, err = SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":    "SELECT 1",
+		"database": database,
+	}), nil)
+	require.NoError(t, err)
+	require.Contains(t, out, "Failed to open database")
+
+	out, err = SysSQLExec(ctx, nil, args(map[string]string{
+		"statements": "CREATE TABLE totals (item, total); INSERT INTO totals SELECT item, SUM(amount) FROM sales GROUP BY item",
+		"database":   database,
+		"tables":     tables,
+	}), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Changed 2 rows", out)
+
+	out, err = SysSQLExec(ctx, nil, args(map[string]string{
+		"statements": "UPDATE totals SET total = total * 2",
+		"database":   database,
+	}), nil)
+	require.NoError(t, err)
+	require.Equal(t, "Changed 2 rows", out)
+
+	out, err = SysSQLQuery(ctx, nil, args(map[string]string{
+		"query":    "SELECT * FROM totals ORDER BY item",
+		"database": database,
+		"format":   "json",
+	}), nil)
+	require.NoError(t, err)
+	require.Equal(t, `[{"item":"book","total":40},{"item":"pen","total":5}]`, out)
+}
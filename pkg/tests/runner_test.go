@@ -283,7 +283,8 @@ func TestSubChat(t *testing.T) {
                   "text": "Call chatbot"
                 }
               ],
-              "usage": {}
+              "usage": {},
+              "cacheControl": true
             },
             {
               "role": "user",
@@ -309,7 +310,8 @@ func TestSubChat(t *testing.T) {
               ],
               "usage": {}
             }
-          ]
+          ],
+          "cacheTools": true
         },
         "pending": {
           "call_1": {
@@ -345,7 +347,8 @@ func TestSubChat(t *testing.T) {
                         "text": "This is a chatbot"
                       }
                     ],
-                    "usage": {}
+                    "usage": {},
+                    "cacheControl": true
                   },
                   {
                     "role": "assistant",
@@ -408,7 +411,8 @@ func TestSubChat(t *testing.T) {
                   "text": "Call chatbot"
                 }
               ],
-              "usage": {}
+              "usage": {},
+              "cacheControl": true
             },
             {
               "role": "user",
@@ -434,7 +438,8 @@ func TestSubChat(t *testing.T) {
               ],
               "usage": {}
             }
-          ]
+          ],
+          "cacheTools": true
         },
         "pending": {
           "call_1": {
@@ -470,7 +475,8 @@ func TestSubChat(t *testing.T) {
                         "text": "This is a chatbot"
                       }
                     ],
-                    "usage": {}
+                    "usage": {},
+                    "cacheControl": true
                   },
                   {
                     "role": "assistant",
@@ -547,7 +553,8 @@ func TestChat(t *testing.T) {
                   "text": "This is a chatbot"
                 }
               ],
-              "usage": {}
+              "usage": {},
+              "cacheControl": true
             },
             {
               "role": "user",
@@ -599,7 +606,8 @@ func TestChat(t *testing.T) {
                   "text": "This is a chatbot"
                 }
               ],
-              "usage": {}
+              "usage": {},
+              "cacheControl": true
             },
             {
               "role": "user",
@@ -706,6 +714,29 @@ func TestToolAs(t *testing.T) {
 	assert.Equal(t, "TEST RESULT CALL: 1", x)
 }
 
+func TestToolChoice(t *testing.T) {
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "local",
+		},
+	})
+	// The first call must call local, the call after the tool call is free to answer.
+	x, err := r.Run("", `{}`)
+	require.NoError(t, err)
+	assert.Equal(t, "TEST RESULT CALL: 3", x)
+
+	prg, err := loader.ProgramFromSource(context.Background(), `
+tools: sys.ls
+tool choice: sys.read
+
+List the files
+`, "")
+	require.NoError(t, err)
+	_, err = r.Runner.Run(context.Background(), prg, nil, "", runner.RunOptions{})
+	assert.ErrorContains(t, err, "tool choice sys.read is not one of the tools")
+}
+
 func TestCwd(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip()
@@ -813,6 +844,17 @@ func TestInput(t *testing.T) {
 	autogold.ExpectFile(t, toJSONString(t, resp), autogold.Name(t.Name()+"/step2"))
 }
 
+func TestJSONQueryOutputFilter(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	r := tester.NewRunner(t)
+	out, err := r.Run("", "")
+	require.NoError(t, err)
+	assert.Equal(t, `["b","c"]`, out)
+}
+
 func TestOutput(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip()
@@ -933,6 +975,44 @@ func TestMissingTool(t *testing.T) {
 	autogold.Expect("TEST RESULT CALL: 2").Equal(t, resp)
 }
 
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "bob",
+			Arguments: `{"question": "original"}`,
+		},
+	})
+
+	resp, err := r.Run("", "Input 1")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	autogold.Expect("TEST RESULT CALL: 2").Equal(t, resp)
+}
+
+func TestHooksArgs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "bob",
+			Arguments: `{"output": "from args"}`,
+		},
+	})
+
+	resp, err := r.Run("", "Input 1")
+	require.NoError(t, err)
+	r.AssertResponded(t)
+	autogold.Expect("TEST RESULT CALL: 2").Equal(t, resp)
+}
+
 func TestToolRefAll(t *testing.T) {
 	r := tester.NewRunner(t)
 	r.RunDefault()
@@ -96,3 +96,8 @@ func GetToolRefInput(prg *Program, ref ToolReference, input string) (string, err
 	output, err := json.Marshal(outputMap)
 	return string(output), err
 }
+
+// InvalidArgument is the result a built-in tool returns to the LLM when its arguments can't be parsed.
+func InvalidArgument(input string, err error) string {
+	return fmt.Sprintf("Failed to parse arguments %s: %v", input, err)
+}
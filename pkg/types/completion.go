@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	humav2 "github.com/danielgtaylor/huma/v2"
@@ -17,6 +18,119 @@ type CompletionRequest struct {
 	Temperature          *float32             `json:"temperature,omitempty"`
 	JSONResponse         bool                 `json:"jsonResponse,omitempty"`
 	Cache                *bool                `json:"cache,omitempty"`
+	Compaction           string               `json:"compaction,omitempty"`
+	CompactionModel      string               `json:"compactionModel,omitempty"`
+	ReasoningEffort      string               `json:"reasoningEffort,omitempty"`
+	// ToolChoice is auto, none, required or the name of the function that the model must call.
+	ToolChoice string `json:"toolChoice,omitempty"`
+	// ParallelToolCalls set to false makes the model call at most one tool at a time.
+	ParallelToolCalls *bool `json:"parallelToolCalls,omitempty"`
+	// CacheTools marks the tool definitions as the same in every call, so that providers that support prompt
+	// caching can cache them.
+	CacheTools bool `json:"cacheTools,omitempty"`
+}
+
+// SplitModels splits a model name into a list of fallbacks, like "gpt-4o, claude-sonnet-4-5". The models are tried in
+// order until one of them answers.
+func SplitModels(model string) []string {
+	var models []string
+	for _, m := range strings.Split(model, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// Reasoning efforts understood by all providers. A reasoning effort can also be a number of tokens that the model may
+// spend on thinking before it answers.
+const (
+	ReasoningEffortMinimal = "minimal"
+	ReasoningEffortLow     = "low"
+	ReasoningEffortMedium  = "medium"
+	ReasoningEffortHigh    = "high"
+)
+
+var reasoningBudgets = []struct {
+	effort string
+	budget int
+}{
+	{ReasoningEffortMinimal, 1024},
+	{ReasoningEffortLow, 4096},
+	{ReasoningEffortMedium, 8192},
+	{ReasoningEffortHigh, 16384},
+}
+
+// ParseReasoningEffort normalizes a reasoning effort and returns an error if it is neither a known effort nor a
+// positive number of tokens.
+func ParseReasoningEffort(effort string) (string, error) {
+	effort = strings.ToLower(strings.TrimSpace(effort))
+	for _, b := range reasoningBudgets {
+		if effort == b.effort {
+			return effort, nil
+		}
+	}
+	if budget, err := strconv.Atoi(effort); err == nil && budget > 0 {
+		return effort, nil
+	}
+	return "", fmt.Errorf("invalid reasoning effort %q, must be minimal, low, medium, high or a number of tokens", effort)
+}
+
+// ReasoningLevel returns the reasoning effort as one of the named efforts, for providers that don't take a budget.
+func (r *CompletionRequest) ReasoningLevel() string {
+	budget := r.ReasoningBudget()
+	if budget == 0 {
+		return ""
+	}
+	for _, b := range reasoningBudgets {
+		if budget <= b.budget {
+			return b.effort
+		}
+	}
+	return ReasoningEffortHigh
+}
+
+// ReasoningBudget returns the reasoning effort as a number of tokens, for providers that take a thinking budget. It
+// is 0 if no reasoning effort is set.
+func (r *CompletionRequest) ReasoningBudget() int {
+	for _, b := range reasoningBudgets {
+		if r.ReasoningEffort == b.effort {
+			return b.budget
+		}
+	}
+	budget, _ := strconv.Atoi(r.ReasoningEffort)
+	return max(budget, 0)
+}
+
+// Tool choices understood by all providers. A tool choice can also be the name of a tool that the model must call.
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+)
+
+// ParseToolChoice normalizes the keywords of a tool choice and leaves the name of a tool as it is.
+func ParseToolChoice(choice string) string {
+	choice = strings.TrimSpace(choice)
+	switch lower := strings.ToLower(choice); lower {
+	case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+		return lower
+	}
+	return choice
+}
+
+// ForcesToolCall returns whether the tool choice makes the model call a tool instead of answering.
+func (r *CompletionRequest) ForcesToolCall() bool {
+	return r.ToolChoice != "" && r.ToolChoice != ToolChoiceAuto && r.ToolChoice != ToolChoiceNone
+}
+
+// ForcedFunction returns the name of the function that the model must call, or "" if the tool choice is not a
+// function.
+func (r *CompletionRequest) ForcedFunction() string {
+	if r.ForcesToolCall() && r.ToolChoice != ToolChoiceRequired {
+		return r.ToolChoice
+	}
+	return ""
 }
 
 func (r *CompletionRequest) GetCache() bool {
@@ -54,6 +168,9 @@ type CompletionMessage struct {
 	// result of the call describe by this field
 	ToolCall *CompletionToolCall `json:"toolCall,omitempty"`
 	Usage    Usage               `json:"usage,omitempty"`
+	// CacheControl marks the message as the end of a prefix of the conversation that is sent again unchanged, so
+	// that providers that support prompt caching can cache it.
+	CacheControl bool `json:"cacheControl,omitempty"`
 }
 
 func (c CompletionMessage) ChatText() string {
@@ -74,15 +191,36 @@ type Usage struct {
 	PromptTokens     int `json:"promptTokens,omitempty"`
 	CompletionTokens int `json:"completionTokens,omitempty"`
 	TotalTokens      int `json:"totalTokens,omitempty"`
+	// ReasoningTokens are the completion tokens that the model spent on thinking, they are included in
+	// CompletionTokens.
+	ReasoningTokens int `json:"reasoningTokens,omitempty"`
+	// CacheReadTokens are the prompt tokens that were read from the prompt cache of the provider, and
+	// CacheWriteTokens the prompt tokens that were written to it. Both are included in PromptTokens.
+	CacheReadTokens  int `json:"cacheReadTokens,omitempty"`
+	CacheWriteTokens int `json:"cacheWriteTokens,omitempty"`
 }
 
 type CompletionStatus struct {
 	CompletionID    string
+	Model           string
 	Request         any
 	Response        any
 	Usage           Usage
 	Cached          bool
 	PartialResponse *CompletionMessage
+	Compaction      *CompactionStatus
+}
+
+// Strategies for reducing the conversation history once it no longer fits in the context window.
+const (
+	CompactionDrop      = "drop"
+	CompactionSummarize = "summarize"
+)
+
+type CompactionStatus struct {
+	Strategy        string `json:"strategy,omitempty"`
+	DroppedMessages int    `json:"droppedMessages,omitempty"`
+	Summary         string `json:"summary,omitempty"`
 }
 
 func (c CompletionMessage) IsToolCall() bool {
@@ -103,11 +241,18 @@ func Text(text string) []ContentPart {
 }
 
 func (c CompletionMessage) String() string {
-	buf := strings.Builder{}
-	for i, content := range c.Content {
-		if i > 0 {
+	var (
+		buf     = strings.Builder{}
+		written bool
+	)
+	for _, content := range c.Content {
+		if content.Reasoning != nil || content.Image != nil || content.File != nil {
+			continue
+		}
+		if written {
 			buf.WriteString("\n")
 		}
+		written = true
 		buf.WriteString(content.Text)
 		if content.ToolCall != nil {
 			buf.WriteString(fmt.Sprintf("<tool call> %s -> %s", content.ToolCall.Function.Name, content.ToolCall.Function.Arguments))
@@ -117,8 +262,21 @@ func (c CompletionMessage) String() string {
 }
 
 type ContentPart struct {
-	Text     string              `json:"text,omitempty"`
-	ToolCall *CompletionToolCall `json:"toolCall,omitempty"`
+	Text      string              `json:"text,omitempty"`
+	ToolCall  *CompletionToolCall `json:"toolCall,omitempty"`
+	Reasoning *Reasoning          `json:"reasoning,omitempty"`
+	Image     *Media              `json:"image,omitempty"`
+	File      *Media              `json:"file,omitempty"`
+}
+
+// Reasoning is what the model thought before it answered. It is not part of the answer, and is only sent back to
+// the providers that require it in follow-up requests.
+type Reasoning struct {
+	Text string `json:"text,omitempty"`
+	// Signature verifies the reasoning when it is sent back to the provider that produced it.
+	Signature string `json:"signature,omitempty"`
+	// Redacted is reasoning that the provider returned encrypted, it has no text.
+	Redacted string `json:"redacted,omitempty"`
 }
 
 type CompletionToolCall struct {
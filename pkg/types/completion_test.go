@@ -0,0 +1,51 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReasoningEffort(t *testing.T) {
+	effort, err := ParseReasoningEffort(" Medium ")
+	require.NoError(t, err)
+	assert.Equal(t, ReasoningEffortMedium, effort)
+
+	effort, err = ParseReasoningEffort("3000")
+	require.NoError(t, err)
+	assert.Equal(t, "3000", effort)
+
+	_, err = ParseReasoningEffort("0")
+	assert.Error(t, err)
+	_, err = ParseReasoningEffort("max")
+	assert.Error(t, err)
+}
+
+func TestReasoningBudgetAndLevel(t *testing.T) {
+	for _, test := range []struct {
+		effort string
+		budget int
+		level  string
+	}{
+		{"", 0, ""},
+		{ReasoningEffortMinimal, 1024, ReasoningEffortMinimal},
+		{ReasoningEffortHigh, 16384, ReasoningEffortHigh},
+		{"500", 500, ReasoningEffortMinimal},
+		{"6000", 6000, ReasoningEffortMedium},
+		{"100000", 100000, ReasoningEffortHigh},
+	} {
+		r := CompletionRequest{ReasoningEffort: test.effort}
+		assert.Equal(t, test.budget, r.ReasoningBudget(), test.effort)
+		assert.Equal(t, test.level, r.ReasoningLevel(), test.effort)
+	}
+}
+
+func TestStringSkipsReasoning(t *testing.T) {
+	msg := CompletionMessage{Content: []ContentPart{
+		{Reasoning: &Reasoning{Text: "thinking"}},
+		{Text: "answer"},
+	}}
+	assert.Equal(t, "answer", msg.String())
+	assert.Equal(t, "answer", msg.ChatText())
+}
@@ -0,0 +1,140 @@
+package types
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Media is an image or a file in a message. The URL is either a data URL with the content, or an http(s) URL that
+// the provider downloads itself.
+type Media struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mimeType,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// Base64 returns the base64 encoded content of a data URL.
+func (m Media) Base64() (string, bool) {
+	if !strings.HasPrefix(m.URL, "data:") {
+		return "", false
+	}
+	_, data, ok := strings.Cut(m.URL, ";base64,")
+	return data, ok
+}
+
+// PlainURL returns the URL without the parameters of a data URL, which providers don't accept.
+func (m Media) PlainURL() string {
+	if data, ok := m.Base64(); ok {
+		return "data:" + m.MimeType + ";base64," + data
+	}
+	return m.URL
+}
+
+// IsImage returns true if the MIME type is an image type.
+func IsImage(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/")
+}
+
+// IsAttachable returns true for the types of files that LLMs can look at: images and PDFs.
+func IsAttachable(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// MediaPart returns an image part for images and a file part for everything else.
+func MediaPart(m Media) ContentPart {
+	if IsImage(m.MimeType) {
+		return ContentPart{Image: &m}
+	}
+	return ContentPart{File: &m}
+}
+
+// DataURL returns the base64 data URL of the content. The name is added as a parameter so that it survives when the
+// data URL is passed around as text.
+func DataURL(mimeType, name string, data []byte) string {
+	buf := strings.Builder{}
+	buf.WriteString("data:")
+	buf.WriteString(mimeType)
+	if name != "" {
+		buf.WriteString(";name=")
+		buf.WriteString(strings.NewReplacer(";", "", ",", "", "\n", "").Replace(name))
+	}
+	buf.WriteString(";base64,")
+	buf.WriteString(base64.StdEncoding.EncodeToString(data))
+	return buf.String()
+}
+
+// MimeType guesses the MIME type from the file name, or from the content if the extension isn't known.
+func MimeType(name string, data []byte) string {
+	if mimeType, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name))); err == nil {
+		return mimeType
+	}
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mimeType
+}
+
+// ParseDataURL returns the media of a line that is a base64 data URL, like "data:image/png;base64,...".
+func ParseDataURL(line string) (Media, bool) {
+	header, data, ok := strings.Cut(line, ";base64,")
+	if !ok || data == "" || strings.ContainsAny(data, " \t") {
+		return Media{}, false
+	}
+	header, ok = strings.CutPrefix(header, "data:")
+	if !ok {
+		return Media{}, false
+	}
+
+	mimeType, params, _ := strings.Cut(header, ";")
+	if !strings.Contains(mimeType, "/") || strings.ContainsAny(mimeType, " \t") {
+		return Media{}, false
+	}
+
+	result := Media{
+		URL:      line,
+		MimeType: strings.ToLower(mimeType),
+	}
+	for _, param := range strings.Split(params, ";") {
+		if name, ok := strings.CutPrefix(param, "name="); ok {
+			result.Name = name
+		}
+	}
+	return result, true
+}
+
+// appendText adds the lines as a text part, unless they are blank.
+func appendText(parts []ContentPart, lines []string) []ContentPart {
+	text := strings.Join(lines, "\n")
+	if strings.TrimSpace(text) == "" {
+		return parts
+	}
+	return append(parts, ContentPart{Text: text})
+}
+
+// Content splits text into text, image and file parts. Each line of the text that is a base64 data URL becomes an
+// image or a file. Text without data URLs is a single text part.
+func Content(text string) []ContentPart {
+	var (
+		result []ContentPart
+		lines  []string
+	)
+	for _, line := range strings.Split(text, "\n") {
+		media, ok := ParseDataURL(strings.TrimSpace(line))
+		if !ok {
+			lines = append(lines, line)
+			continue
+		}
+		result = appendText(result, lines)
+		result = append(result, MediaPart(media))
+		lines = nil
+	}
+	if len(result) == 0 {
+		return Text(text)
+	}
+	return appendText(result, lines)
+}
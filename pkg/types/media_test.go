@@ -0,0 +1,41 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDataURL(t *testing.T) {
+	media, ok := ParseDataURL("data:image/PNG;name=chart.png;base64,aGk=")
+	assert.True(t, ok)
+	assert.Equal(t, Media{URL: "data:image/PNG;name=chart.png;base64,aGk=", MimeType: "image/png", Name: "chart.png"}, media)
+	assert.Equal(t, "data:image/png;base64,aGk=", media.PlainURL())
+
+	for _, line := range []string{
+		"data:image/png;base64,",
+		"the data:image/png;base64,aGk=",
+		"data:png;base64,aGk=",
+		"data:image/png;base64,aGk= and more",
+	} {
+		_, ok := ParseDataURL(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestContent(t *testing.T) {
+	assert.Equal(t, Text("no images\n"), Content("no images\n"))
+
+	assert.Equal(t, []ContentPart{
+		{Text: "Here is the chart"},
+		{Image: &Media{URL: "data:image/png;base64,aGk=", MimeType: "image/png"}},
+		{Text: "and the report"},
+		{File: &Media{URL: "data:application/pdf;name=report.pdf;base64,aGk=", MimeType: "application/pdf", Name: "report.pdf"}},
+	}, Content("Here is the chart\ndata:image/png;base64,aGk=\nand the report\n data:application/pdf;name=report.pdf;base64,aGk=\n"))
+}
+
+func TestDataURL(t *testing.T) {
+	assert.Equal(t, "data:image/png;name=ab.png;base64,aGk=", DataURL("image/png", "a;b,\n.png", []byte("hi")))
+	assert.Equal(t, "image/png", MimeType("chart.png", nil))
+	assert.Equal(t, "application/pdf", MimeType("report", []byte("%PDF-1.7\n")))
+}
@@ -2,7 +2,14 @@ package types
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -17,15 +24,162 @@ type Prompt struct {
 	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
+type FieldType string
+
+const (
+	FieldTypeString    FieldType = "string"
+	FieldTypeMultiline FieldType = "multiline"
+	FieldTypeNumber    FieldType = "number"
+	FieldTypeBoolean   FieldType = "boolean"
+	FieldTypeDate      FieldType = "date"
+	FieldTypeFile      FieldType = "file"
+	FieldTypeSecret    FieldType = "secret"
+)
+
+var fieldTypes = []FieldType{
+	FieldTypeString, FieldTypeMultiline, FieldTypeNumber, FieldTypeBoolean, FieldTypeDate, FieldTypeFile, FieldTypeSecret,
+}
+
 type Field struct {
 	Name        string   `json:"name,omitempty"`
 	Sensitive   *bool    `json:"sensitive,omitempty"`
 	Description string   `json:"description,omitempty"`
 	Options     []string `json:"options,omitempty"`
+	// Type is the kind of value of the field, a string if it is not set.
+	Type     FieldType `json:"type,omitempty"`
+	Required bool      `json:"required,omitempty"`
+	// Pattern is a regular expression that the whole value must match, as if it was written as ^(?:pattern)$.
+	Pattern string `json:"pattern,omitempty"`
+	// Min and Max are the bounds of the value of number fields, and of the length of the value of other fields.
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	Default string   `json:"default,omitempty"`
+}
+
+// IsSensitive returns whether the value of the field should be hidden when it is entered. Secret fields are always
+// sensitive, other fields are if they say so or else if the whole prompt is.
+func (f Field) IsSensitive(prompt bool) bool {
+	if f.Type == FieldTypeSecret {
+		return true
+	}
+	if f.Sensitive != nil {
+		return *f.Sensitive
+	}
+	return prompt
+}
+
+// Check returns an error if the definition of the field is invalid.
+func (f Field) Check() error {
+	if f.Name == "" {
+		return errors.New("a field must have a name")
+	}
+	if f.Type != "" && !slices.Contains(fieldTypes, f.Type) {
+		return fmt.Errorf("field %s has unknown type %q, must be one of %s", f.Name, f.Type, joinFieldTypes())
+	}
+	if _, err := regexp.Compile(f.Pattern); err != nil {
+		return fmt.Errorf("field %s has an invalid pattern: %w", f.Name, err)
+	}
+	if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+		return fmt.Errorf("field %s has a min that is greater than its max", f.Name)
+	}
+	if f.Default != "" {
+		if err := f.Validate(f.Default); err != nil {
+			return fmt.Errorf("the default value of field %s is invalid: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func joinFieldTypes() string {
+	names := make([]string, len(fieldTypes))
+	for i, t := range fieldTypes {
+		names[i] = string(t)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validate returns an error if value is not valid for the field. An empty value is valid unless the field is required
+// and has no default.
+func (f Field) Validate(value string) error {
+	if value == "" {
+		if f.Required && f.Default == "" {
+			return errors.New("a value is required")
+		}
+		return nil
+	}
+
+	if len(f.Options) > 0 && !slices.Contains(f.Options, value) {
+		return fmt.Errorf("the value must be one of %s", strings.Join(f.Options, ", "))
+	}
+
+	length := float64(utf8.RuneCountInString(value))
+	switch f.Type {
+	case FieldTypeNumber:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errors.New("the value must be a number")
+		}
+		if f.Min != nil && n < *f.Min {
+			return fmt.Errorf("the value must be at least %v", *f.Min)
+		}
+		if f.Max != nil && n > *f.Max {
+			return fmt.Errorf("the value must be at most %v", *f.Max)
+		}
+	case FieldTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return errors.New("the value must be true or false")
+		}
+	case FieldTypeDate:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return errors.New("the value must be a date like 2006-01-02")
+		}
+	default:
+		if f.Min != nil && length < *f.Min {
+			return fmt.Errorf("the value must be at least %v characters long", *f.Min)
+		}
+		if f.Max != nil && length > *f.Max {
+			return fmt.Errorf("the value must be at most %v characters long", *f.Max)
+		}
+	}
+
+	if f.Pattern != "" {
+		re, err := regexp.Compile("^(?:" + f.Pattern + ")$")
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("the value must match the pattern %s", f.Pattern)
+		}
+	}
+	return nil
 }
 
 type Fields []Field
 
+// Check returns an error if the definition of any of the fields is invalid.
+func (f Fields) Check() error {
+	var errs []error
+	for _, field := range f {
+		errs = append(errs, field.Check())
+	}
+	return errors.Join(errs...)
+}
+
+// Validate sets the default values of the fields that are missing or empty in values, and returns an error for each
+// value that is not valid.
+func (f Fields) Validate(values map[string]string) error {
+	var errs []error
+	for _, field := range f {
+		if values[field.Name] == "" && field.Default != "" {
+			values[field.Name] = field.Default
+		}
+		if err := field.Validate(values[field.Name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // UnmarshalJSON will unmarshal the corresponding JSON object for Fields,
 // or a comma-separated strings (for backwards compatibility).
 func (f *Fields) UnmarshalJSON(b []byte) error {
@@ -51,7 +205,10 @@ func (f *Fields) UnmarshalJSON(b []byte) error {
 		fieldsArr := strings.Split(fields, ",")
 		*f = make([]Field, 0, len(fieldsArr))
 		for _, field := range fieldsArr {
-			*f = append(*f, Field{Name: strings.TrimSpace(field)})
+			// Lists like "name," have always been accepted, so empty names are skipped rather than rejected by Check.
+			if name := strings.TrimSpace(field); name != "" {
+				*f = append(*f, Field{Name: name})
+			}
 		}
 	}
 
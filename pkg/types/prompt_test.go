@@ -2,6 +2,7 @@ package types
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -101,6 +102,12 @@ func TestFieldsUnmarshalJSON(t *testing.T) {
 			expected:  Fields{{Name: "field1"}, {Name: "field2"}, {Name: "field3"}},
 			expectErr: false,
 		},
+		{
+			name:      "skip empty names in single string input",
+			input:     []byte(`"field1,, field2,"`),
+			expected:  Fields{{Name: "field1"}, {Name: "field2"}},
+			expectErr: false,
+		},
 		{
 			name:      "invalid JSON array",
 			input:     []byte(`[{"Name":"field1"},{"Name":field2}]`),
@@ -140,3 +147,98 @@ func TestFieldsUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestFieldValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		field     Field
+		value     string
+		expectErr bool
+	}{
+		{name: "empty optional", field: Field{Name: "f"}, value: ""},
+		{name: "empty required", field: Field{Name: "f", Required: true}, value: "", expectErr: true},
+		{name: "empty required with default", field: Field{Name: "f", Required: true, Default: "x"}, value: ""},
+		{name: "option", field: Field{Name: "f", Options: []string{"a", "b"}}, value: "b"},
+		{name: "not an option", field: Field{Name: "f", Options: []string{"a", "b"}}, value: "c", expectErr: true},
+		{name: "number", field: Field{Name: "f", Type: FieldTypeNumber, Min: floatPtr(1), Max: floatPtr(10)}, value: "2.5"},
+		{name: "not a number", field: Field{Name: "f", Type: FieldTypeNumber}, value: "two", expectErr: true},
+		{name: "number too small", field: Field{Name: "f", Type: FieldTypeNumber, Min: floatPtr(1)}, value: "0", expectErr: true},
+		{name: "number too big", field: Field{Name: "f", Type: FieldTypeNumber, Max: floatPtr(10)}, value: "11", expectErr: true},
+		{name: "boolean", field: Field{Name: "f", Type: FieldTypeBoolean}, value: "false"},
+		{name: "not a boolean", field: Field{Name: "f", Type: FieldTypeBoolean}, value: "maybe", expectErr: true},
+		{name: "date", field: Field{Name: "f", Type: FieldTypeDate}, value: "2024-02-29"},
+		{name: "not a date", field: Field{Name: "f", Type: FieldTypeDate}, value: "2023-02-29", expectErr: true},
+		{name: "string too short", field: Field{Name: "f", Min: floatPtr(3)}, value: "ab", expectErr: true},
+		{name: "string length in characters", field: Field{Name: "f", Max: floatPtr(2)}, value: "éé"},
+		{name: "string too long", field: Field{Name: "f", Type: FieldTypeSecret, Max: floatPtr(2)}, value: "abc", expectErr: true},
+		{name: "pattern", field: Field{Name: "f", Pattern: `^v\d+$`}, value: "v12"},
+		{name: "pattern mismatch", field: Field{Name: "f", Pattern: `^v\d+$`}, value: "12", expectErr: true},
+		{name: "pattern matches whole value", field: Field{Name: "f", Pattern: `[0-9]+`}, value: "123"},
+		{name: "pattern matches part of value", field: Field{Name: "f", Pattern: `[0-9]+`}, value: "abc1", expectErr: true},
+		{name: "pattern alternatives", field: Field{Name: "f", Pattern: `a|b`}, value: "ab", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.field.Validate(tt.value)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Validate() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestFieldCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		field     Field
+		expectErr bool
+	}{
+		{name: "valid", field: Field{Name: "f", Type: FieldTypeNumber, Min: floatPtr(1), Max: floatPtr(2), Default: "1"}},
+		{name: "no name", field: Field{}, expectErr: true},
+		{name: "unknown type", field: Field{Name: "f", Type: "color"}, expectErr: true},
+		{name: "invalid pattern", field: Field{Name: "f", Pattern: "("}, expectErr: true},
+		{name: "min greater than max", field: Field{Name: "f", Min: floatPtr(2), Max: floatPtr(1)}, expectErr: true},
+		{name: "invalid default", field: Field{Name: "f", Type: FieldTypeBoolean, Default: "yes"}, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.field.Check()
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Check() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+func TestFieldsValidate(t *testing.T) {
+	fields := Fields{
+		{Name: "name", Required: true},
+		{Name: "count", Type: FieldTypeNumber, Default: "3"},
+		{Name: "draft", Type: FieldTypeBoolean},
+	}
+
+	values := map[string]string{"name": "test", "count": ""}
+	if err := fields.Validate(values); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	expected := map[string]string{"name": "test", "count": "3"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Validate() set values to %v, expected %v", values, expected)
+	}
+
+	err := fields.Validate(map[string]string{"draft": "maybe"})
+	if err == nil {
+		t.Fatal("Validate() expected an error")
+	}
+	for _, name := range []string{"name", "draft"} {
+		if !strings.Contains(err.Error(), name+":") {
+			t.Errorf("Validate() error %q does not mention %s", err, name)
+		}
+	}
+}
@@ -37,6 +37,7 @@ const (
 	ToolTypeAgent      = ToolType("agent")
 	ToolTypeOutput     = ToolType("output")
 	ToolTypeInput      = ToolType("input")
+	ToolTypeHook       = ToolType("hook")
 	ToolTypeTool       = ToolType("tool")
 	ToolTypeCredential = ToolType("credential")
 	ToolTypeDefault    = ToolType("")
@@ -129,6 +130,11 @@ type Parameters struct {
 	Chat                bool           `json:"chat,omitempty"`
 	Temperature         *float32       `json:"temperature,omitempty"`
 	Cache               *bool          `json:"cache,omitempty"`
+	Compaction          string         `json:"compaction,omitempty"`
+	CompactionModel     string         `json:"compactionModel,omitempty"`
+	ReasoningEffort     string         `json:"reasoningEffort,omitempty"`
+	ToolChoice          string         `json:"toolChoice,omitempty"`
+	ParallelToolCalls   *bool          `json:"parallelToolCalls,omitempty"`
 	InternalPrompt      *bool          `json:"internalPrompt"`
 	Arguments           *humav2.Schema `json:"arguments,omitempty"`
 	Tools               []string       `json:"tools,omitempty"`
@@ -144,6 +150,8 @@ type Parameters struct {
 	ExportInputFilters  []string       `json:"exportInputFilters,omitempty"`
 	OutputFilters       []string       `json:"outputFilters,omitempty"`
 	ExportOutputFilters []string       `json:"exportOutputFilters,omitempty"`
+	Hooks               []string       `json:"hooks,omitempty"`
+	ExportHooks         []string       `json:"exportHooks,omitempty"`
 	Blocking            bool           `json:"-"`
 	Stdin               bool           `json:"stdin,omitempty"`
 	Type                ToolType       `json:"type,omitempty"`
@@ -156,6 +164,7 @@ func (p Parameters) allExports() []string {
 		p.ExportCredentials,
 		p.ExportInputFilters,
 		p.ExportOutputFilters,
+		p.ExportHooks,
 	)
 }
 
@@ -168,6 +177,7 @@ func (p Parameters) allReferences() []string {
 		p.Credentials,
 		p.InputFilters,
 		p.OutputFilters,
+		p.Hooks,
 	)
 }
 
@@ -183,7 +193,9 @@ func (p Parameters) ToolRefNames() []string {
 		p.InputFilters,
 		p.ExportInputFilters,
 		p.OutputFilters,
-		p.ExportOutputFilters)
+		p.ExportOutputFilters,
+		p.Hooks,
+		p.ExportHooks)
 }
 
 type ToolDef struct {
@@ -457,6 +469,12 @@ func (t ToolDef) Print() string {
 	if len(t.ExportOutputFilters) != 0 {
 		_, _ = fmt.Fprintf(buf, "Share Output Filters: %s\n", strings.Join(t.ExportOutputFilters, ", "))
 	}
+	if len(t.Hooks) != 0 {
+		_, _ = fmt.Fprintf(buf, "Hooks: %s\n", strings.Join(t.Hooks, ", "))
+	}
+	if len(t.ExportHooks) != 0 {
+		_, _ = fmt.Fprintf(buf, "Share Hooks: %s\n", strings.Join(t.ExportHooks, ", "))
+	}
 	if t.MaxTokens != 0 {
 		_, _ = fmt.Fprintf(buf, "Max Tokens: %d\n", t.MaxTokens)
 	}
@@ -478,6 +496,21 @@ func (t ToolDef) Print() string {
 	if t.Temperature != nil {
 		_, _ = fmt.Fprintf(buf, "Temperature: %f\n", *t.Temperature)
 	}
+	if t.Compaction != "" {
+		_, _ = fmt.Fprintf(buf, "Compaction: %s\n", t.Compaction)
+	}
+	if t.CompactionModel != "" {
+		_, _ = fmt.Fprintf(buf, "Compaction Model: %s\n", t.CompactionModel)
+	}
+	if t.ReasoningEffort != "" {
+		_, _ = fmt.Fprintf(buf, "Reasoning Effort: %s\n", t.ReasoningEffort)
+	}
+	if t.ToolChoice != "" {
+		_, _ = fmt.Fprintf(buf, "Tool Choice: %s\n", t.ToolChoice)
+	}
+	if t.ParallelToolCalls != nil {
+		_, _ = fmt.Fprintf(buf, "Parallel Tool Calls: %v\n", *t.ParallelToolCalls)
+	}
 	if t.Arguments != nil {
 		var keys []string
 		for k := range t.Arguments.Properties {
@@ -658,6 +691,8 @@ func (t Tool) GetToolsByType(prg *Program, toolType ToolType) ([]ToolReference,
 		directRefs = t.OutputFilters
 	case ToolTypeInput:
 		directRefs = t.InputFilters
+	case ToolTypeHook:
+		directRefs = t.Hooks
 	case ToolTypeTool:
 		toolsListFilterType = append(toolsListFilterType, ToolTypeDefault, ToolTypeAgent)
 	default:
@@ -699,6 +734,8 @@ func (t Tool) GetToolsByType(prg *Program, toolType ToolType) ([]ToolReference,
 			exportRefs = tool.ExportOutputFilters
 		case ToolTypeInput:
 			exportRefs = tool.ExportInputFilters
+		case ToolTypeHook:
+			exportRefs = tool.ExportHooks
 		case ToolTypeTool:
 		default:
 			return nil, fmt.Errorf("unknown tool type %v", toolType)
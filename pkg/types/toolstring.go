@@ -56,18 +56,67 @@ func ToSysDisplayString(id string, args map[string]string) (string, error) {
 			return fmt.Sprintf("Downloading `%s` to `%s`", args["url"], location), nil
 		}
 		return fmt.Sprintf("Downloading `%s` to workspace", args["url"]), nil
+	case "sys.archive.extract":
+		dir := args["directory"]
+		if dir == "" {
+			dir = "."
+		}
+		return fmt.Sprintf("Extracting `%s` to `%s`", args["archive"], dir), nil
+	case "sys.archive.create":
+		return fmt.Sprintf("Creating archive `%s`", args["archive"]), nil
+	case "sys.edit":
+		return fmt.Sprintf("Editing `%s`", args["filename"]), nil
+	case "sys.patch":
+		return "Applying patch", nil
+	case "sys.json.query":
+		return fmt.Sprintf("Selecting `%s` from JSON", args["path"]), nil
+	case "sys.sql.query":
+		return fmt.Sprintf("Querying `%s`", args["query"]), nil
+	case "sys.sql.exec":
+		return fmt.Sprintf("Changing `%s`", args["database"]), nil
 	case "sys.exec":
 		return fmt.Sprintf("Running `%s`", args["command"]), nil
+	case "sys.exec.start":
+		return fmt.Sprintf("Starting `%s` in the background", args["command"]), nil
+	case "sys.exec.status":
+		if args["id"] == "" {
+			return "Checking background processes", nil
+		}
+		return fmt.Sprintf("Checking process `%s`", args["id"]), nil
+	case "sys.exec.output":
+		return fmt.Sprintf("Reading output of process `%s`", args["id"]), nil
+	case "sys.exec.signal":
+		return fmt.Sprintf("Signaling process `%s`", args["id"]), nil
+	case "sys.exec.wait":
+		return fmt.Sprintf("Waiting for process `%s`", args["id"]), nil
 	case "sys.find":
 		dir := args["directory"]
 		if dir == "" {
 			dir = "."
 		}
 		return fmt.Sprintf("Finding `%s` in `%s`", args["pattern"], dir), nil
+	case "sys.grep":
+		dir := args["directory"]
+		if dir == "" {
+			dir = "."
+		}
+		return fmt.Sprintf("Searching for `%s` in `%s`", args["pattern"], dir), nil
+	case "sys.search":
+		dir := args["directory"]
+		if dir == "" {
+			dir = "."
+		}
+		return fmt.Sprintf("Searching for `%s` in `%s`", args["query"], dir), nil
 	case "sys.http.get":
 		return fmt.Sprintf("Downloading `%s`", args["url"]), nil
 	case "sys.http.post":
 		return fmt.Sprintf("Sending to `%s`", args["url"]), nil
+	case "sys.http.request":
+		method := strings.ToUpper(args["method"])
+		if method == "" {
+			method = "GET"
+		}
+		return fmt.Sprintf("Sending %s request to `%s`", method, args["url"]), nil
 	case "sys.http.html2text":
 		return fmt.Sprintf("Downloading `%s`", args["url"]), nil
 	case "sys.ls":
@@ -78,6 +127,14 @@ func ToSysDisplayString(id string, args map[string]string) (string, error) {
 		return fmt.Sprintf("Removing `%s`", args["location"]), nil
 	case "sys.write":
 		return fmt.Sprintf("Writing `%s`", args["filename"]), nil
+	case "sys.memory.put":
+		return fmt.Sprintf("Remembering `%s`", args["key"]), nil
+	case "sys.memory.get":
+		return fmt.Sprintf("Recalling `%s`", args["key"]), nil
+	case "sys.memory.search":
+		return "Searching memories", nil
+	case "sys.memory.delete":
+		return fmt.Sprintf("Forgetting `%s`", args["key"]), nil
 	case "sys.context", "sys.stat", "sys.getenv", "sys.abort", "sys.chat.current", "sys.chat.finish", "sys.chat.history", "sys.echo", "sys.prompt", "sys.time.now", "sys.model.provider.credential":
 		return "", nil
 	case "sys.openapi":